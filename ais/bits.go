@@ -0,0 +1,82 @@
+package ais
+
+import "strings"
+
+// bitWriter packs the fields of a message into a bit string, most significant bit first.
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func newBitWriter(size int) *bitWriter {
+	return &bitWriter{buf: make([]byte, (size+7)/8)}
+}
+
+// uint writes the lowest width bits of v.
+func (w *bitWriter) uint(v uint64, width int) {
+	for i := width - 1; i >= 0; i-- {
+		if w.n/8 >= len(w.buf) {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[w.n/8] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+// int writes v as a two's complement number of width bits.
+func (w *bitWriter) int(v int64, width int) {
+	w.uint(uint64(v)&(1<<uint(width)-1), width)
+}
+
+func (w *bitWriter) bool(v bool) {
+	if v {
+		w.uint(1, 1)
+	} else {
+		w.uint(0, 1)
+	}
+}
+
+// text writes s as 6-bit ASCII of n characters, padded with '@'.
+// Lowercase letters are converted to uppercase, characters
+// outside the 6-bit alphabet are replaced with '?'.
+func (w *bitWriter) text(s string, n int) {
+	s = strings.ToUpper(s)
+	for i := 0; i < n; i++ {
+		c := byte('@')
+		if i < len(s) {
+			c = s[i]
+		}
+		switch {
+		case c >= 64 && c < 96:
+			c -= 64
+		case c >= 32 && c < 64:
+		default:
+			c = '?'
+		}
+		w.uint(uint64(c), 6)
+	}
+}
+
+// armor returns the payload of the bits in 6-bit ASCII armoring
+// and the number of fill bits added to the last character.
+func (w *bitWriter) armor() (string, int) {
+	fill := (6 - w.n%6) % 6
+	payload := make([]byte, 0, (w.n+fill)/6)
+	for i := 0; i < w.n; i += 6 {
+		var v byte
+		for j := 0; j < 6; j++ {
+			v <<= 1
+			if k := i + j; k < w.n && w.buf[k/8]&(0x80>>uint(k%8)) != 0 {
+				v |= 1
+			}
+		}
+		v += 48
+		if v > 87 {
+			v += 8
+		}
+		payload = append(payload, v)
+	}
+	return string(payload), fill
+}
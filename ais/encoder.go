@@ -0,0 +1,322 @@
+// Package ais encodes device states as AIS messages in !AIVDM sentences
+// for the simulation of vessel traffic.
+package ais
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Navigation statuses of Class A position reports.
+const (
+	StatusUnderWayUsingEngine = 0
+	StatusAtAnchor            = 1
+	StatusMoored              = 5
+	StatusUndefined           = 15
+)
+
+// Message types.
+const (
+	TypePositionA       = 1
+	TypePositionAAssign = 2
+	TypePositionAPolled = 3
+	TypeStaticVoyage    = 5
+	TypePositionB       = 18
+	TypeStaticB         = 24
+)
+
+// DefaultMovingSpeed is the default speed in knots above which a vessel is under way.
+const DefaultMovingSpeed = 0.5
+
+const (
+	knotsPerMS = 1.943844
+	coordScale = 600000 // 1/10000 minute
+
+	lonNA      = 181 * coordScale
+	latNA      = 91 * coordScale
+	sogNA      = 1023
+	sogMax     = 1022
+	cogNA      = 3600
+	headingNA  = 511
+	rotNA      = -128
+	timeNA     = 60
+	timeNoFix  = 63
+	epfdGPS    = 1
+	csRadio    = 0b1100000000000000110
+	mmsiDigits = 9
+)
+
+// MMSI returns the MMSI of the device. A device ID of 9 digits is used as is.
+// Any other ID is hashed into a stable 9-digit MMSI starting with 2 to 7.
+func MMSI(deviceID string) uint32 {
+	if len(deviceID) == mmsiDigits {
+		if v, err := strconv.ParseUint(deviceID, 10, 32); err == nil {
+			return uint32(v)
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(deviceID))
+	return 200000000 + h.Sum32()%600000000
+}
+
+// Vessel holds the static and voyage data of a vessel.
+type Vessel struct {
+	Name        string // up to 20 characters
+	CallSign    string // up to 7 characters
+	ShipType    int    // e.g. 60 passenger, 70 cargo, 80 tanker
+	IMO         uint32
+	ToBow       int // meters from the reference point
+	ToStern     int
+	ToPort      int
+	ToStarboard int
+	Draught     float64 // meters
+	Destination string  // up to 20 characters
+	ETA         time.Time
+}
+
+// Encoder converts device states into AIS messages.
+// An Encoder keeps the sequential message ID of multi-fragment sentences
+// and is not safe for concurrent use.
+type Encoder struct {
+	// Channel is the radio channel, 'A' (default) or 'B'.
+	Channel byte
+
+	// ClassB makes the encoder emit Class B messages 18 and 24
+	// instead of the Class A messages 1 and 5.
+	ClassB bool
+
+	// MessageType is the type of the Class A position reports: 1, 2 or 3. Default 1.
+	MessageType int
+
+	// MovingSpeed is the speed in knots above which a vessel is under way.
+	// Default DefaultMovingSpeed.
+	MovingSpeed float64
+
+	seqID int
+}
+
+// NewEncoder creates a new Class A Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{
+		Channel:     'A',
+		MessageType: TypePositionA,
+		MovingSpeed: DefaultMovingSpeed,
+	}
+}
+
+// AppendPosition appends the position report of the device state at time t to dst.
+// Speed is reported as SOG, Location.Bearing as COG and true heading.
+// A device in offline mode is reported without a position.
+func (e *Encoder) AppendPosition(dst []byte, t time.Time, dev *pb.Device) []byte {
+	var w *bitWriter
+	if e.ClassB {
+		w = e.positionB(t, dev)
+	} else {
+		w = e.positionA(t, dev)
+	}
+	return e.appendMessage(dst, w)
+}
+
+// AppendStatic appends the static and voyage data of the vessel to dst:
+// message 5 for Class A, parts A and B of message 24 for Class B.
+// If v is nil, the name of the vessel is taken from the device model.
+func (e *Encoder) AppendStatic(dst []byte, dev *pb.Device, v *Vessel) []byte {
+	if v == nil {
+		v = &Vessel{Name: dev.Model}
+	}
+	if !e.ClassB {
+		return e.appendMessage(dst, staticVoyage(dev, v))
+	}
+	dst = e.appendMessage(dst, staticB(dev, v, 0))
+	return e.appendMessage(dst, staticB(dev, v, 1))
+}
+
+func (e *Encoder) appendMessage(dst []byte, w *bitWriter) []byte {
+	channel := e.Channel
+	if channel == 0 {
+		channel = 'A'
+	}
+	payload, fill := w.armor()
+	if len(payload) > MaxFragmentPayload {
+		e.seqID = (e.seqID + 1) % 10
+	}
+	return AppendSentences(dst, payload, fill, channel, e.seqID)
+}
+
+// navigation holds the position fields shared by the position reports.
+type navigation struct {
+	lon, lat  int64
+	sog, cog  uint64
+	heading   uint64
+	timestamp uint64
+	moving    bool
+	valid     bool
+}
+
+func (e *Encoder) navigation(t time.Time, dev *pb.Device) navigation {
+	nav := navigation{
+		lon:       lonNA,
+		lat:       latNA,
+		sog:       sogNA,
+		cog:       cogNA,
+		heading:   headingNA,
+		timestamp: timeNoFix,
+	}
+	loc := dev.Location
+	if dev.IsOffline || loc == nil {
+		return nav
+	}
+	movingSpeed := e.MovingSpeed
+	if movingSpeed <= 0 {
+		movingSpeed = DefaultMovingSpeed
+	}
+	knots := dev.Speed * knotsPerMS
+	nav.valid = true
+	nav.moving = knots > movingSpeed
+	nav.lon = int64(math.Round(loc.Lon * coordScale))
+	nav.lat = int64(math.Round(loc.Lat * coordScale))
+	nav.sog = uint64(math.Min(math.Round(knots*10), sogMax))
+	nav.cog = uint64(math.Round(loc.Bearing*10)) % 3600
+	nav.heading = uint64(math.Round(loc.Bearing)) % 360
+	nav.timestamp = uint64(t.UTC().Second())
+	if nav.timestamp >= timeNA {
+		nav.timestamp = timeNA
+	}
+	return nav
+}
+
+// positionA returns message 1, 2 or 3 (168 bits).
+func (e *Encoder) positionA(t time.Time, dev *pb.Device) *bitWriter {
+	typ := e.MessageType
+	if typ < TypePositionA || typ > TypePositionAPolled {
+		typ = TypePositionA
+	}
+	nav := e.navigation(t, dev)
+	status := StatusUndefined
+	switch {
+	case nav.moving:
+		status = StatusUnderWayUsingEngine
+	case nav.valid:
+		status = StatusMoored
+	}
+
+	w := newBitWriter(168)
+	w.uint(uint64(typ), 6)
+	w.uint(0, 2) // repeat indicator
+	w.uint(uint64(MMSI(dev.Id)), 30)
+	w.uint(uint64(status), 4)
+	w.int(rotNA, 8)
+	w.uint(nav.sog, 10)
+	w.bool(false) // position accuracy
+	w.int(nav.lon, 28)
+	w.int(nav.lat, 27)
+	w.uint(nav.cog, 12)
+	w.uint(nav.heading, 9)
+	w.uint(nav.timestamp, 6)
+	w.uint(0, 2)  // maneuver indicator
+	w.uint(0, 3)  // spare
+	w.bool(false) // RAIM
+	w.uint(0, 19) // radio status
+	return w
+}
+
+// positionB returns message 18 (168 bits) of a Class B CS unit.
+func (e *Encoder) positionB(t time.Time, dev *pb.Device) *bitWriter {
+	nav := e.navigation(t, dev)
+	w := newBitWriter(168)
+	w.uint(TypePositionB, 6)
+	w.uint(0, 2)
+	w.uint(uint64(MMSI(dev.Id)), 30)
+	w.uint(0, 8) // reserved
+	w.uint(nav.sog, 10)
+	w.bool(false)
+	w.int(nav.lon, 28)
+	w.int(nav.lat, 27)
+	w.uint(nav.cog, 12)
+	w.uint(nav.heading, 9)
+	w.uint(nav.timestamp, 6)
+	w.uint(0, 2)  // reserved
+	w.bool(true)  // CS unit
+	w.bool(false) // display
+	w.bool(false) // DSC
+	w.bool(true)  // whole band
+	w.bool(true)  // message 22
+	w.bool(false) // assigned mode
+	w.bool(false) // RAIM
+	w.uint(csRadio, 20)
+	return w
+}
+
+// staticVoyage returns message 5 (424 bits).
+func staticVoyage(dev *pb.Device, v *Vessel) *bitWriter {
+	w := newBitWriter(424)
+	w.uint(TypeStaticVoyage, 6)
+	w.uint(0, 2)
+	w.uint(uint64(MMSI(dev.Id)), 30)
+	w.uint(0, 2) // AIS version
+	w.uint(uint64(v.IMO), 30)
+	w.text(v.CallSign, 7)
+	w.text(v.Name, 20)
+	w.uint(uint64(v.ShipType), 8)
+	appendDimensions(w, v)
+	w.uint(epfdGPS, 4)
+	if v.ETA.IsZero() {
+		w.uint(0, 4)
+		w.uint(0, 5)
+		w.uint(24, 5)
+		w.uint(60, 6)
+	} else {
+		eta := v.ETA.UTC()
+		w.uint(uint64(eta.Month()), 4)
+		w.uint(uint64(eta.Day()), 5)
+		w.uint(uint64(eta.Hour()), 5)
+		w.uint(uint64(eta.Minute()), 6)
+	}
+	w.uint(uint64(math.Min(math.Round(v.Draught*10), 255)), 8)
+	w.text(v.Destination, 20)
+	w.bool(false) // DTE ready
+	w.uint(0, 1)  // spare
+	return w
+}
+
+// staticB returns part A (160 bits) or part B (168 bits) of message 24.
+func staticB(dev *pb.Device, v *Vessel, part int) *bitWriter {
+	w := newBitWriter(168)
+	w.uint(TypeStaticB, 6)
+	w.uint(0, 2)
+	w.uint(uint64(MMSI(dev.Id)), 30)
+	w.uint(uint64(part), 2)
+	if part == 0 {
+		w.text(v.Name, 20)
+		return w
+	}
+	w.uint(uint64(v.ShipType), 8)
+	w.text("", 3) // vendor ID
+	w.uint(0, 4)  // unit model code
+	w.uint(0, 20) // serial number
+	w.text(v.CallSign, 7)
+	appendDimensions(w, v)
+	w.uint(0, 6) // spare
+	return w
+}
+
+func appendDimensions(w *bitWriter, v *Vessel) {
+	w.uint(uint64(clamp(v.ToBow, 511)), 9)
+	w.uint(uint64(clamp(v.ToStern, 511)), 9)
+	w.uint(uint64(clamp(v.ToPort, 63)), 6)
+	w.uint(uint64(clamp(v.ToStarboard, 63)), 6)
+}
+
+func clamp(v, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,290 @@
+package ais
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmadfox/go-gpsgen/nmea"
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+// bitReader reads the fields of a dearmored payload.
+type bitReader struct {
+	bits []byte
+	pos  int
+}
+
+func dearmor(t *testing.T, payload string, fill int) *bitReader {
+	r := new(bitReader)
+	for i := 0; i < len(payload); i++ {
+		v := payload[i] - 48
+		if v > 40 {
+			v -= 8
+		}
+		require.Less(t, v, byte(64))
+		for j := 5; j >= 0; j-- {
+			r.bits = append(r.bits, v>>uint(j)&1)
+		}
+	}
+	r.bits = r.bits[:len(r.bits)-fill]
+	return r
+}
+
+func (r *bitReader) uint(width int) uint64 {
+	var v uint64
+	for i := 0; i < width; i++ {
+		v = v<<1 | uint64(r.bits[r.pos])
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) int(width int) int64 {
+	v := r.uint(width)
+	if v&(1<<uint(width-1)) != 0 {
+		return int64(v) - 1<<uint(width)
+	}
+	return int64(v)
+}
+
+func (r *bitReader) text(n int) string {
+	var s []byte
+	for i := 0; i < n; i++ {
+		c := byte(r.uint(6))
+		if c < 32 {
+			c += 64
+		}
+		s = append(s, c)
+	}
+	return strings.TrimRight(string(s), "@")
+}
+
+// parse checks the sentences and returns the reassembled payloads and their fill bits.
+func parse(t *testing.T, data []byte) ([]string, []int) {
+	var payloads []string
+	var fills []int
+	var payload string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		require.True(t, strings.HasPrefix(line, "!AIVDM,"), line)
+		i := strings.LastIndexByte(line, '*')
+		require.Equal(t, fmt.Sprintf("%02X", nmea.Checksum(line[1:i])), line[i+1:])
+		fields := strings.Split(line[1:i], ",")
+		require.Len(t, fields, 7)
+		require.LessOrEqual(t, len(fields[5]), MaxFragmentPayload)
+		payload += fields[5]
+		if fields[1] == fields[2] {
+			payloads = append(payloads, payload)
+			fills = append(fills, int(fields[6][0]-'0'))
+			payload = ""
+		}
+	}
+	return payloads, fills
+}
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "477553000",
+		Model:     "Sea Breeze",
+		Speed:     5,
+		IsOffline: offline,
+		Location: &pb.Device_Location{
+			Lat:     47.582833,
+			Lon:     -122.345832,
+			Bearing: 51.2,
+		},
+	}
+}
+
+func TestArmor(t *testing.T) {
+	payload := "177KQJ5000G?tO`K>RA1wUbN0TKH"
+	r := dearmor(t, payload, 0)
+	require.Equal(t, uint64(1), r.uint(6))
+	r.uint(2)
+	require.Equal(t, uint64(477553000), r.uint(30))
+	require.Equal(t, uint64(StatusMoored), r.uint(4))
+	r.uint(8)
+	require.Equal(t, uint64(0), r.uint(10))
+	r.uint(1)
+	require.InDelta(t, -122.345832, float64(r.int(28))/coordScale, 2e-6)
+	require.InDelta(t, 47.582833, float64(r.int(27))/coordScale, 2e-6)
+	require.Equal(t, uint64(510), r.uint(12))
+	require.Equal(t, uint64(181), r.uint(9))
+	require.Equal(t, uint64(15), r.uint(6))
+
+	w := newBitWriter(168)
+	for _, bit := range dearmor(t, payload, 0).bits {
+		w.uint(uint64(bit), 1)
+	}
+	got, fill := w.armor()
+	require.Equal(t, payload, got)
+	require.Zero(t, fill)
+}
+
+func TestMMSI(t *testing.T) {
+	require.Equal(t, uint32(477553000), MMSI("477553000"))
+	mmsi := MMSI("dev1")
+	require.Equal(t, mmsi, MMSI("dev1"))
+	require.GreaterOrEqual(t, mmsi, uint32(200000000))
+	require.Less(t, mmsi, uint32(800000000))
+}
+
+func TestEncoder_PositionA(t *testing.T) {
+	enc := NewEncoder()
+	enc.MessageType = TypePositionAPolled
+	data := enc.AppendPosition(nil, testTime, testDevice(false))
+	require.True(t, strings.HasPrefix(string(data), "!AIVDM,1,1,,A,3"))
+	payloads, fills := parse(t, data)
+	require.Len(t, payloads, 1)
+	require.Len(t, payloads[0], 28)
+
+	r := dearmor(t, payloads[0], fills[0])
+	require.Equal(t, uint64(TypePositionAPolled), r.uint(6))
+	r.uint(2)
+	require.Equal(t, uint64(477553000), r.uint(30))
+	require.Equal(t, uint64(StatusUnderWayUsingEngine), r.uint(4))
+	require.Equal(t, int64(rotNA), r.int(8))
+	require.Equal(t, uint64(97), r.uint(10))
+	r.uint(1)
+	require.InDelta(t, -122.345832, float64(r.int(28))/coordScale, 2e-6)
+	require.InDelta(t, 47.582833, float64(r.int(27))/coordScale, 2e-6)
+	require.Equal(t, uint64(512), r.uint(12))
+	require.Equal(t, uint64(51), r.uint(9))
+	require.Equal(t, uint64(19), r.uint(6))
+
+	dev := testDevice(false)
+	dev.Speed = 0
+	r = dearmor(t, strings.Split(string(enc.AppendPosition(nil, testTime, dev)), ",")[5], 0)
+	r.uint(38)
+	require.Equal(t, uint64(StatusMoored), r.uint(4))
+
+	r = dearmor(t, strings.Split(string(enc.AppendPosition(nil, testTime, testDevice(true))), ",")[5], 0)
+	r.uint(38)
+	require.Equal(t, uint64(StatusUndefined), r.uint(4))
+	r.uint(8)
+	require.Equal(t, uint64(sogNA), r.uint(10))
+	r.uint(1)
+	require.Equal(t, int64(lonNA), r.int(28))
+	require.Equal(t, int64(latNA), r.int(27))
+	require.Equal(t, uint64(cogNA), r.uint(12))
+	require.Equal(t, uint64(headingNA), r.uint(9))
+	require.Equal(t, uint64(timeNoFix), r.uint(6))
+}
+
+func TestEncoder_StaticVoyage(t *testing.T) {
+	enc := NewEncoder()
+	vessel := &Vessel{
+		Name:        "Sea Breeze",
+		CallSign:    "WDC1234",
+		ShipType:    60,
+		IMO:         9074729,
+		ToBow:       100,
+		ToStern:     20,
+		ToPort:      8,
+		ToStarboard: 7,
+		Draught:     5.4,
+		Destination: "Seattle",
+		ETA:         time.Date(2023, 3, 24, 6, 30, 0, 0, time.UTC),
+	}
+	data := enc.AppendStatic(nil, testDevice(false), vessel)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], "!AIVDM,2,1,1,A,5"))
+	require.True(t, strings.HasPrefix(lines[1], "!AIVDM,2,2,1,A,"))
+	require.True(t, strings.HasSuffix(strings.Split(lines[0], "*")[0], ",0"))
+	payloads, fills := parse(t, data)
+	require.Len(t, payloads, 1)
+	require.Equal(t, 2, fills[0])
+
+	r := dearmor(t, payloads[0], fills[0])
+	require.Len(t, r.bits, 424)
+	require.Equal(t, uint64(TypeStaticVoyage), r.uint(6))
+	r.uint(2)
+	require.Equal(t, uint64(477553000), r.uint(30))
+	r.uint(2)
+	require.Equal(t, uint64(9074729), r.uint(30))
+	require.Equal(t, "WDC1234", r.text(7))
+	require.Equal(t, "SEA BREEZE", r.text(20))
+	require.Equal(t, uint64(60), r.uint(8))
+	require.Equal(t, []uint64{100, 20, 8, 7}, []uint64{r.uint(9), r.uint(9), r.uint(6), r.uint(6)})
+	require.Equal(t, uint64(epfdGPS), r.uint(4))
+	require.Equal(t, []uint64{3, 24, 6, 30}, []uint64{r.uint(4), r.uint(5), r.uint(5), r.uint(6)})
+	require.Equal(t, uint64(54), r.uint(8))
+	require.Equal(t, "SEATTLE", r.text(20))
+
+	// the sequential message ID rotates
+	data = enc.AppendStatic(nil, testDevice(false), nil)
+	require.True(t, strings.HasPrefix(string(data), "!AIVDM,2,1,2,A,5"))
+	payloads, fills = parse(t, data)
+	r = dearmor(t, payloads[0], fills[0])
+	r.uint(112)
+	require.Equal(t, "SEA BREEZE", r.text(20))
+}
+
+func TestEncoder_ClassB(t *testing.T) {
+	enc := &Encoder{ClassB: true, Channel: 'B'}
+	data := enc.AppendPosition(nil, testTime, testDevice(false))
+	data = enc.AppendStatic(data, testDevice(false), &Vessel{Name: "Sea Breeze", CallSign: "WDC1234", ShipType: 37})
+	payloads, fills := parse(t, data)
+	require.Len(t, payloads, 3)
+	require.True(t, strings.HasPrefix(string(data), "!AIVDM,1,1,,B,B"))
+
+	r := dearmor(t, payloads[0], fills[0])
+	require.Len(t, r.bits, 168)
+	require.Equal(t, uint64(TypePositionB), r.uint(6))
+	r.uint(2)
+	require.Equal(t, uint64(477553000), r.uint(30))
+	r.uint(8)
+	require.Equal(t, uint64(97), r.uint(10))
+
+	r = dearmor(t, payloads[1], fills[1])
+	require.Len(t, r.bits, 160)
+	require.Equal(t, uint64(TypeStaticB), r.uint(6))
+	r.uint(32)
+	require.Equal(t, uint64(0), r.uint(2))
+	require.Equal(t, "SEA BREEZE", r.text(20))
+
+	r = dearmor(t, payloads[2], fills[2])
+	require.Len(t, r.bits, 168)
+	r.uint(38)
+	require.Equal(t, uint64(1), r.uint(2))
+	require.Equal(t, uint64(37), r.uint(8))
+	r.uint(42)
+	require.Equal(t, "WDC1234", r.text(7))
+}
+
+func TestSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSink(&buf, &SinkOptions{StaticInterval: time.Minute})
+	dev2 := testDevice(false)
+	dev2.Id = "dev2"
+	pck := &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices:   []*pb.Device{testDevice(false), dev2},
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Write(ctx, pck))
+		pck.Timestamp += 30
+	}
+	require.NoError(t, sink.Close())
+
+	payloads, _ := parse(t, buf.Bytes())
+	var static, positions int
+	for _, payload := range payloads {
+		switch payload[0] {
+		case '5':
+			static++
+		case '1':
+			positions++
+		}
+	}
+	require.Equal(t, 4, static)
+	require.Equal(t, 6, positions)
+}
@@ -0,0 +1,59 @@
+package ais
+
+import (
+	"strconv"
+
+	"github.com/mmadfox/go-gpsgen/nmea"
+)
+
+// MaxFragmentPayload is the maximum number of payload characters per sentence.
+const MaxFragmentPayload = 60
+
+// AppendSentences appends the !AIVDM sentences carrying the armored payload to dst.
+// A payload longer than MaxFragmentPayload is split into fragments sharing
+// the sequential message ID seqID (0-9); fill bits are reported on the last fragment.
+func AppendSentences(dst []byte, payload string, fill int, channel byte, seqID int) []byte {
+	count := (len(payload) + MaxFragmentPayload - 1) / MaxFragmentPayload
+	if count == 0 {
+		count = 1
+	}
+	var body []byte
+	for i := 0; i < count; i++ {
+		end := (i + 1) * MaxFragmentPayload
+		if end > len(payload) {
+			end = len(payload)
+		}
+		fragmentFill := 0
+		if i == count-1 {
+			fragmentFill = fill
+		}
+		body = append(body[:0], "AIVDM,"...)
+		body = strconv.AppendInt(body, int64(count), 10)
+		body = append(body, ',')
+		body = strconv.AppendInt(body, int64(i+1), 10)
+		body = append(body, ',')
+		if count > 1 {
+			body = strconv.AppendInt(body, int64(seqID%10), 10)
+		}
+		body = append(body, ',')
+		if channel != 0 {
+			body = append(body, channel)
+		}
+		body = append(body, ',')
+		body = append(body, payload[i*MaxFragmentPayload:end]...)
+		body = append(body, ',')
+		body = strconv.AppendInt(body, int64(fragmentFill), 10)
+
+		dst = append(dst, '!')
+		dst = append(dst, body...)
+		dst = append(dst, '*')
+		dst = appendHexByte(dst, nmea.Checksum(string(body)))
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
+}
+
+func appendHexByte(dst []byte, b byte) []byte {
+	const digits = "0123456789ABCDEF"
+	return append(dst, digits[b>>4], digits[b&0x0F])
+}
@@ -0,0 +1,103 @@
+package ais
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// DefaultStaticInterval is the default interval of the static and voyage data of a vessel.
+const DefaultStaticInterval = 6 * time.Minute
+
+// SinkOptions defines the options of a Sink.
+type SinkOptions struct {
+	// Encoder encodes the messages. Default NewEncoder.
+	Encoder *Encoder
+
+	// Vessels holds the static data of the vessels by device ID.
+	// Vessels without data are named after the device model.
+	Vessels map[string]*Vessel
+
+	// StaticInterval is the interval of the static and voyage data of every vessel,
+	// measured in packet time. Default DefaultStaticInterval.
+	StaticInterval time.Duration
+}
+
+// Sink writes the AIS stream of all devices to a writer, the way
+// a shore station receives the vessels in range. Every packet produces
+// a position report per device; the static and voyage data of a vessel
+// is sent with its first report and then every StaticInterval.
+// Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	mu       sync.Mutex
+	w        io.Writer
+	enc      *Encoder
+	vessels  map[string]*Vessel
+	interval time.Duration
+	static   map[string]time.Time
+	buf      []byte
+}
+
+// NewSink creates a new Sink writing to w.
+func NewSink(w io.Writer, opts *SinkOptions) *Sink {
+	if opts == nil {
+		opts = new(SinkOptions)
+	}
+	s := &Sink{
+		w:        w,
+		enc:      opts.Encoder,
+		vessels:  opts.Vessels,
+		interval: opts.StaticInterval,
+		static:   make(map[string]time.Time),
+	}
+	if s.enc == nil {
+		s.enc = NewEncoder()
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultStaticInterval
+	}
+	return s
+}
+
+// Write writes the sentences of the devices of the packet.
+// The packet timestamp is used as the time of the reports.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	s.buf = s.buf[:0]
+	for i := 0; i < len(pck.Devices); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		if last, ok := s.static[dev.Id]; !ok || t.Sub(last) >= s.interval {
+			s.buf = s.enc.AppendStatic(s.buf, dev, s.vessels[dev.Id])
+			s.static[dev.Id] = t
+		}
+		s.buf = s.enc.AppendPosition(s.buf, t, dev)
+	}
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.buf)
+	return err
+}
+
+// Close closes the writer if it implements io.Closer.
+func (s *Sink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
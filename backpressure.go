@@ -0,0 +1,115 @@
+package gpsgen
+
+import (
+	"sync/atomic"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// BackpressurePolicy defines how the Generator behaves when packet consumers
+// (the OnPacket callback and sinks) are slower than the packet production.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock delivers packets synchronously.
+	// Each iteration waits until all its packets are consumed. This is the default.
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureBuffer queues packets up to Options.BufferSize, the high-water mark.
+	// An iteration only waits while the queue is at the high-water mark.
+	BackpressureBuffer
+
+	// BackpressureDropNewest queues packets up to Options.BufferSize
+	// and drops the new packet when the queue is full.
+	BackpressureDropNewest
+
+	// BackpressureDropOldest queues packets up to Options.BufferSize
+	// and drops the oldest queued packet when the queue is full.
+	BackpressureDropOldest
+)
+
+const defaultBufferSize = 64
+
+// String returns the name of the policy.
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureBuffer:
+		return "buffer"
+	case BackpressureDropNewest:
+		return "drop-newest"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+type delivery struct {
+	data   []byte
+	packet *pb.Packet
+}
+
+// DroppedPackets returns the number of packets dropped by the backpressure policy.
+func (g *Generator) DroppedPackets() uint64 {
+	return atomic.LoadUint64(&g.dropped)
+}
+
+// DelayedTicks returns the number of iterations that overran the interval
+// because stepping devices or delivering packets took too long.
+// A growing value means the generator itself is the bottleneck
+// and the simulated motion is stretched.
+func (g *Generator) DelayedTicks() uint64 {
+	return atomic.LoadUint64(&g.delayed)
+}
+
+// enqueue hands a copy of the packet over to the delivery goroutine
+// according to the backpressure policy.
+func (g *Generator) enqueue(data []byte, pck *pb.Packet) {
+	d := &delivery{data: data}
+	if pck != nil {
+		d.packet = proto.Clone(pck).(*pb.Packet)
+	}
+
+	switch g.backpressure {
+	case BackpressureDropNewest:
+		select {
+		case g.queue <- d:
+		default:
+			atomic.AddUint64(&g.dropped, 1)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case g.queue <- d:
+				return
+			default:
+			}
+			select {
+			case <-g.queue:
+				atomic.AddUint64(&g.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case g.queue <- d:
+		case <-g.abortCtx.Done():
+		}
+	}
+}
+
+// doDelivery is the single consumer of the queue, so packets reach
+// the OnPacket callback and the sinks in the order they were produced.
+func (g *Generator) doDelivery() {
+	defer g.dwg.Done()
+
+	for d := range g.queue {
+		if g.isAborted() {
+			return
+		}
+		g.deliver(d.data, d.packet)
+	}
+}
@@ -0,0 +1,212 @@
+package gpsgen
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func runBackpressure(t *testing.T, policy BackpressurePolicy, ticks int) (*Generator, []int64) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval:     time.Second,
+		NumWorkers:   1,
+		Clock:        clock,
+		Backpressure: policy,
+		BufferSize:   2,
+	})
+	require.NoError(t, gen.Attach(NewTracker()))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	timestamps := make([]int64, 0)
+	gen.OnPacket(func(b []byte) error {
+		once.Do(func() { close(started) })
+		<-release
+		pck, err := PacketFromBytes(b)
+		require.NoError(t, err)
+		mu.Lock()
+		timestamps = append(timestamps, pck.Timestamp-start.Unix())
+		mu.Unlock()
+		return nil
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+
+	for i := 0; i < ticks; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+		if i == 0 {
+			<-started
+		}
+	}
+	close(release)
+	gen.Close()
+	<-done
+	return gen, timestamps
+}
+
+func TestBackpressure_DropNewest(t *testing.T) {
+	gen, timestamps := runBackpressure(t, BackpressureDropNewest, 6)
+	// one packet in delivery, two in the queue, the rest is dropped
+	require.Equal(t, uint64(3), gen.DroppedPackets())
+	require.Equal(t, []int64{1, 2, 3}, timestamps)
+}
+
+func TestBackpressure_DropOldest(t *testing.T) {
+	gen, timestamps := runBackpressure(t, BackpressureDropOldest, 6)
+	require.Equal(t, uint64(3), gen.DroppedPackets())
+	require.Equal(t, []int64{1, 5, 6}, timestamps)
+}
+
+func TestBackpressure_Buffer(t *testing.T) {
+	gen, timestamps := runBackpressure(t, BackpressureBuffer, 3)
+	require.Zero(t, gen.DroppedPackets())
+	require.Equal(t, []int64{1, 2, 3}, timestamps)
+}
+
+func TestBackpressure_BufferOrder(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval:     time.Second,
+		NumWorkers:   4,
+		Clock:        clock,
+		Backpressure: BackpressureBuffer,
+		BufferSize:   8,
+	})
+	for i := 0; i < 8; i++ {
+		require.NoError(t, gen.Attach(NewTracker()))
+	}
+
+	var mu sync.Mutex
+	timestamps := make([]int64, 0)
+	gen.OnPacket(func(b []byte) error {
+		pck, err := PacketFromBytes(b)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		timestamps = append(timestamps, pck.Timestamp)
+		mu.Unlock()
+		return nil
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+	for i := 0; i < 20; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+
+	require.NotEmpty(t, timestamps)
+	for i := 1; i < len(timestamps); i++ {
+		require.LessOrEqual(t, timestamps[i-1], timestamps[i])
+	}
+}
+
+type slowEncoder struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (e *slowEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	e.once.Do(func() { close(e.started) })
+	<-e.release
+	return ProtoEncoder{}.Encode(dst, pck)
+}
+
+type closeSink struct {
+	mu     sync.Mutex
+	closed bool
+	late   int
+}
+
+func (s *closeSink) Write(context.Context, *pb.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		s.late++
+	}
+	return nil
+}
+
+func (s *closeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestBackpressure_AbortDuringEncode(t *testing.T) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	enc := &slowEncoder{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	gen := New(&Options{
+		Interval:     time.Second,
+		NumWorkers:   1,
+		Clock:        clock,
+		Backpressure: BackpressureDropNewest,
+		Encoder:      enc,
+	})
+	require.NoError(t, gen.Attach(NewTracker()))
+	gen.OnPacket(func([]byte) error { return nil })
+	sink := &closeSink{}
+	require.NoError(t, gen.AddSink(sink))
+
+	done := make(chan error)
+	go func() {
+		done <- gen.Run(context.Background())
+	}()
+
+	clock.Advance(time.Second)
+	<-enc.started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, gen.Shutdown(ctx), context.DeadlineExceeded)
+
+	// Run waits for the worker, which enqueues its packet after the abort
+	select {
+	case <-done:
+		t.Fatal("Run returned before the worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(enc.release)
+	require.NoError(t, <-done)
+	require.True(t, sink.closed)
+	require.Zero(t, sink.late)
+}
+
+func TestBackpressurePolicy_String(t *testing.T) {
+	require.Equal(t, "block", BackpressureBlock.String())
+	require.Equal(t, "buffer", BackpressureBuffer.String())
+	require.Equal(t, "drop-newest", BackpressureDropNewest.String())
+	require.Equal(t, "drop-oldest", BackpressureDropOldest.String())
+	require.Equal(t, "unknown", BackpressurePolicy(100).String())
+}
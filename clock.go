@@ -0,0 +1,200 @@
+package gpsgen
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and tickers for the Generator.
+// Packet timestamps and the tick passed to Device.Next are derived from it.
+type Clock interface {
+	// Now returns the current time of the clock.
+	Now() time.Time
+
+	// NewTicker returns a new Ticker that delivers the clock time every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock at intervals.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// RealClock returns a Clock backed by the system wall clock.
+func RealClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{Ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// ManualClock is a Clock whose time only moves when Advance is called.
+// It is intended for tests that need to step the simulation deterministically.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+// NewManualClock creates a new ManualClock set to the given start time.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a new Ticker that fires every d of simulated time.
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTicker{
+		clock:  c,
+		ch:     make(chan time.Time, 1),
+		period: d,
+		next:   c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d and fires all tickers that became due.
+// As with time.Ticker, a ticker holds a single pending tick and a tick is dropped
+// if the previous one has not been received yet. When d spans several periods,
+// only the first due tick is delivered and the others are dropped, so tests that
+// need every tick should advance by one period and wait for it to be consumed.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for i := 0; i < len(c.tickers); i++ {
+		t := c.tickers[i]
+		for !t.next.After(c.now) {
+			select {
+			case t.ch <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+type manualTicker struct {
+	clock  *ManualClock
+	ch     chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i := 0; i < len(t.clock.tickers); i++ {
+		if t.clock.tickers[i] == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+}
+
+// ScaledClock returns a Clock that starts at the given time and runs
+// factor times faster than the wall clock. A factor of 60 simulates
+// one hour per real minute. Factors less than or equal to zero are treated as 1.
+func ScaledClock(start time.Time, factor float64) Clock {
+	if factor <= 0 {
+		factor = 1
+	}
+	return &scaledClock{
+		start:  start,
+		origin: time.Now(),
+		factor: factor,
+	}
+}
+
+type scaledClock struct {
+	start  time.Time
+	origin time.Time
+	factor float64
+}
+
+func (c *scaledClock) Now() time.Time {
+	return c.at(time.Now())
+}
+
+func (c *scaledClock) NewTicker(d time.Duration) Ticker {
+	period := time.Duration(float64(d) / c.factor)
+	if period <= 0 {
+		period = time.Nanosecond
+	}
+	t := &scaledTicker{
+		ticker: time.NewTicker(period),
+		ch:     make(chan time.Time, 1),
+		done:   make(chan struct{}),
+	}
+	go t.run(c)
+	return t
+}
+
+func (c *scaledClock) at(t time.Time) time.Time {
+	elapsed := time.Duration(float64(t.Sub(c.origin)) * c.factor)
+	return c.start.Add(elapsed)
+}
+
+type scaledTicker struct {
+	ticker *time.Ticker
+	ch     chan time.Time
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (t *scaledTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *scaledTicker) Stop() {
+	t.once.Do(func() {
+		t.ticker.Stop()
+		close(t.done)
+	})
+}
+
+func (t *scaledTicker) run(c *scaledClock) {
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-t.ticker.C:
+			select {
+			case t.ch <- c.at(now):
+			default:
+			}
+		}
+	}
+}
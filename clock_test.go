@@ -0,0 +1,32 @@
+package gpsgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock_Advance(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// three periods at once: the first due tick is delivered, the others are dropped
+	clock.Advance(3 * time.Second)
+	require.Equal(t, start.Add(4*time.Second), clock.Now())
+	require.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	require.Len(t, ticker.C(), 0)
+
+	// the ticker keeps its phase
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(5*time.Second), <-ticker.C())
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	require.Len(t, ticker.C(), 0)
+}
@@ -14,8 +14,6 @@ const (
 	ModeMinEnd
 )
 
-var rnd = random.NewRandom()
-
 // Point represents a point in 2D space.
 type Point struct {
 	X, Y float64
@@ -31,6 +29,7 @@ type Curve struct {
 	points   []point
 	mode     int
 	min, max float64
+	rnd      *random.Random
 }
 
 // Min returns the minimum value of the curve.
@@ -43,6 +42,16 @@ func (c *Curve) Max() float64 {
 	return c.max
 }
 
+// Source returns the random source of the curve. Nil means the shared source.
+func (c *Curve) Source() *random.Random {
+	return c.rnd
+}
+
+// SetSource sets the random source of the subsequent draws. A nil src uses the shared source.
+func (c *Curve) SetSource(src *random.Random) {
+	c.rnd = src
+}
+
 // NumControlPoints returns the number of control points in the curve.
 func (c *Curve) NumControlPoints() int {
 	return len(c.points)
@@ -57,7 +66,7 @@ func (c *Curve) Shuffle() {
 		} else if c.mode&ModeMinEnd != 0 && i == len(c.points)-1 {
 			y = float64(c.min)
 		} else {
-			y = randomFloat(c.min, c.max)
+			y = c.randomFloat(c.min, c.max)
 		}
 		c.points[i] = point{vp: Point{X: float64(i), Y: y}}
 	}
@@ -143,8 +152,15 @@ func (c *Curve) FromSnapshot(snap *proto.Snapshot_Curve) {
 
 const defaultControlPoint = 4
 
-// New creates a new Curve with specified parameters.
+// New creates a new Curve with specified parameters
+// that draws its control points from the shared random source.
 func New(min, max float64, controlPoints int, m CurveMode) *Curve {
+	return NewWithSource(nil, min, max, controlPoints, m)
+}
+
+// NewWithSource creates a new Curve with specified parameters
+// that draws its control points from src. A nil src uses the shared source.
+func NewWithSource(src *random.Random, min, max float64, controlPoints int, m CurveMode) *Curve {
 	if controlPoints <= 0 {
 		controlPoints = defaultControlPoint
 	}
@@ -152,6 +168,7 @@ func New(min, max float64, controlPoints int, m CurveMode) *Curve {
 	curv := Curve{
 		points: make([]point, controlPoints),
 		mode:   int(m),
+		rnd:    src,
 	}
 
 	for i := 0; i < controlPoints; i++ {
@@ -161,7 +178,7 @@ func New(min, max float64, controlPoints int, m CurveMode) *Curve {
 		} else if m&ModeMinEnd != 0 && i == controlPoints-1 {
 			y = float64(min)
 		} else {
-			y = randomFloat(min, max)
+			y = curv.randomFloat(min, max)
 		}
 		curv.points[i] = point{vp: Point{X: float64(i), Y: y}}
 	}
@@ -186,6 +203,6 @@ func New(min, max float64, controlPoints int, m CurveMode) *Curve {
 	return &curv
 }
 
-func randomFloat(min, max float64) float64 {
-	return min + rnd.Float64()*(max-min)
+func (c *Curve) randomFloat(min, max float64) float64 {
+	return min + random.Or(c.rnd).Float64()*(max-min)
 }
@@ -0,0 +1,397 @@
+package gpsgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultKeyframeInterval is the default number of packets per device between two keyframes.
+const DefaultKeyframeInterval = 60
+
+// ErrKeyframeRequired is returned by Reassembler when a delta of a device
+// does not follow the previous one, so its state can not be rebuilt.
+// The device is skipped until its next keyframe.
+var ErrKeyframeRequired = errors.New("gpsgen: delta sequence gap, keyframe required")
+
+// Wire layout of a delta packet. The packet mirrors pb.Packet:
+// field 1 holds the device deltas and field 2 the timestamp.
+// A device delta holds the keyframe flag, a partial pb.Device message
+// that only contains the changed top-level fields, the numbers
+// of the fields that were cleared since the previous packet
+// and the sequence number of the packet for the device.
+const (
+	deltaFieldDevice    protowire.Number = 1
+	deltaFieldTimestamp protowire.Number = 2
+
+	deltaFieldKeyframe protowire.Number = 1
+	deltaFieldState    protowire.Number = 2
+	deltaFieldCleared  protowire.Number = 3
+	deltaFieldSeq      protowire.Number = 4
+
+	deviceFieldID protowire.Number = 1
+)
+
+// deltaFields maps top-level field numbers of a pb.Device to their raw wire encoding.
+// Repeated fields are concatenated under a single number.
+type deltaFields map[protowire.Number][]byte
+
+// DeltaEncoder is an Encoder that only emits the device fields that changed
+// since the previous packet of the same device.
+// The first packet of a device is a keyframe with the full state,
+// and keyframes repeat every keyframe interval packets so that a Reassembler
+// that joined late or lost packets can recover.
+// Changes are tracked per top-level field of pb.Device: a nested message
+// such as the location or the list of sensors is re-sent as a whole
+// when any part of it changes.
+// DeltaEncoder is stateful and safe for concurrent use; packets must be
+// decoded by a Reassembler in the order they were encoded.
+type DeltaEncoder struct {
+	mu               sync.Mutex
+	keyframeInterval int
+	devices          map[string]*deltaDevice
+	buf              []byte
+}
+
+type deltaDevice struct {
+	fields deltaFields
+	count  int
+	seq    uint64
+}
+
+// NewDeltaEncoder creates a new DeltaEncoder that emits a keyframe
+// every keyframeInterval packets per device.
+// If keyframeInterval is less than or equal to zero, DefaultKeyframeInterval is used.
+func NewDeltaEncoder(keyframeInterval int) *DeltaEncoder {
+	if keyframeInterval <= 0 {
+		keyframeInterval = DefaultKeyframeInterval
+	}
+	return &DeltaEncoder{
+		keyframeInterval: keyframeInterval,
+		devices:          make(map[string]*deltaDevice),
+	}
+}
+
+// Encode appends the delta encoding of the packet to dst.
+func (e *DeltaEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := proto.MarshalOptions{Deterministic: true}
+	var delta []byte
+	for i := 0; i < len(pck.Devices); i++ {
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		data, err := enc.MarshalAppend(e.buf[:0], dev)
+		if err != nil {
+			return dst, err
+		}
+		e.buf = data
+		fields, err := splitDeltaFields(data)
+		if err != nil {
+			return dst, err
+		}
+
+		state, ok := e.devices[dev.Id]
+		keyframe := !ok || state.count%e.keyframeInterval == 0
+		if !ok {
+			state = new(deltaDevice)
+			e.devices[dev.Id] = state
+		}
+		if keyframe {
+			state.count = 0
+		}
+
+		delta = delta[:0]
+		if keyframe {
+			delta = protowire.AppendTag(delta, deltaFieldKeyframe, protowire.VarintType)
+			delta = protowire.AppendVarint(delta, 1)
+		}
+		delta = protowire.AppendTag(delta, deltaFieldState, protowire.BytesType)
+		delta = protowire.AppendBytes(delta, fields.diff(state.fields, keyframe))
+		if !keyframe {
+			if cleared := fields.cleared(state.fields); len(cleared) > 0 {
+				delta = protowire.AppendTag(delta, deltaFieldCleared, protowire.BytesType)
+				delta = protowire.AppendBytes(delta, cleared)
+			}
+		}
+		delta = protowire.AppendTag(delta, deltaFieldSeq, protowire.VarintType)
+		delta = protowire.AppendVarint(delta, state.seq)
+
+		dst = protowire.AppendTag(dst, deltaFieldDevice, protowire.BytesType)
+		dst = protowire.AppendBytes(dst, delta)
+
+		state.fields = fields
+		state.count++
+		state.seq++
+	}
+	if pck.Timestamp != 0 {
+		dst = protowire.AppendTag(dst, deltaFieldTimestamp, protowire.VarintType)
+		dst = protowire.AppendVarint(dst, uint64(pck.Timestamp))
+	}
+	return dst, nil
+}
+
+// Forget drops the state of the device, so its next packet is a keyframe.
+func (e *DeltaEncoder) Forget(deviceID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.devices, deviceID)
+}
+
+// Reset drops the state of all devices.
+func (e *DeltaEncoder) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.devices = make(map[string]*deltaDevice)
+}
+
+// Reassembler rebuilds full device states from packets encoded by a DeltaEncoder.
+// Deltas of devices without a preceding keyframe are skipped until
+// the next keyframe of the device arrives.
+// Reassembler is safe for concurrent use.
+type Reassembler struct {
+	mu      sync.Mutex
+	devices map[string]*deltaDevice
+	buf     []byte
+}
+
+// NewReassembler creates a new Reassembler.
+func NewReassembler() *Reassembler {
+	return &Reassembler{
+		devices: make(map[string]*deltaDevice),
+	}
+}
+
+// Apply decodes a delta packet and returns the packet with the full states
+// of its devices.
+// If deltas of some devices were lost, Apply returns the packet with
+// the remaining devices and an error wrapping ErrKeyframeRequired.
+func (r *Reassembler) Apply(data []byte) (*pb.Packet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var gaps []error
+	pck := new(pb.Packet)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, deltaError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == deltaFieldDevice && typ == protowire.BytesType:
+			var delta []byte
+			delta, n = protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, deltaError(n)
+			}
+			dev, err := r.apply(delta)
+			if errors.Is(err, ErrKeyframeRequired) {
+				gaps = append(gaps, err)
+			} else if err != nil {
+				return nil, err
+			}
+			if dev != nil {
+				pck.Devices = append(pck.Devices, dev)
+			}
+		case num == deltaFieldTimestamp && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			pck.Timestamp = int64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, deltaError(n)
+		}
+		data = data[n:]
+	}
+	return pck, errors.Join(gaps...)
+}
+
+// Decode is an alias for Apply, so a Reassembler can be used as a Decoder.
+func (r *Reassembler) Decode(data []byte) (*pb.Packet, error) {
+	return r.Apply(data)
+}
+
+// Forget drops the state of the device.
+func (r *Reassembler) Forget(deviceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.devices, deviceID)
+}
+
+// Reset drops the state of all devices.
+func (r *Reassembler) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.devices = make(map[string]*deltaDevice)
+}
+
+func (r *Reassembler) apply(delta []byte) (*pb.Device, error) {
+	var (
+		keyframe bool
+		state    []byte
+		cleared  []byte
+		seq      uint64
+		hasSeq   bool
+	)
+	for len(delta) > 0 {
+		num, typ, n := protowire.ConsumeTag(delta)
+		if n < 0 {
+			return nil, deltaError(n)
+		}
+		delta = delta[n:]
+		switch {
+		case num == deltaFieldKeyframe && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(delta)
+			keyframe = v != 0
+		case num == deltaFieldState && typ == protowire.BytesType:
+			state, n = protowire.ConsumeBytes(delta)
+		case num == deltaFieldCleared && typ == protowire.BytesType:
+			cleared, n = protowire.ConsumeBytes(delta)
+		case num == deltaFieldSeq && typ == protowire.VarintType:
+			seq, n = protowire.ConsumeVarint(delta)
+			hasSeq = true
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, delta)
+		}
+		if n < 0 {
+			return nil, deltaError(n)
+		}
+		delta = delta[n:]
+	}
+
+	changed, err := splitDeltaFields(state)
+	if err != nil {
+		return nil, err
+	}
+	deviceID, err := changed.id()
+	if err != nil {
+		return nil, err
+	}
+
+	prev, ok := r.devices[deviceID]
+	var fields deltaFields
+	switch {
+	case keyframe:
+		fields = changed
+		r.devices[deviceID] = &deltaDevice{fields: fields, seq: seq}
+	case !ok:
+		return nil, nil
+	case hasSeq && seq != prev.seq+1:
+		delete(r.devices, deviceID)
+		return nil, fmt.Errorf("%w: device %s, got %d, want %d",
+			ErrKeyframeRequired, deviceID, seq, prev.seq+1)
+	default:
+		fields = prev.fields
+		prev.seq = seq
+		for num, raw := range changed {
+			fields[num] = raw
+		}
+		for len(cleared) > 0 {
+			v, n := protowire.ConsumeVarint(cleared)
+			if n < 0 {
+				return nil, deltaError(n)
+			}
+			delete(fields, protowire.Number(v))
+			cleared = cleared[n:]
+		}
+	}
+
+	r.buf = fields.appendAll(r.buf[:0])
+	dev := new(pb.Device)
+	if err := proto.Unmarshal(r.buf, dev); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+func splitDeltaFields(data []byte) (deltaFields, error) {
+	fields := make(deltaFields)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, deltaError(n)
+		}
+		m := protowire.ConsumeFieldValue(num, typ, data[n:])
+		if m < 0 {
+			return nil, deltaError(m)
+		}
+		fields[num] = append(fields[num], data[:n+m]...)
+		data = data[n+m:]
+	}
+	return fields, nil
+}
+
+func (f deltaFields) numbers() []protowire.Number {
+	nums := make([]protowire.Number, 0, len(f))
+	for num := range f {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	return nums
+}
+
+// diff returns the wire encoding of the fields that differ from prev.
+// The device ID is always included.
+func (f deltaFields) diff(prev deltaFields, all bool) []byte {
+	var b []byte
+	for _, num := range f.numbers() {
+		raw := f[num]
+		if all || num == deviceFieldID || !bytes.Equal(raw, prev[num]) {
+			b = append(b, raw...)
+		}
+	}
+	return b
+}
+
+// cleared returns the packed numbers of the fields present in prev but not in f.
+func (f deltaFields) cleared(prev deltaFields) []byte {
+	var b []byte
+	for _, num := range prev.numbers() {
+		if _, ok := f[num]; !ok {
+			b = protowire.AppendVarint(b, uint64(num))
+		}
+	}
+	return b
+}
+
+func (f deltaFields) appendAll(b []byte) []byte {
+	for _, num := range f.numbers() {
+		b = append(b, f[num]...)
+	}
+	return b
+}
+
+func (f deltaFields) id() (string, error) {
+	raw, ok := f[deviceFieldID]
+	if !ok {
+		return "", nil
+	}
+	_, _, n := protowire.ConsumeTag(raw)
+	if n < 0 {
+		return "", deltaError(n)
+	}
+	id, m := protowire.ConsumeString(raw[n:])
+	if m < 0 {
+		return "", deltaError(m)
+	}
+	return id, nil
+}
+
+func deltaError(n int) error {
+	return fmt.Errorf("gpsgen: invalid delta packet: %w", protowire.ParseError(n))
+}
@@ -0,0 +1,143 @@
+package gpsgen
+
+import (
+	"testing"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDeltaEncoder_Reassembler(t *testing.T) {
+	devices := make([]*Device, 3)
+	for i := 0; i < len(devices); i++ {
+		dev, err := NewDevice(nil)
+		require.NoError(t, err)
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		dev.AddSensor(makeSensor(t, "s1"))
+		devices[i] = dev
+	}
+
+	enc := NewDeltaEncoder(5)
+	r := NewReassembler()
+	var keyframeSize int
+	for i := 0; i < 12; i++ {
+		pck := &pb.Packet{Timestamp: int64(i + 1)}
+		for j := 0; j < len(devices); j++ {
+			devices[j].Next(1)
+			pck.Devices = append(pck.Devices, devices[j].State())
+		}
+
+		data, err := enc.Encode(nil, pck)
+		require.NoError(t, err)
+		switch {
+		case i%5 == 0:
+			keyframeSize = len(data)
+		default:
+			require.Less(t, len(data), keyframeSize)
+		}
+
+		got, err := r.Apply(data)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(pck, got))
+	}
+}
+
+func TestDeltaEncoder_ClearedFields(t *testing.T) {
+	enc := NewDeltaEncoder(0)
+	r := NewReassembler()
+
+	dev := &pb.Device{Id: "dev1", IsOffline: true, OfflineDuration: 10, Speed: 2}
+	data, err := enc.Encode(nil, &pb.Packet{Devices: []*pb.Device{dev}})
+	require.NoError(t, err)
+	_, err = r.Apply(data)
+	require.NoError(t, err)
+
+	dev = &pb.Device{Id: "dev1", Speed: 2}
+	data, err = enc.Encode(nil, &pb.Packet{Devices: []*pb.Device{dev}})
+	require.NoError(t, err)
+	got, err := r.Apply(data)
+	require.NoError(t, err)
+	require.Len(t, got.Devices, 1)
+	require.True(t, proto.Equal(dev, got.Devices[0]))
+}
+
+func TestReassembler_MissingKeyframe(t *testing.T) {
+	enc := NewDeltaEncoder(3)
+	dev := &pb.Device{Id: "dev1", Speed: 1}
+	pck := &pb.Packet{Devices: []*pb.Device{dev}}
+
+	_, err := enc.Encode(nil, pck)
+	require.NoError(t, err)
+
+	r := NewReassembler()
+	for i := 2; i <= 4; i++ {
+		dev.Speed = float64(i)
+		data, err := enc.Encode(nil, pck)
+		require.NoError(t, err)
+		got, err := r.Apply(data)
+		require.NoError(t, err)
+		if i < 4 {
+			require.Empty(t, got.Devices)
+			continue
+		}
+		require.Len(t, got.Devices, 1)
+		require.Equal(t, float64(4), got.Devices[0].Speed)
+	}
+
+	_, err = r.Apply([]byte{0x0a, 0xff})
+	require.Error(t, err)
+}
+
+func TestReassembler_SequenceGap(t *testing.T) {
+	enc := NewDeltaEncoder(4)
+	r := NewReassembler()
+	dev1 := &pb.Device{Id: "dev1", Speed: 1}
+	dev2 := &pb.Device{Id: "dev2", Speed: 1}
+
+	encode := func(devices ...*pb.Device) []byte {
+		data, err := enc.Encode(nil, &pb.Packet{Devices: devices})
+		require.NoError(t, err)
+		return data
+	}
+
+	_, err := r.Apply(encode(dev1, dev2))
+	require.NoError(t, err)
+
+	// the second delta of dev1 is lost
+	dev1.Speed = 2
+	encode(dev1)
+
+	dev1.Speed = 3
+	dev2.Speed = 3
+	got, err := r.Apply(encode(dev1, dev2))
+	require.ErrorIs(t, err, ErrKeyframeRequired)
+	require.Len(t, got.Devices, 1)
+	require.Equal(t, "dev2", got.Devices[0].Id)
+
+	// dev1 is skipped until its next keyframe
+	dev1.Speed = 4
+	got, err = r.Apply(encode(dev1))
+	require.NoError(t, err)
+	require.Empty(t, got.Devices)
+
+	dev1.Speed = 5
+	got, err = r.Apply(encode(dev1))
+	require.NoError(t, err)
+	require.Len(t, got.Devices, 1)
+	require.True(t, proto.Equal(dev1, got.Devices[0]))
+}
+
+func TestGenerator_DetachForgetsDelta(t *testing.T) {
+	enc := NewDeltaEncoder(0)
+	gen := New(&Options{Encoder: enc})
+	dev := NewTracker()
+	require.NoError(t, gen.Attach(dev))
+
+	_, err := enc.Encode(nil, &pb.Packet{Devices: []*pb.Device{dev.State()}})
+	require.NoError(t, err)
+	require.Len(t, enc.devices, 1)
+
+	require.NoError(t, gen.Detach(dev.ID()))
+	require.Empty(t, enc.devices)
+}
@@ -6,11 +6,13 @@ import (
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/navigator"
 	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/mmadfox/go-gpsgen/types"
 	"google.golang.org/protobuf/proto"
 )
@@ -39,6 +41,10 @@ type Device struct {
 	avgT      float64
 	tick      uint32
 	ns        [3]int
+	interval  time.Duration
+	offline   float64
+	omit      FieldMask
+	rnd       *random.Random
 }
 
 // NewDevice creates a new GPS tracking device with the provided options.
@@ -47,12 +53,14 @@ func NewDevice(opts *DeviceOptions) (*Device, error) {
 		opts = NewDeviceOptions()
 	}
 
-	navigator, err := navigator.New(opts.navOpts()...)
+	rnd := opts.source()
+
+	navigator, err := navigator.New(opts.navOpts(rnd)...)
 	if err != nil {
 		return nil, err
 	}
 
-	speed, err := types.NewSpeed(opts.Speed.Min, opts.Speed.Max, opts.Speed.Amplitude)
+	speed, err := types.NewSpeedWithSource(rnd, opts.Speed.Min, opts.Speed.Max, opts.Speed.Amplitude)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +71,7 @@ func NewDevice(opts *DeviceOptions) (*Device, error) {
 	}
 
 	state := initDeviceState()
-	if err := opts.applyFor(state); err != nil {
+	if err := opts.applyFor(state, rnd); err != nil {
 		return nil, err
 	}
 
@@ -73,7 +81,11 @@ func NewDevice(opts *DeviceOptions) (*Device, error) {
 		speed:     speed,
 		battery:   battery,
 		state:     state,
+		interval:  opts.Interval,
+		omit:      opts.OmitFields,
+		rnd:       rnd,
 	}
+	dev.applyOmitFields()
 
 	return dev, nil
 }
@@ -135,6 +147,25 @@ func (d *Device) SetDescription(descr string) {
 	d.state.Description = descr
 }
 
+// SetInterval sets the report interval of the device.
+// A zero interval reports the device on every Generator iteration.
+// Intervals are rounded up to multiples of the Generator interval.
+func (d *Device) SetInterval(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if interval < 0 {
+		interval = 0
+	}
+	d.interval = interval
+}
+
+// Interval returns the report interval of the device.
+func (d *Device) Interval() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.interval
+}
+
 // ID returns the ID of the device.
 func (d *Device) ID() string {
 	d.mu.RLock()
@@ -195,6 +226,9 @@ func (d *Device) AddSensor(sensor ...*types.Sensor) {
 		if s == nil || d.hasSensor(sensor[i].ID()) {
 			continue
 		}
+		if d.rnd != nil && s.Source() == nil {
+			s.SetSource(d.rnd)
+		}
 		d.sensors = append(d.sensors, sensor[i])
 		ok++
 	}
@@ -631,27 +665,47 @@ func (d *Device) Version() [3]int {
 // It updates the device's position, speed, elevation, battery level, sensors, and state.
 // Returns true if the state was successfully updated, and false if no routes are available or if the navigator has finished.
 func (d *Device) Next(tick float64) bool {
-	ok := d.mu.TryLock()
-	if !ok {
+	return d.next(tick).ok
+}
+
+// next advances the device like Next and additionally reports whether the step
+// was skipped because the device was locked by another goroutine
+// and which navigation changes occurred during the step.
+func (d *Device) next(tick float64) (st step) {
+	if locked := d.mu.TryLock(); !locked {
 		d.incTick()
-		return false
+		st.skipped = true
+		return
 	}
 	defer d.mu.Unlock()
 
 	if d.navigator.NumRoutes() == 0 {
-		return false
+		return
 	}
 
+	routeIndex := d.navigator.RouteIndex()
+	trackIndex := d.navigator.TrackIndex()
+	segmentIndex := d.navigator.SegmentIndex()
+	wasOffline := d.navigator.IsOffline()
+	defer func() {
+		d.detectChanges(&st, routeIndex, trackIndex, segmentIndex, wasOffline)
+	}()
+
 	tickLock := atomic.LoadUint32(&d.tick)
 	seconds := float64(float64(tickLock) + tick)
 	d.resetTick()
 	d.state.Duration += seconds
 	d.state.Tick = seconds
 
+	if wasOffline {
+		d.offline += seconds
+	}
+
 	d.battery.Next(seconds)
 	if d.battery.IsLow() {
 		d.battery.Reset()
 		d.navigator.ToOffline()
+		st.changes |= changeBatteryReset
 	}
 
 	t := d.nextT(seconds)
@@ -659,10 +713,11 @@ func (d *Device) Next(tick float64) bool {
 	nextSpeed := d.speed.Value()
 	d.state.Speed = nextSpeed
 
-	if ok := d.navigator.NextLocation(seconds, nextSpeed); !ok {
+	if moved := d.navigator.NextLocation(seconds, nextSpeed); !moved {
 		d.updateOfflineState()
 
 		if d.navigator.IsFinish() {
+			st.changes |= changeFinished
 			d.state.Duration = 0
 			d.speed.Shuffle()
 			d.navigator.ShuffleElevation()
@@ -671,7 +726,7 @@ func (d *Device) Next(tick float64) bool {
 			}
 			d.updateState()
 		}
-		return false
+		return
 	}
 
 	d.navigator.NextElevation(t)
@@ -688,7 +743,34 @@ func (d *Device) Next(tick float64) bool {
 	}
 
 	d.updateState()
-	return true
+	st.ok = true
+	return
+}
+
+func (d *Device) detectChanges(st *step, routeIndex, trackIndex, segmentIndex int, wasOffline bool) {
+	st.routeIndex = d.navigator.RouteIndex()
+	st.trackIndex = d.navigator.TrackIndex()
+	st.segmentIndex = d.navigator.SegmentIndex()
+	switch {
+	case st.routeIndex != routeIndex:
+		st.changes |= changeRoute
+	case st.trackIndex != trackIndex:
+		st.changes |= changeTrack
+	case st.segmentIndex != segmentIndex:
+		st.changes |= changeSegment
+	}
+
+	isOffline := d.navigator.IsOffline()
+	switch {
+	case !wasOffline && isOffline:
+		st.changes |= changeOffline
+		st.duration = time.Duration(float64(d.navigator.OfflineDuration()) * d.state.Tick * float64(time.Second))
+		d.offline = 0
+	case wasOffline && !isOffline:
+		st.changes |= changeOnline
+		st.duration = time.Duration(d.offline * float64(time.Second))
+		d.offline = 0
+	}
 }
 
 // MarshalBinary converts the device's current state into a binary representation.
@@ -717,6 +799,9 @@ func (d *Device) UnmarshalBinary(data []byte) error {
 // Snapshot creates and returns a snapshot of the device's current state.
 // The snapshot includes device information, status, duration, navigator, speed, battery, and sensors (if any).
 func (d *Device) Snapshot() *pb.Snapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	snap := &pb.Snapshot{
 		Id:        d.state.Id,
 		UserId:    d.state.UserId,
@@ -733,11 +818,9 @@ func (d *Device) Snapshot() *pb.Snapshot {
 
 	if len(d.sensors) > 0 {
 		snap.Sensors = make([]*pb.Snapshot_SensorType, len(d.sensors))
-		d.mu.RLock()
 		for i := 0; i < len(d.sensors); i++ {
 			snap.Sensors[i] = d.sensors[i].Snapshot()
 		}
-		d.mu.RUnlock()
 	}
 	return snap
 }
@@ -750,6 +833,7 @@ func (d *Device) FromSnapshot(snap *pb.Snapshot) {
 	defer d.mu.Unlock()
 
 	d.state = initDeviceState()
+	d.applyOmitFields()
 	d.state.Id = snap.Id
 	d.state.UserId = snap.UserId
 	d.state.Tick = snap.Tick
@@ -773,6 +857,7 @@ func (d *Device) FromSnapshot(snap *pb.Snapshot) {
 			d.sensors[i] = sensor
 		}
 	}
+	d.applySource()
 	d.updateSensors()
 	d.updateState()
 	d.updateRoutes()
@@ -787,6 +872,44 @@ func NewSensor(name string, min, max float64, amplitude int, mode types.SensorMo
 	return types.NewSensor(name, min, max, amplitude, mode)
 }
 
+// NewSensorWithSource is like NewSensor but draws the ID and the random curve from src.
+// A nil src uses the shared source until the sensor is added to a device with a source.
+func NewSensorWithSource(
+	src *random.Random,
+	name string,
+	min, max float64,
+	amplitude int,
+	mode types.SensorMode,
+) (*types.Sensor, error) {
+	return types.NewSensorWithSource(src, name, min, max, amplitude, mode)
+}
+
+// lendSource sets src as the random source of a device created without one,
+// and of its sensors that have none.
+func (d *Device) lendSource(src *random.Random) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rnd != nil || src == nil {
+		return
+	}
+	d.rnd = src
+	d.applySource()
+}
+
+// applySource passes the random source of the device to its generators.
+func (d *Device) applySource() {
+	if d.rnd == nil {
+		return
+	}
+	d.speed.SetSource(d.rnd)
+	d.navigator.SetSource(d.rnd)
+	for i := 0; i < len(d.sensors); i++ {
+		if d.sensors[i].Source() == nil {
+			d.sensors[i].SetSource(d.rnd)
+		}
+	}
+}
+
 func (d *Device) mount() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -855,6 +978,9 @@ func (d *Device) updateSensors() {
 }
 
 func (d *Device) updateRoutes() {
+	if d.state.Routes == nil {
+		return
+	}
 	d.state.Routes.Routes = make([]*pb.Device_Routes_Route, 0, d.navigator.NumRoutes())
 	for i := 0; i < d.navigator.NumRoutes(); i++ {
 		route := d.navigator.RouteAt(i)
@@ -927,11 +1053,15 @@ func initDeviceState() *pb.Device {
 			LonDms: &pb.Device_Location_DMS{},
 			Utm:    &pb.Device_Location_UTM{},
 		},
-		Units: &pb.Device_Unit{
-			Distance:  "meters",
-			Speed:     "meter per second",
-			Time:      "seconds",
-			Elevation: "meters",
-		},
+		Units: newDeviceUnits(),
+	}
+}
+
+func newDeviceUnits() *pb.Device_Unit {
+	return &pb.Device_Unit{
+		Distance:  "meters",
+		Speed:     "meter per second",
+		Time:      "seconds",
+		Elevation: "meters",
 	}
 }
@@ -3,7 +3,6 @@ package gpsgen
 import (
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/mmadfox/go-gpsgen/navigator"
 	pb "github.com/mmadfox/go-gpsgen/proto"
@@ -19,6 +18,24 @@ type DeviceOptions struct {
 	UserID string // User ID associated with the device.
 	Descr  string // Description of the device.
 
+	// Interval is the report interval of the device in the Generator.
+	// Zero reports the device on every Generator iteration.
+	Interval time.Duration
+
+	// OmitFields is the set of sections of the device state
+	// that are neither computed nor emitted.
+	OmitFields FieldMask
+
+	// Random is the source of the generated ID, model, color, speed and
+	// elevation curves and offline durations. Nil uses the shared source
+	// until the device is attached to a Generator, which then lends it its own.
+	// Use random.NewRandomWithSeed or Generator.Random for reproducible devices.
+	Random *random.Random
+
+	// Seed seeds a new source of the device when Random is nil.
+	// Zero leaves the source unset.
+	Seed int64
+
 	Navigator struct {
 		SkipOffline bool     // Skip offline mode.
 		Offline     struct { // Offline mode settings.
@@ -46,9 +63,18 @@ type DeviceOptions struct {
 	}
 }
 
-func (o *DeviceOptions) applyFor(s *pb.Device) error {
+// source returns the random source of the device, nil for the shared one.
+func (o *DeviceOptions) source() *random.Random {
+	if o.Random == nil && o.Seed != 0 {
+		return random.NewRandomWithSeed(o.Seed)
+	}
+	return o.Random
+}
+
+func (o *DeviceOptions) applyFor(s *pb.Device, src *random.Random) error {
+	rnd := random.Or(src)
 	if len(o.ID) == 0 {
-		o.ID = uuid.NewString()
+		o.ID = rnd.UUID()
 	}
 	s.Id = o.ID
 	s.Description = o.Descr
@@ -59,7 +85,7 @@ func (o *DeviceOptions) applyFor(s *pb.Device) error {
 		}
 		s.Model = model.String()
 	} else {
-		s.Model = "Device-" + random.String(8)
+		s.Model = "Device-" + rnd.String(8)
 	}
 	s.UserId = o.UserID
 	if len(o.Color) > 0 {
@@ -69,12 +95,12 @@ func (o *DeviceOptions) applyFor(s *pb.Device) error {
 		}
 		s.Color = c.Hex()
 	} else {
-		s.Color = colorful.FastHappyColor().Hex()
+		s.Color = rnd.Color()
 	}
 	return nil
 }
 
-func (o *DeviceOptions) navOpts() []navigator.Option {
+func (o *DeviceOptions) navOpts(src *random.Random) []navigator.Option {
 	opts := make([]navigator.Option, 0)
 	opts = append(opts,
 		navigator.WithElevation(
@@ -91,6 +117,7 @@ func (o *DeviceOptions) navOpts() []navigator.Option {
 	if o.Navigator.SkipOffline {
 		opts = append(opts, navigator.SkipOfflineMode())
 	}
+	opts = append(opts, navigator.WithSource(src))
 	return opts
 }
 
@@ -0,0 +1,11 @@
+// Package gpsgen generates GPS tracks of simulated devices moving along
+// predefined routes and delivers them as packets to callbacks and sinks.
+//
+// Packets can be encoded in full with the protobuf, JSON or CSV encoders,
+// or as deltas with DeltaEncoder and rebuilt with Reassembler.
+// The delta encoding is coarse: it tracks changes per top-level field of a
+// device, so a nested message such as the location or the sensor list is
+// re-sent as a whole when any part of it changes. Every device delta carries
+// a sequence number; when a Reassembler sees a gap it returns
+// ErrKeyframeRequired and skips the device until its next keyframe.
+package gpsgen
@@ -1,15 +1,69 @@
 package gpsgen
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"strconv"
 
 	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
 // PacketFromBytes decodes a byte slice into a protobuf Packet.
 // Returns the decoded Packet and an error if decoding fails.
 func PacketFromBytes(data []byte) (*pb.Packet, error) {
+	return ProtoDecoder{}.Decode(data)
+}
+
+// Encoder encodes packets into a wire format.
+type Encoder interface {
+	// Encode appends the encoded packet to dst and returns the extended buffer.
+	Encode(dst []byte, pck *pb.Packet) ([]byte, error)
+}
+
+// HeaderEncoder is an Encoder of a format that starts with a header, such as CSV.
+// The header is written once before the first packet by the layer that
+// serializes the packets: the Generator passes it to the OnPacket callback
+// before any packet and WriterSink writes it before the first packet.
+type HeaderEncoder interface {
+	Encoder
+
+	// EncodeHeader appends the header to dst and returns the extended buffer.
+	EncodeHeader(dst []byte) ([]byte, error)
+}
+
+// ForgetfulEncoder is an Encoder that keeps state per device between packets,
+// such as DeltaEncoder. The Generator calls Forget when a device is detached,
+// so the state does not grow with every device ever seen and a device
+// attached again with the same ID starts from scratch.
+type ForgetfulEncoder interface {
+	Encoder
+
+	// Forget drops the state of the device.
+	Forget(deviceID string)
+}
+
+// Decoder decodes packets from a wire format.
+type Decoder interface {
+	// Decode decodes a single encoded packet.
+	Decode(data []byte) (*pb.Packet, error)
+}
+
+// ProtoEncoder encodes packets as binary protobuf.
+type ProtoEncoder struct{}
+
+// Encode appends the protobuf encoding of the packet to dst.
+func (ProtoEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	return proto.MarshalOptions{}.MarshalAppend(dst, pck)
+}
+
+// ProtoDecoder decodes packets encoded by ProtoEncoder.
+type ProtoDecoder struct{}
+
+// Decode decodes a binary protobuf packet.
+func (ProtoDecoder) Decode(data []byte) (*pb.Packet, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("gpsgen: invalid packet size")
 	}
@@ -19,3 +73,90 @@ func PacketFromBytes(data []byte) (*pb.Packet, error) {
 	}
 	return pck, nil
 }
+
+// JSONEncoder encodes packets as a single protojson object.
+type JSONEncoder struct{}
+
+// Encode appends the protojson encoding of the packet to dst.
+func (JSONEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	data, err := protojson.Marshal(pck)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
+
+// JSONDecoder decodes packets encoded by JSONEncoder.
+type JSONDecoder struct{}
+
+// Decode decodes a protojson packet.
+func (JSONDecoder) Decode(data []byte) (*pb.Packet, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("gpsgen: invalid packet size")
+	}
+	pck := new(pb.Packet)
+	if err := protojson.Unmarshal(data, pck); err != nil {
+		return nil, err
+	}
+	return pck, nil
+}
+
+// NDJSONEncoder encodes packets as newline-delimited JSON with one device per line.
+// Each line is an object with the packet timestamp and the protojson encoding of the device:
+//
+//	{"timestamp":1690000000,"device":{"id":"...","speed":1.5,...}}
+type NDJSONEncoder struct{}
+
+// Encode appends one line per device of the packet to dst.
+func (NDJSONEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	for i := 0; i < len(pck.Devices); i++ {
+		if pck.Devices[i] == nil {
+			continue
+		}
+		data, err := protojson.Marshal(pck.Devices[i])
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, `{"timestamp":`...)
+		dst = strconv.AppendInt(dst, pck.Timestamp, 10)
+		dst = append(dst, `,"device":`...)
+		dst = append(dst, data...)
+		dst = append(dst, '}', '\n')
+	}
+	return dst, nil
+}
+
+// NDJSONDecoder decodes packets encoded by NDJSONEncoder.
+type NDJSONDecoder struct{}
+
+// Decode decodes the lines of data into a single packet.
+// The packet timestamp is taken from the last line.
+func (NDJSONDecoder) Decode(data []byte) (*pb.Packet, error) {
+	pck := new(pb.Packet)
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var rec struct {
+			Timestamp int64           `json:"timestamp"`
+			Device    json.RawMessage `json:"device"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, err
+		}
+		dev := new(pb.Device)
+		if err := protojson.Unmarshal(rec.Device, dev); err != nil {
+			return nil, err
+		}
+		pck.Timestamp = rec.Timestamp
+		pck.Devices = append(pck.Devices, dev)
+	}
+	return pck, nil
+}
@@ -0,0 +1,297 @@
+package gpsgen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+var csvColumns = []string{
+	"timestamp",
+	"id",
+	"user_id",
+	"model",
+	"color",
+	"description",
+	"tick",
+	"duration",
+	"speed",
+	"lat",
+	"lon",
+	"elevation",
+	"bearing",
+	"is_offline",
+	"offline_duration",
+	"battery_charge",
+	"battery_charge_time",
+	"distance",
+	"current_distance",
+	"route_distance",
+	"current_route_distance",
+	"track_distance",
+	"current_track_distance",
+	"segment_distance",
+	"current_segment_distance",
+	"route_index",
+	"track_index",
+	"segment_index",
+	"route_id",
+	"track_id",
+	"time_estimate",
+	"sensors",
+}
+
+// CSVColumns returns the column names of the CSV encoding in their stable order.
+func CSVColumns() []string {
+	columns := make([]string, len(csvColumns))
+	copy(columns, csvColumns)
+	return columns
+}
+
+type csvSensor struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+// CSVEncoder encodes packets as flat CSV with one device per row.
+// The columns are listed by CSVColumns; sensors are stored
+// as a JSON array in the last column. Routes, units, DMS and UTM are not encoded.
+// CSVEncoder is a HeaderEncoder: the header row is written by
+// the Generator or WriterSink, never by Encode.
+type CSVEncoder struct {
+	header bool
+}
+
+// NewCSVEncoder creates a new CSVEncoder.
+// If header is true, EncodeHeader returns the header row.
+func NewCSVEncoder(header bool) *CSVEncoder {
+	return &CSVEncoder{header: header}
+}
+
+// EncodeHeader appends the header row to dst if the encoder was created with a header.
+func (e *CSVEncoder) EncodeHeader(dst []byte) ([]byte, error) {
+	if !e.header {
+		return dst, nil
+	}
+	buf := bytes.NewBuffer(dst)
+	w := csv.NewWriter(buf)
+	if err := w.Write(csvColumns); err != nil {
+		return dst, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Encode appends one row per device of the packet to dst.
+func (e *CSVEncoder) Encode(dst []byte, pck *pb.Packet) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := csv.NewWriter(buf)
+	record := make([]string, len(csvColumns))
+	for i := 0; i < len(pck.Devices); i++ {
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		if err := csvRecord(record, pck.Timestamp, dev); err != nil {
+			return dst, err
+		}
+		if err := w.Write(record); err != nil {
+			return dst, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// CSVDecoder decodes packets encoded by CSVEncoder.
+type CSVDecoder struct{}
+
+// Decode decodes the rows of data into a single packet, skipping the header row.
+// The packet timestamp is taken from the last row.
+func (CSVDecoder) Decode(data []byte) (*pb.Packet, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = len(csvColumns)
+	r.ReuseRecord = true
+	pck := new(pb.Packet)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record[0] == csvColumns[0] {
+			continue
+		}
+		dev, ts, err := csvDevice(record)
+		if err != nil {
+			return nil, err
+		}
+		pck.Timestamp = ts
+		pck.Devices = append(pck.Devices, dev)
+	}
+	return pck, nil
+}
+
+func csvRecord(record []string, ts int64, dev *pb.Device) error {
+	location := dev.GetLocation()
+	battery := dev.GetBattery()
+	distance := dev.GetDistance()
+	nav := dev.GetNavigator()
+
+	sensors := "[]"
+	if len(dev.Sensors) > 0 {
+		list := make([]csvSensor, len(dev.Sensors))
+		for i := 0; i < len(dev.Sensors); i++ {
+			list[i] = csvSensor{
+				ID:   dev.Sensors[i].Id,
+				Name: dev.Sensors[i].Name,
+				X:    dev.Sensors[i].ValX,
+				Y:    dev.Sensors[i].ValY,
+			}
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		sensors = string(data)
+	}
+
+	record[0] = strconv.FormatInt(ts, 10)
+	record[1] = dev.Id
+	record[2] = dev.UserId
+	record[3] = dev.Model
+	record[4] = dev.Color
+	record[5] = dev.Description
+	record[6] = formatFloat(dev.Tick)
+	record[7] = formatFloat(dev.Duration)
+	record[8] = formatFloat(dev.Speed)
+	record[9] = formatFloat(location.GetLat())
+	record[10] = formatFloat(location.GetLon())
+	record[11] = formatFloat(location.GetElevation())
+	record[12] = formatFloat(location.GetBearing())
+	record[13] = strconv.FormatBool(dev.IsOffline)
+	record[14] = strconv.FormatInt(dev.OfflineDuration, 10)
+	record[15] = formatFloat(battery.GetCharge())
+	record[16] = strconv.FormatInt(battery.GetChargeTime(), 10)
+	record[17] = formatFloat(distance.GetDistance())
+	record[18] = formatFloat(distance.GetCurrentDistance())
+	record[19] = formatFloat(distance.GetRouteDistance())
+	record[20] = formatFloat(distance.GetCurrentRouteDistance())
+	record[21] = formatFloat(distance.GetTrackDistance())
+	record[22] = formatFloat(distance.GetCurrentTrackDistance())
+	record[23] = formatFloat(distance.GetSegmentDistance())
+	record[24] = formatFloat(distance.GetCurrentSegmentDistance())
+	record[25] = strconv.FormatInt(nav.GetCurrentRouteIndex(), 10)
+	record[26] = strconv.FormatInt(nav.GetCurrentTrackIndex(), 10)
+	record[27] = strconv.FormatInt(nav.GetCurrentSegmentIndex(), 10)
+	record[28] = nav.GetCurrentRouteId()
+	record[29] = nav.GetCurrentTrackId()
+	record[30] = formatFloat(dev.TimeEstimate)
+	record[31] = sensors
+	return nil
+}
+
+func csvDevice(record []string) (*pb.Device, int64, error) {
+	p := csvParser{record: record}
+	ts := p.int(0)
+	dev := &pb.Device{
+		Id:              record[1],
+		UserId:          record[2],
+		Model:           record[3],
+		Color:           record[4],
+		Description:     record[5],
+		Tick:            p.float(6),
+		Duration:        p.float(7),
+		Speed:           p.float(8),
+		IsOffline:       p.bool(13),
+		OfflineDuration: p.int(14),
+		Location: &pb.Device_Location{
+			Lat:       p.float(9),
+			Lon:       p.float(10),
+			Elevation: p.float(11),
+			Bearing:   p.float(12),
+		},
+		Battery: &pb.Device_Battery{
+			Charge:     p.float(15),
+			ChargeTime: p.int(16),
+		},
+		Distance: &pb.Device_Distance{
+			Distance:               p.float(17),
+			CurrentDistance:        p.float(18),
+			RouteDistance:          p.float(19),
+			CurrentRouteDistance:   p.float(20),
+			TrackDistance:          p.float(21),
+			CurrentTrackDistance:   p.float(22),
+			SegmentDistance:        p.float(23),
+			CurrentSegmentDistance: p.float(24),
+		},
+		Navigator: &pb.Device_Navigator{
+			CurrentRouteIndex:   p.int(25),
+			CurrentTrackIndex:   p.int(26),
+			CurrentSegmentIndex: p.int(27),
+			CurrentRouteId:      record[28],
+			CurrentTrackId:      record[29],
+		},
+		TimeEstimate: p.float(30),
+	}
+	if p.err != nil {
+		return nil, 0, p.err
+	}
+
+	var sensors []csvSensor
+	if err := json.Unmarshal([]byte(record[31]), &sensors); err != nil {
+		return nil, 0, fmt.Errorf("gpsgen: invalid csv column %s: %w", csvColumns[31], err)
+	}
+	for i := 0; i < len(sensors); i++ {
+		dev.Sensors = append(dev.Sensors, &pb.Device_Sensor{
+			Id:   sensors[i].ID,
+			Name: sensors[i].Name,
+			ValX: sensors[i].X,
+			ValY: sensors[i].Y,
+		})
+	}
+	return dev, ts, nil
+}
+
+type csvParser struct {
+	record []string
+	err    error
+}
+
+func (p *csvParser) float(i int) float64 {
+	v, err := strconv.ParseFloat(p.record[i], 64)
+	p.check(i, err)
+	return v
+}
+
+func (p *csvParser) int(i int) int64 {
+	v, err := strconv.ParseInt(p.record[i], 10, 64)
+	p.check(i, err)
+	return v
+}
+
+func (p *csvParser) bool(i int) bool {
+	v, err := strconv.ParseBool(p.record[i])
+	p.check(i, err)
+	return v
+}
+
+func (p *csvParser) check(i int, err error) {
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("gpsgen: invalid csv column %s: %w", csvColumns[i], err)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -1,7 +1,12 @@
 package gpsgen
 
 import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mmadfox/go-gpsgen/navigator"
 	pb "github.com/mmadfox/go-gpsgen/proto"
@@ -46,3 +51,159 @@ func TestPacketFromBytesWithInvalidData(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, packet)
 }
+
+func testPacket(t *testing.T) *pb.Packet {
+	pck := &pb.Packet{Timestamp: 1690000000}
+	for i := 0; i < 3; i++ {
+		dev, err := NewDevice(nil)
+		require.NoError(t, err)
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		dev.AddSensor(makeSensor(t, "s1"), makeSensor(t, "s,2"))
+		require.True(t, dev.Next(1))
+		pck.Devices = append(pck.Devices, dev.State())
+	}
+	return pck
+}
+
+func TestEncoders(t *testing.T) {
+	pck := testPacket(t)
+	testCases := []struct {
+		name string
+		enc  Encoder
+		dec  Decoder
+	}{
+		{name: "proto", enc: ProtoEncoder{}, dec: ProtoDecoder{}},
+		{name: "json", enc: JSONEncoder{}, dec: JSONDecoder{}},
+		{name: "ndjson", enc: NDJSONEncoder{}, dec: NDJSONDecoder{}},
+		{name: "delta", enc: NewDeltaEncoder(0), dec: NewReassembler()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.enc.Encode(nil, pck)
+			require.NoError(t, err)
+			got, err := tc.dec.Decode(data)
+			require.NoError(t, err)
+			require.True(t, proto.Equal(pck, got))
+		})
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	pck := testPacket(t)
+	data, err := NDJSONEncoder{}.Encode(nil, pck)
+	require.NoError(t, err)
+	require.Len(t, bytes.Split(bytes.TrimSpace(data), []byte("\n")), len(pck.Devices))
+}
+
+func TestCSVEncoder(t *testing.T) {
+	pck := testPacket(t)
+	enc := NewCSVEncoder(true)
+	data, err := enc.EncodeHeader(nil)
+	require.NoError(t, err)
+	data, err = enc.Encode(data, pck)
+	require.NoError(t, err)
+	data, err = enc.Encode(data, pck)
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 1+2*len(pck.Devices))
+	require.Equal(t, strings.Join(CSVColumns(), ","), string(lines[0]))
+
+	got, err := CSVDecoder{}.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, pck.Timestamp, got.Timestamp)
+	require.Len(t, got.Devices, 2*len(pck.Devices))
+	for i := 0; i < len(pck.Devices); i++ {
+		want, dev := pck.Devices[i], got.Devices[i]
+		require.Equal(t, want.Id, dev.Id)
+		require.Equal(t, want.Speed, dev.Speed)
+		require.True(t, proto.Equal(want.Battery, dev.Battery))
+		require.True(t, proto.Equal(want.Distance, dev.Distance))
+		require.True(t, proto.Equal(want.Navigator, dev.Navigator))
+		require.Equal(t, want.Location.Lat, dev.Location.Lat)
+		require.Equal(t, want.Location.Lon, dev.Location.Lon)
+		require.Len(t, dev.Sensors, 2)
+		require.True(t, proto.Equal(want.Sensors[1], dev.Sensors[1]))
+	}
+
+	_, err = CSVDecoder{}.Decode([]byte("1,2,3\n"))
+	require.Error(t, err)
+}
+
+func TestGenerator_Encoder(t *testing.T) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	gen := New(&Options{
+		Interval: time.Second,
+		Clock:    clock,
+		Encoder:  NDJSONEncoder{},
+	})
+	require.NoError(t, gen.Attach(NewTracker()))
+
+	packets := make(chan *pb.Packet, 1)
+	gen.OnPacket(func(b []byte) error {
+		pck, err := NDJSONDecoder{}.Decode(b)
+		require.NoError(t, err)
+		packets <- pck
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+
+	clock.Advance(time.Second)
+	pck := <-packets
+	require.Len(t, pck.Devices, 1)
+	require.Equal(t, clock.Now().Unix(), pck.Timestamp)
+
+	gen.Close()
+	<-done
+}
+
+func TestGenerator_CSVHeader(t *testing.T) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	gen := New(&Options{
+		Interval:   time.Second,
+		NumWorkers: 4,
+		PacketSize: 1024,
+		Clock:      clock,
+		Encoder:    NewCSVEncoder(true),
+	})
+	for i := 0; i < 300; i++ {
+		require.NoError(t, gen.Attach(NewTracker()))
+	}
+
+	var mu sync.Mutex
+	var chunks []string
+	gen.OnPacket(func(b []byte) error {
+		mu.Lock()
+		chunks = append(chunks, string(b))
+		mu.Unlock()
+		return nil
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+
+	header := strings.Join(CSVColumns(), ",") + "\n"
+	require.Greater(t, len(chunks), 2)
+	require.Equal(t, header, chunks[0])
+	for i := 1; i < len(chunks); i++ {
+		require.NotContains(t, chunks[i], header)
+	}
+}
@@ -0,0 +1,162 @@
+package gpsgen
+
+import "time"
+
+// EventKind represents the kind of a device event.
+type EventKind int
+
+// Device lifecycle and navigation events.
+const (
+	// EventDeviceAttached is emitted when a device is attached to the generator.
+	EventDeviceAttached EventKind = iota + 1
+
+	// EventDeviceDetached is emitted when a device is detached from the generator.
+	EventDeviceDetached
+
+	// EventRouteChanged is emitted when a device moves to another route.
+	EventRouteChanged
+
+	// EventTrackChanged is emitted when a device moves to another track of the same route.
+	EventTrackChanged
+
+	// EventSegmentChanged is emitted when a device moves to another segment of the same track.
+	EventSegmentChanged
+
+	// EventRouteFinished is emitted when a device has passed all its routes
+	// and starts over from the first one.
+	EventRouteFinished
+
+	// EventOffline is emitted when a device goes offline.
+	// Event.Duration holds the expected time the device stays offline.
+	EventOffline
+
+	// EventOnline is emitted when a device comes back online.
+	// Event.Duration holds the time the device was offline.
+	EventOnline
+
+	// EventBatteryReset is emitted when a discharged battery is reset.
+	EventBatteryReset
+)
+
+// String returns the name of the event kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventDeviceAttached:
+		return "device-attached"
+	case EventDeviceDetached:
+		return "device-detached"
+	case EventRouteChanged:
+		return "route-changed"
+	case EventTrackChanged:
+		return "track-changed"
+	case EventSegmentChanged:
+		return "segment-changed"
+	case EventRouteFinished:
+		return "route-finished"
+	case EventOffline:
+		return "offline"
+	case EventOnline:
+		return "online"
+	case EventBatteryReset:
+		return "battery-reset"
+	default:
+		return "unknown"
+	}
+}
+
+// Event represents a change in the lifecycle or the navigation state of a device.
+type Event struct {
+	Kind         EventKind
+	DeviceID     string
+	Time         time.Time
+	RouteIndex   int
+	TrackIndex   int
+	SegmentIndex int
+	Duration     time.Duration
+}
+
+// changes is a set of changes detected during a single device step.
+type changes uint8
+
+const (
+	changeRoute changes = 1 << iota
+	changeTrack
+	changeSegment
+	changeFinished
+	changeOffline
+	changeOnline
+	changeBatteryReset
+)
+
+// step is the result of a single device step.
+type step struct {
+	ok           bool
+	skipped      bool
+	changes      changes
+	routeIndex   int
+	trackIndex   int
+	segmentIndex int
+	duration     time.Duration
+}
+
+// OnEvent sets a callback function to handle device events.
+// The callback is called synchronously from the generator loop and from
+// Attach and Detach, so it must be fast and safe for concurrent use.
+// A slow consumer should hand events over to a buffered channel.
+func (g *Generator) OnEvent(fn func(Event)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onEvent = fn
+}
+
+func (g *Generator) emitLifecycle(kind EventKind, d *Device) {
+	if g.onEvent == nil {
+		return
+	}
+	g.onEvent(Event{
+		Kind:         kind,
+		DeviceID:     d.ID(),
+		Time:         g.clock.Now(),
+		RouteIndex:   d.RouteIndex(),
+		TrackIndex:   d.TrackIndex(),
+		SegmentIndex: d.SegmentIndex(),
+	})
+}
+
+func (g *Generator) emitStep(d *Device, t time.Time, st step) {
+	if g.onEvent == nil || st.changes == 0 {
+		return
+	}
+	event := Event{
+		DeviceID:     d.ID(),
+		Time:         t,
+		RouteIndex:   st.routeIndex,
+		TrackIndex:   st.trackIndex,
+		SegmentIndex: st.segmentIndex,
+	}
+	emit := func(kind EventKind, duration time.Duration) {
+		event.Kind = kind
+		event.Duration = duration
+		g.onEvent(event)
+	}
+	if st.changes&changeBatteryReset != 0 {
+		emit(EventBatteryReset, 0)
+	}
+	switch {
+	case st.changes&changeRoute != 0:
+		emit(EventRouteChanged, 0)
+	case st.changes&changeTrack != 0:
+		emit(EventTrackChanged, 0)
+	case st.changes&changeSegment != 0:
+		emit(EventSegmentChanged, 0)
+	}
+	if st.changes&changeFinished != 0 {
+		emit(EventRouteFinished, 0)
+	}
+	if st.changes&changeOffline != 0 {
+		emit(EventOffline, st.duration)
+	}
+	if st.changes&changeOnline != 0 {
+		emit(EventOnline, st.duration)
+	}
+}
@@ -0,0 +1,102 @@
+package gpsgen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mmadfox/go-gpsgen/navigator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventKind_String(t *testing.T) {
+	require.Equal(t, "device-attached", EventDeviceAttached.String())
+	require.Equal(t, "route-finished", EventRouteFinished.String())
+	require.Equal(t, "battery-reset", EventBatteryReset.String())
+	require.Equal(t, "unknown", EventKind(0).String())
+}
+
+func TestGenerator_OnEvent(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval: time.Second,
+		Clock:    clock,
+	})
+
+	events := make(chan Event, 1024)
+	gen.OnEvent(func(e Event) {
+		events <- e
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	opts := NewDeviceOptions()
+	opts.Speed.Min = 100
+	opts.Speed.Max = 100
+	opts.Navigator.Offline.Min = 2
+	opts.Navigator.Offline.Max = 2
+	dev, err := NewDevice(opts)
+	require.NoError(t, err)
+	require.NoError(t, dev.AddRoute(
+		navigator.RouteFromTracks(track1km2segment, track300m1segment),
+		navigator.RouteFromTracks(track300m1segment),
+	))
+	require.NoError(t, gen.Attach(dev))
+
+	attached := <-events
+	require.Equal(t, EventDeviceAttached, attached.Kind)
+	require.Equal(t, dev.ID(), attached.DeviceID)
+	require.Equal(t, start, attached.Time)
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+
+	seen := make(map[EventKind]Event)
+	for i := 0; i < 100; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	collect:
+		for {
+			select {
+			case e := <-events:
+				require.Equal(t, dev.ID(), e.DeviceID)
+				require.Equal(t, clock.Now(), e.Time)
+				if _, ok := seen[e.Kind]; !ok {
+					seen[e.Kind] = e
+				}
+			default:
+				break collect
+			}
+		}
+		if _, ok := seen[EventRouteFinished]; ok {
+			break
+		}
+	}
+
+	require.Contains(t, seen, EventSegmentChanged)
+	require.Equal(t, 1, seen[EventSegmentChanged].SegmentIndex)
+	require.Contains(t, seen, EventTrackChanged)
+	require.Equal(t, 1, seen[EventTrackChanged].TrackIndex)
+	require.Contains(t, seen, EventRouteChanged)
+	require.Equal(t, 1, seen[EventRouteChanged].RouteIndex)
+	require.Contains(t, seen, EventRouteFinished)
+	require.Equal(t, 0, seen[EventRouteFinished].RouteIndex)
+	require.Contains(t, seen, EventOffline)
+	require.Equal(t, 2*time.Second, seen[EventOffline].Duration)
+	require.Contains(t, seen, EventOnline)
+	require.Equal(t, 2*time.Second, seen[EventOnline].Duration)
+
+	gen.Close()
+	<-done
+
+	require.NoError(t, gen.Detach(dev.ID()))
+	detached := <-events
+	require.Equal(t, EventDeviceDetached, detached.Kind)
+	require.Equal(t, dev.ID(), detached.DeviceID)
+}
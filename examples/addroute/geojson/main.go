@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -12,7 +13,7 @@ import (
 func main() {
 	gen := gpsgen.New(nil)
 
-	gen.OnPacket(func(data []byte) {
+	gen.OnPacket(func(data []byte) error {
 		pck, err := gpsgen.PacketFromBytes(data)
 		if err != nil {
 			panic(err)
@@ -22,6 +23,7 @@ func main() {
 			tracker.Model,
 			tracker.Location.Lon,
 			tracker.Location.Lat)
+		return nil
 	})
 
 	droneTracker := gpsgen.NewDroneTracker()
@@ -38,7 +40,9 @@ func main() {
 	})
 
 	gen.Attach(droneTracker)
-	gen.Run()
+	if err := gen.Run(context.Background()); err != nil {
+		panic(err)
+	}
 }
 
 func terminate(fn func()) {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,7 +14,7 @@ import (
 func main() {
 	gen := gpsgen.New(nil)
 
-	gen.OnPacket(func(data []byte) {
+	gen.OnPacket(func(data []byte) error {
 		pck, err := gpsgen.PacketFromBytes(data)
 		if err != nil {
 			panic(err)
@@ -23,6 +24,7 @@ func main() {
 			sensor := tracker.Sensors[i]
 			fmt.Printf("%s -> %f\n", sensor.Name, sensor.ValY)
 		}
+		return nil
 	})
 
 	droneTracker := gpsgen.NewDroneTracker()
@@ -52,7 +54,9 @@ func main() {
 	})
 
 	gen.Attach(droneTracker)
-	gen.Run()
+	if err := gen.Run(context.Background()); err != nil {
+		panic(err)
+	}
 }
 
 func terminate(fn func()) {
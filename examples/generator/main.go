@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -26,7 +27,7 @@ func main() {
 	gen := gpsgen.New(genOpts)
 
 	// for network transmission
-	gen.OnPacket(func(b []byte) {
+	gen.OnPacket(func(b []byte) error {
 		packet, err := gpsgen.PacketFromBytes(b)
 		if err != nil {
 			panic(err)
@@ -45,10 +46,12 @@ func main() {
 				pck.Location.Lat,
 				pck.Location.Elevation)
 		}
+		return nil
 	})
 
-	gen.OnError(func(err error) {
+	gen.OnError(func(err error) error {
 		fmt.Println("[ERROR]", err)
+		return nil
 	})
 
 	gen.OnNext(func() {
@@ -67,7 +70,9 @@ func main() {
 		gen.Close()
 	})
 
-	gen.Run()
+	if err := gen.Run(context.Background()); err != nil {
+		panic(err)
+	}
 }
 
 func terminate(fn func()) {
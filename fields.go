@@ -0,0 +1,72 @@
+package gpsgen
+
+import pb "github.com/mmadfox/go-gpsgen/proto"
+
+// FieldMask is a set of optional sections of the emitted device state.
+type FieldMask uint8
+
+// Optional sections of the device state.
+const (
+	// FieldRoutes is the Routes tree with the route and track properties.
+	FieldRoutes FieldMask = 1 << iota
+
+	// FieldUnits is the Units section.
+	FieldUnits
+
+	// FieldDMS is the LatDms and LonDms sections of the location.
+	FieldDMS
+
+	// FieldUTM is the Utm section of the location.
+	FieldUTM
+)
+
+// Has reports whether all fields of f are set in m.
+func (m FieldMask) Has(f FieldMask) bool {
+	return m&f == f
+}
+
+// SetOmitFields sets the sections of the device state that are neither
+// computed nor emitted. Omitting sections saves CPU on every step.
+func (d *Device) SetOmitFields(mask FieldMask) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.omit = mask
+	d.applyOmitFields()
+	d.updateState()
+	d.updateRoutes()
+}
+
+// OmitFields returns the sections of the device state that are omitted.
+func (d *Device) OmitFields() FieldMask {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.omit
+}
+
+func (d *Device) applyOmitFields() {
+	if d.omit.Has(FieldRoutes) {
+		d.state.Routes = nil
+	} else if d.state.Routes == nil {
+		d.state.Routes = &pb.Device_Routes{}
+	}
+
+	if d.omit.Has(FieldUnits) {
+		d.state.Units = nil
+	} else if d.state.Units == nil {
+		d.state.Units = newDeviceUnits()
+	}
+
+	if d.omit.Has(FieldDMS) {
+		d.state.Location.LatDms = nil
+		d.state.Location.LonDms = nil
+	} else if d.state.Location.LatDms == nil || d.state.Location.LonDms == nil {
+		d.state.Location.LatDms = &pb.Device_Location_DMS{}
+		d.state.Location.LonDms = &pb.Device_Location_DMS{}
+	}
+
+	if d.omit.Has(FieldUTM) {
+		d.state.Location.Utm = nil
+	} else if d.state.Location.Utm == nil {
+		d.state.Location.Utm = &pb.Device_Location_UTM{}
+	}
+}
@@ -0,0 +1,58 @@
+package gpsgen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDevice_OmitFields(t *testing.T) {
+	opts := NewDeviceOptions()
+	opts.OmitFields = FieldRoutes | FieldUnits | FieldDMS | FieldUTM
+	dev, err := NewDevice(opts)
+	require.NoError(t, err)
+	require.NoError(t, dev.AddRoute(testRoutes()...))
+	require.True(t, dev.Next(1))
+
+	state := dev.State()
+	require.Nil(t, state.Routes)
+	require.Nil(t, state.Units)
+	require.Nil(t, state.Location.LatDms)
+	require.Nil(t, state.Location.LonDms)
+	require.Nil(t, state.Location.Utm)
+	require.NotZero(t, state.Location.Lat)
+	omitted := proto.Size(state)
+
+	dev.SetOmitFields(FieldUTM)
+	require.Equal(t, FieldUTM, dev.OmitFields())
+	state = dev.State()
+	require.NotEmpty(t, state.Routes.Routes)
+	require.NotNil(t, state.Units)
+	require.NotZero(t, state.Location.LatDms.Degrees)
+	require.Nil(t, state.Location.Utm)
+	require.Greater(t, proto.Size(state), omitted)
+}
+
+func TestGenerator_OmitFields(t *testing.T) {
+	gen := New(&Options{OmitFields: FieldRoutes})
+
+	opts := NewDeviceOptions()
+	opts.OmitFields = FieldUTM
+	dev, err := NewDevice(opts)
+	require.NoError(t, err)
+	require.NoError(t, dev.AddRoute(testRoutes()...))
+	require.NoError(t, gen.Attach(dev))
+	require.Equal(t, FieldRoutes|FieldUTM, dev.OmitFields())
+	require.Nil(t, dev.State().Routes)
+
+	var buf bytes.Buffer
+	require.NoError(t, gen.Snapshot(&buf))
+	restored := New(nil)
+	require.NoError(t, restored.Restore(&buf))
+	got, ok := restored.Lookup(dev.ID())
+	require.True(t, ok)
+	require.Equal(t, FieldRoutes|FieldUTM, got.OmitFields())
+	require.Nil(t, got.State().Location.Utm)
+}
@@ -0,0 +1,227 @@
+package gpsgen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// FramingVersion is the current version of the packet stream format.
+const FramingVersion = 1
+
+// DefaultMaxFrameSize is the default maximum frame size accepted by PacketReader.
+const DefaultMaxFrameSize = 64 << 20
+
+var (
+	// ErrInvalidStream is returned by PacketReader when the stream header is malformed.
+	ErrInvalidStream = errors.New("gpsgen: invalid packet stream")
+
+	// ErrFrameChecksum is returned by PacketReader when the checksum of a frame does not match.
+	ErrFrameChecksum = errors.New("gpsgen: frame checksum mismatch")
+
+	// ErrFrameTooLarge is returned by PacketReader when a frame exceeds the maximum frame size.
+	ErrFrameTooLarge = errors.New("gpsgen: frame too large")
+)
+
+// Stream layout:
+//
+//	header: magic "GPSP" | version byte | flags byte
+//	frame:  uvarint payload length | payload | CRC-32C of the payload, little endian (if flagCRC)
+var framingMagic = [4]byte{'G', 'P', 'S', 'P'}
+
+const (
+	framingHeaderSize = len(framingMagic) + 2
+	framingFlagCRC    = 1 << 0
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// PacketWriter writes length-prefixed frames to a stream.
+// The stream header is written before the first frame.
+// PacketWriter is safe for concurrent use, so it can be called
+// directly from the OnPacket callback.
+type PacketWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	crc    bool
+	header bool
+	buf    []byte
+}
+
+// NewPacketWriter creates a new PacketWriter.
+// If crc is true, every frame is followed by the CRC-32C checksum of its payload.
+func NewPacketWriter(w io.Writer, crc bool) *PacketWriter {
+	return &PacketWriter{
+		w:   w,
+		crc: crc,
+	}
+}
+
+// WriteFrame writes data as a single frame. The data is typically
+// a packet encoded by the Generator and passed to the OnPacket callback.
+func (pw *PacketWriter) WriteFrame(data []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	buf := pw.buf[:0]
+	if !pw.header {
+		buf = append(buf, framingMagic[:]...)
+		var flags byte
+		if pw.crc {
+			flags |= framingFlagCRC
+		}
+		buf = append(buf, FramingVersion, flags)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	buf = append(buf, data...)
+	if pw.crc {
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(data, crcTable))
+	}
+	pw.buf = buf
+
+	if _, err := pw.w.Write(buf); err != nil {
+		return err
+	}
+	pw.header = true
+	return nil
+}
+
+// WritePacket encodes the packet as binary protobuf and writes it as a single frame.
+func (pw *PacketWriter) WritePacket(pck *pb.Packet) error {
+	data, err := proto.Marshal(pck)
+	if err != nil {
+		return err
+	}
+	return pw.WriteFrame(data)
+}
+
+// PacketReader reads frames written by PacketWriter.
+// PacketReader is not safe for concurrent use.
+type PacketReader struct {
+	r            *bufio.Reader
+	version      int
+	crc          bool
+	header       bool
+	maxFrameSize int
+	n            int64
+}
+
+// NewPacketReader creates a new PacketReader that accepts frames
+// up to DefaultMaxFrameSize bytes.
+func NewPacketReader(r io.Reader) *PacketReader {
+	return &PacketReader{
+		r:            bufio.NewReader(r),
+		maxFrameSize: DefaultMaxFrameSize,
+	}
+}
+
+// SetMaxFrameSize sets the maximum accepted frame size.
+func (pr *PacketReader) SetMaxFrameSize(size int) {
+	if size > 0 {
+		pr.maxFrameSize = size
+	}
+}
+
+// Version returns the format version of the stream.
+// It is zero until the stream header is read.
+func (pr *PacketReader) Version() int {
+	return pr.version
+}
+
+// ReadFrame reads the payload of the next frame.
+// It returns io.EOF when the stream ends at a frame boundary
+// and io.ErrUnexpectedEOF when the stream is truncated.
+func (pr *PacketReader) ReadFrame() ([]byte, error) {
+	if err := pr.readHeader(); err != nil {
+		return nil, err
+	}
+
+	size, err := binary.ReadUvarint(pr.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(pr.maxFrameSize) {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if pr.crc {
+		var sum [4]byte
+		if _, err := io.ReadFull(pr.r, sum[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if binary.LittleEndian.Uint32(sum[:]) != crc32.Checksum(data, crcTable) {
+			return nil, ErrFrameChecksum
+		}
+		pr.n += int64(len(sum))
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	pr.n += int64(binary.PutUvarint(prefix[:], size)) + int64(size)
+	return data, nil
+}
+
+// ReadPacket reads the next frame and decodes it as a binary protobuf packet.
+func (pr *PacketReader) ReadPacket() (*pb.Packet, error) {
+	data, err := pr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	pck := new(pb.Packet)
+	if err := proto.Unmarshal(data, pck); err != nil {
+		return nil, err
+	}
+	return pck, nil
+}
+
+func (pr *PacketReader) readHeader() error {
+	if pr.header {
+		return nil
+	}
+	var header [framingHeaderSize]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidStream, err)
+	}
+	if [4]byte(header[:4]) != framingMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidStream)
+	}
+	version := int(header[4])
+	if version < 1 || version > FramingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidStream, version)
+	}
+	pr.version = version
+	pr.crc = header[5]&framingFlagCRC != 0
+	pr.header = true
+	pr.n = int64(framingHeaderSize)
+	return nil
+}
+
+// offset returns the stream offset of the next frame.
+func (pr *PacketReader) offset() int64 {
+	return pr.n
+}
+
+// resume continues reading frames from r, which must be positioned
+// at a frame boundary of the stream whose header was already read.
+func (pr *PacketReader) resume(r io.Reader, offset int64) {
+	pr.r.Reset(r)
+	pr.n = offset
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package gpsgen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPacketWriter_PacketReader(t *testing.T) {
+	for _, crc := range []bool{false, true} {
+		var buf bytes.Buffer
+		pw := NewPacketWriter(&buf, crc)
+		packets := []*pb.Packet{testPacket(t), {Timestamp: 2}, testPacket(t)}
+		for i := 0; i < len(packets); i++ {
+			require.NoError(t, pw.WritePacket(packets[i]))
+		}
+		require.NoError(t, pw.WriteFrame(nil))
+
+		pr := NewPacketReader(&buf)
+		require.Equal(t, 0, pr.Version())
+		for i := 0; i < len(packets); i++ {
+			got, err := pr.ReadPacket()
+			require.NoError(t, err)
+			require.True(t, proto.Equal(packets[i], got))
+		}
+		require.Equal(t, FramingVersion, pr.Version())
+		frame, err := pr.ReadFrame()
+		require.NoError(t, err)
+		require.Empty(t, frame)
+		_, err = pr.ReadFrame()
+		require.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestPacketReader_Errors(t *testing.T) {
+	_, err := NewPacketReader(bytes.NewReader(nil)).ReadFrame()
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = NewPacketReader(bytes.NewReader([]byte("NOTGPSP"))).ReadFrame()
+	require.ErrorIs(t, err, ErrInvalidStream)
+
+	_, err = NewPacketReader(bytes.NewReader([]byte{'G', 'P', 'S', 'P', 9, 0})).ReadFrame()
+	require.ErrorIs(t, err, ErrInvalidStream)
+
+	var buf bytes.Buffer
+	pw := NewPacketWriter(&buf, true)
+	require.NoError(t, pw.WriteFrame([]byte("payload")))
+	data := buf.Bytes()
+
+	_, err = NewPacketReader(bytes.NewReader(data[:len(data)-2])).ReadFrame()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-5] ^= 0xff
+	_, err = NewPacketReader(bytes.NewReader(corrupted)).ReadFrame()
+	require.ErrorIs(t, err, ErrFrameChecksum)
+
+	pr := NewPacketReader(bytes.NewReader(data))
+	pr.SetMaxFrameSize(3)
+	_, err = pr.ReadFrame()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+}
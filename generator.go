@@ -2,13 +2,30 @@ package gpsgen
 
 import (
 	"context"
-	"math"
+	"errors"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/mmadfox/go-gpsgen/proto"
-	"google.golang.org/protobuf/proto"
+	"github.com/mmadfox/go-gpsgen/random"
+)
+
+var (
+	// ErrGeneratorRunning is returned by Run when the generator is already running.
+	ErrGeneratorRunning = errors.New("gpsgen: generator is already running")
+
+	// ErrGeneratorStopped is returned by Run when the generator has already run.
+	// A Generator runs once; create a new one to run again.
+	ErrGeneratorStopped = errors.New("gpsgen: generator has already run")
+)
+
+// States of the generator.
+const (
+	stateIdle uint32 = iota
+	stateRunning
+	stateStopped
 )
 
 // Generator represents the GPS data generator.
@@ -18,25 +35,51 @@ type Generator struct {
 	devices    []*Device
 	wg         sync.WaitGroup
 	packet     *pb.Packet
-	cancelFunc context.CancelFunc
-	ctx        context.Context
+	state      uint32
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	abortCtx   context.Context
+	abortFunc  context.CancelFunc
+	sinks      []Sink
+	out        []Sink
+	schedule   *schedule
+	due        []dueDevice
+	doneCh     chan struct{}
+	errMu      sync.Mutex
+	err        error
 	sliceCh    chan slice
 	index      int
-	ticker     *time.Ticker
+	ticker     Ticker
+	clock      Clock
+	now        time.Time
 	waitCh     chan struct{}
 	nextCh     chan struct{}
 	numWorkers int
 	packetSize int
 	workerSize int
 	interval   time.Duration
-	onError    func(error)
-	onPacket   func([]byte)
+	onError    func(error) error
+	onPacket   func([]byte) error
 	onNext     func()
+	onEvent    func(Event)
+
+	backpressure BackpressurePolicy
+	bufferSize   int
+	omit         FieldMask
+	encoder      Encoder
+	queue        chan *delivery
+	dwg          sync.WaitGroup
+	dropped      uint64
+	delayed      uint64
+	stats        stats
+	rnd          *random.Random
 }
 
 // Options defines the configuration options for the Generator.
 type Options struct {
 	// Interval determines the time interval between data generation iterations. Default three seconds.
+	// It is also the default report interval of the attached devices and the resolution
+	// of per-device intervals set with DeviceOptions.Interval or Device.SetInterval.
 	Interval time.Duration
 
 	// PacketSize specifies the size of the data packet generated per iteration. Default 8192.
@@ -44,12 +87,37 @@ type Options struct {
 
 	// NumWorkers sets the number of concurrent workers for data processing. Default 4.
 	NumWorkers int
+
+	// Seed seeds the random source of the generator returned by Generator.Random.
+	// Devices and routes drawn from that source are reproducible between runs.
+	// Attached devices created without a source of their own draw from it as well.
+	// Zero seeds the source with the current time.
+	Seed int64
+
+	// Clock is the time source of the generator. Default RealClock.
+	// Use NewManualClock or ScaledClock to run faster than real time.
+	Clock Clock
+
+	// Backpressure defines how slow packet consumers affect the generation. Default BackpressureBlock.
+	Backpressure BackpressurePolicy
+
+	// BufferSize is the capacity of the packet queue for the buffering and dropping
+	// backpressure policies. Default 64.
+	BufferSize int
+
+	// OmitFields is the set of sections of the device state that are neither computed
+	// nor emitted for any attached device, in addition to DeviceOptions.OmitFields.
+	OmitFields FieldMask
+
+	// Encoder encodes the packets passed to the OnPacket callback. Default ProtoEncoder.
+	// The header of a HeaderEncoder is passed to the callback once, before the first packet.
+	Encoder Encoder
 }
 
 // NewOptions creates a new Options instance with default values.
 func NewOptions() *Options {
 	return &Options{
-		Interval:   3*time.Second,
+		Interval:   3 * time.Second,
 		PacketSize: 8192,
 		NumWorkers: 4,
 	}
@@ -65,6 +133,15 @@ func (o *Options) prepare() {
 	if o.NumWorkers <= 0 {
 		o.NumWorkers = runtime.NumCPU()
 	}
+	if o.Clock == nil {
+		o.Clock = RealClock()
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = defaultBufferSize
+	}
+	if o.Encoder == nil {
+		o.Encoder = ProtoEncoder{}
+	}
 }
 
 // New creates a new GPS data generator with the provided options.
@@ -76,21 +153,54 @@ func New(opts *Options) *Generator {
 	opts.prepare()
 
 	gen := Generator{
-		interval:   opts.Interval,
-		packetSize: opts.PacketSize,
-		numWorkers: opts.NumWorkers,
+		clock:   opts.Clock,
+		encoder: opts.Encoder,
+		rnd:     random.NewRandom(),
 	}
-	gen.workerSize = gen.packetSize / gen.numWorkers
-	gen.packet = &pb.Packet{Devices: make([]*pb.Device, gen.packetSize)}
+	if opts.Seed != 0 {
+		gen.rnd = random.NewRandomWithSeed(opts.Seed)
+	}
+	gen.configure(opts)
 	gen.devices = make([]*Device, 0, gen.packetSize)
-	gen.sliceCh = make(chan slice, gen.numWorkers)
-	gen.waitCh = make(chan struct{}, gen.numWorkers)
+	gen.schedule = newSchedule()
 	gen.nextCh = make(chan struct{}, 1)
-	gen.ticker = time.NewTicker(gen.interval)
-	gen.ctx, gen.cancelFunc = context.WithCancel(context.Background())
+	gen.now = gen.clock.Now()
+	gen.stopCh = make(chan struct{})
+	gen.abortCtx, gen.abortFunc = context.WithCancel(context.Background())
+	gen.doneCh = make(chan struct{})
 	return &gen
 }
 
+// configure applies the prepared options to a generator that is not running.
+func (g *Generator) configure(opts *Options) {
+	g.interval = opts.Interval
+	g.packetSize = opts.PacketSize
+	g.numWorkers = opts.NumWorkers
+	g.backpressure = opts.Backpressure
+	g.bufferSize = opts.BufferSize
+	g.omit = opts.OmitFields
+	g.workerSize = g.packetSize / g.numWorkers
+	g.stats.workers = make([]workerStats, g.numWorkers)
+	g.packet = &pb.Packet{Devices: make([]*pb.Device, g.packetSize)}
+	g.sliceCh = make(chan slice, g.numWorkers)
+	g.waitCh = make(chan struct{}, g.numWorkers)
+	if g.ticker != nil {
+		g.ticker.Stop()
+	}
+	g.ticker = g.clock.NewTicker(g.interval)
+	g.queue = nil
+	if g.backpressure != BackpressureBlock {
+		g.queue = make(chan *delivery, g.bufferSize)
+	}
+}
+
+// Random returns the random source of the generator seeded with Options.Seed.
+// Pass it to DeviceOptions.Random and RandomRouteWithSource to create
+// devices and routes that are reproducible between runs.
+func (g *Generator) Random() *random.Random {
+	return g.rnd
+}
+
 // HasTracker checks if a tracker with the given deviceID exists in the Generator.
 func (g *Generator) HasTracker(deviceID string) bool {
 	g.mu.Lock()
@@ -101,32 +211,48 @@ func (g *Generator) HasTracker(deviceID string) bool {
 }
 
 // Attach attaches the provided device to the generator.
+// A device created without a random source draws its curves and offline
+// durations from the source of the generator from then on.
 func (g *Generator) Attach(d *Device) error {
 	if d == nil {
 		return nil
 	}
 
 	g.mu.Lock()
-	defer g.mu.Unlock()
-
+	if omit := d.OmitFields(); !omit.Has(g.omit) {
+		d.SetOmitFields(omit | g.omit)
+	}
 	if err := d.mount(); err != nil {
+		g.mu.Unlock()
 		return err
 	}
-
+	d.lendSource(g.rnd)
 	g.devices = append(g.devices, d)
+	g.schedule.add(d, g.clock.Now())
+	g.mu.Unlock()
+
+	g.emitLifecycle(EventDeviceAttached, d)
 	return nil
 }
 
 // Detach detaches a device with the given ID from the generator.
+// If Options.Encoder is a ForgetfulEncoder, the state it keeps for the device is dropped.
 func (g *Generator) Detach(deviceID string) error {
 	if len(deviceID) == 0 {
 		return nil
 	}
 
 	g.mu.Lock()
-	defer g.mu.Unlock()
+	d, err := g.delete(deviceID)
+	g.mu.Unlock()
 
-	return g.delete(deviceID)
+	if d != nil {
+		if enc, ok := g.encoder.(ForgetfulEncoder); ok {
+			enc.Forget(deviceID)
+		}
+		g.emitLifecycle(EventDeviceDetached, d)
+	}
+	return err
 }
 
 // Each iterates over the collection of Device objects managed by the Generator
@@ -162,19 +288,46 @@ func (g *Generator) NumDevices() int {
 }
 
 // OnError sets a callback function to handle errors during data generation.
-func (g *Generator) OnError(fn func(error)) {
+// The callback receives marshalling errors and errors returned by the OnPacket callback.
+// Returning nil continues the generation, returning an error stops the generator
+// and the error is reported by Run. Without a callback the errors are ignored
+// and the generation continues.
+func (g *Generator) OnError(fn func(error) error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.onError = fn
 }
 
 // OnPacket sets a callback function to handle generated data packets.
-func (g *Generator) OnPacket(fn func([]byte)) {
+// Packets are encoded with Options.Encoder, binary protobuf by default.
+// An error returned by the callback is passed to the OnError callback.
+func (g *Generator) OnPacket(fn func([]byte) error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.onPacket = fn
 }
 
+// AddSink adds a sink that receives every generated packet.
+// Several sinks can be added before Run; each packet is written to all of them.
+// Once the generator runs AddSink returns ErrGeneratorRunning or ErrGeneratorStopped.
+// An error returned by a sink is passed to the OnError callback.
+// Sinks are closed when Run returns.
+func (g *Generator) AddSink(sink Sink) error {
+	if sink == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch atomic.LoadUint32(&g.state) {
+	case stateRunning:
+		return ErrGeneratorRunning
+	case stateStopped:
+		return ErrGeneratorStopped
+	}
+	g.sinks = append(g.sinks, sink)
+	return nil
+}
+
 // OnNext sets a callback function to be executed at each "next step" of data generation.
 func (g *Generator) OnNext(fn func()) {
 	g.mu.Lock()
@@ -182,78 +335,150 @@ func (g *Generator) OnNext(fn func()) {
 	g.onNext = fn
 }
 
-// Close stops the data generation process and closes the generator.
+// Close stops the data generation process without waiting for it.
+// The tick in progress is completed and its packets are delivered before Run returns.
 func (g *Generator) Close() {
-	g.cancelFunc()
+	g.stop()
+}
+
+// Shutdown gracefully stops the data generation process and waits until Run returns.
+// The tick in progress is completed and its packets are delivered.
+// If ctx ends before that, the queued packets and the remaining slices of the tick
+// are abandoned and the context error is returned. Run still waits for the packets
+// being encoded or delivered at that moment before it closes the sinks.
+func (g *Generator) Shutdown(ctx context.Context) error {
+	g.stop()
+	if atomic.LoadUint32(&g.state) == stateIdle {
+		return nil
+	}
+	select {
+	case <-g.doneCh:
+		return nil
+	case <-ctx.Done():
+		g.abort()
+		return ctx.Err()
+	}
 }
 
 // Run starts the data generation process using configured settings and attached devices.
-func (g *Generator) Run() {
+// It blocks until ctx ends, Close or Shutdown is called, or a fatal error occurs.
+// The tick in progress is always completed before Run returns.
+// Run returns nil on a graceful stop and the fatal error otherwise.
+// A Generator runs once: Run returns ErrGeneratorStopped when called again.
+func (g *Generator) Run(ctx context.Context) error {
+	if err := g.begin(); err != nil {
+		return err
+	}
+	defer func() {
+		atomic.StoreUint32(&g.state, stateStopped)
+		close(g.doneCh)
+	}()
+
+	// AddSink fails from now on, so the workers read the sinks without the lock
+	g.mu.RLock()
+	g.out = g.sinks
+	g.mu.RUnlock()
+
+	g.deliverHeader()
+
 	g.wg.Add(g.numWorkers)
 	for i := 0; i < g.numWorkers; i++ {
 		go g.doWorker(i + 1)
 	}
 
-	g.wg.Add(1)
-	go g.run()
+	if g.queue != nil {
+		g.dwg.Add(1)
+		go g.doDelivery()
+	}
 
 	g.wg.Add(1)
 	go g.doNext()
 
+	g.run(ctx)
+
+	close(g.sliceCh)
+	close(g.nextCh)
+	// the workers finish the slice in progress even after an abort,
+	// so the queue and the sinks are closed only when they are done
 	g.wg.Wait()
-}
+	if g.queue != nil {
+		close(g.queue)
+		if !g.isAborted() {
+			g.dwg.Wait()
+		}
+	}
 
-func (g *Generator) run() {
-	defer func() {
-		g.wg.Done()
-		g.ticker.Stop()
-	}()
+	if err := g.closeSinks(); err != nil {
+		g.fail(err)
+	}
 
-	lastTime := time.Now()
-	var tick float64
+	return g.error()
+}
+
+func (g *Generator) run(ctx context.Context) {
+	defer g.ticker.Stop()
 
-loop:
 	for {
 		select {
-		case <-g.ctx.Done():
-			break loop
-		case t := <-g.ticker.C:
-			if g.isClosed() {
-				break loop
+		case <-ctx.Done():
+			return
+		case <-g.stopCh:
+			return
+		case t := <-g.ticker.C():
+			if g.isStopped(ctx) {
+				return
 			}
 
-			tick = math.Abs(lastTime.Sub(t).Seconds())
-			if tick < 1 {
-				tick = 1
-			}
+			atomic.AddUint64(&g.stats.ticks, 1)
+			atomic.StoreInt64(&g.stats.tickDuration, int64(t.Sub(g.now)))
+			g.now = t
 
-			g.mu.RLock()
-			for i := 0; i < len(g.devices); i++ {
-				g.devices[i].Next(tick)
+			g.mu.Lock()
+			g.due = g.schedule.due(t, g.interval, g.due[:0])
+			g.mu.Unlock()
+
+			for i := 0; i < len(g.due); i++ {
+				tick := g.due[i].tick
+				if tick < 1 {
+					tick = 1
+				}
+				st := g.due[i].device.next(tick)
+				if st.skipped {
+					atomic.AddUint64(&g.stats.devicesSkipped, 1)
+				} else {
+					atomic.AddUint64(&g.stats.devicesStepped, 1)
+				}
+				g.emitStep(g.due[i].device, t, st)
 			}
 
 			g.index = 0
-			for i := 0; i < len(g.devices); i++ {
+			for i := 0; i < len(g.due); i++ {
 				g.dmu.Lock()
-				g.packet.Devices[g.index] = g.devices[i].State()
+				g.packet.Devices[g.index] = g.due[i].device.State()
 				g.dmu.Unlock()
 
 				if g.index+1 == g.packetSize {
-					g.mu.RUnlock()
 					g.flush()
-					g.mu.RLock()
+					if g.isAborted() {
+						return
+					}
 					g.index = 0
 				} else {
 					g.index++
 				}
 			}
-			g.mu.RUnlock()
 
 			g.flush()
+			// after an abort the workers may still read the packet
+			if g.isAborted() {
+				return
+			}
 			g.resetPacket()
 			g.notifyNextTick()
 
-			lastTime = t
+			if len(g.ticker.C()) > 0 {
+				atomic.AddUint64(&g.delayed, 1)
+			}
 		}
 	}
 }
@@ -263,51 +488,132 @@ type slice struct {
 }
 
 func (g *Generator) doWorker(n int) {
-	defer func() {
-		g.wg.Done()
-		g.waitCh <- struct{}{}
-	}()
-	
+	defer g.wg.Done()
+
 	pck := &pb.Packet{}
-	enc := proto.MarshalOptions{}
+	ws := &g.stats.workers[n-1]
 
-	for {
-		select {
-		case <-g.ctx.Done():
-			return
-		case s := <-g.sliceCh:
-			if g.isClosed() {
-				return
-			}
+	for s := range g.sliceCh {
+		if s.from == 0 && s.to == 0 {
+			g.waitCh <- struct{}{}
+			continue
+		}
 
-			if s.from == 0 && s.to == 0 {
-				g.waitCh <- struct{}{}
-				continue
-			}
+		startTime := time.Now()
+
+		pck.Timestamp = g.now.Unix()
 
-			pck.Timestamp = time.Now().Unix()
+		g.dmu.RLock()
+		pck.Devices = g.packet.Devices[s.from:s.to]
+		g.dmu.RUnlock()
 
+		var data []byte
+		if g.onPacket != nil {
 			buf := make([]byte, 0, g.workerSize)
-			g.dmu.RLock()
-			pck.Devices = g.packet.Devices[s.from:s.to]
-			data, err := enc.MarshalAppend(buf, pck)
-			g.dmu.RUnlock()
-
-			if err != nil && g.onError != nil {
-				g.onError(err)
-			} else if g.onPacket != nil {
-				g.onPacket(data)
+			var err error
+			data, err = g.encoder.Encode(buf, pck)
+			if err != nil {
+				atomic.AddUint64(&g.stats.marshalErrors, 1)
+				g.handleError(err)
 			}
+		}
 
-			if g.isClosed() {
-				return
-			}
+		var out *pb.Packet
+		if len(g.out) > 0 {
+			out = pck
+		}
+		switch {
+		case data == nil && out == nil:
+		case g.queue != nil:
+			g.enqueue(data, out)
+		default:
+			g.deliver(data, out)
+		}
 
-			g.waitCh <- struct{}{}
+		ws.observe(time.Since(startTime))
+		select {
+		case g.waitCh <- struct{}{}:
+		case <-g.abortCtx.Done():
+		}
+	}
+}
+
+// deliverHeader passes the header of a HeaderEncoder to the OnPacket callback
+// before the workers start, so it precedes every packet.
+func (g *Generator) deliverHeader() {
+	h, ok := g.encoder.(HeaderEncoder)
+	if !ok || g.onPacket == nil {
+		return
+	}
+	data, err := h.EncodeHeader(nil)
+	if err != nil {
+		atomic.AddUint64(&g.stats.marshalErrors, 1)
+		g.handleError(err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	if err := g.onPacket(data); err != nil {
+		g.handleError(err)
+	}
+}
+
+func (g *Generator) deliver(data []byte, pck *pb.Packet) {
+	if data != nil || pck != nil {
+		atomic.AddUint64(&g.stats.packets, 1)
+	}
+	if data != nil {
+		atomic.AddUint64(&g.stats.bytes, uint64(len(data)))
+		if err := g.onPacket(data); err != nil {
+			g.handleError(err)
+		}
+	}
+	if pck == nil {
+		return
+	}
+	if len(g.out) == 1 {
+		if err := g.out[0].Write(g.abortCtx, pck); err != nil {
+			g.handleError(err)
+		}
+		return
+	}
+	errs := make([]error, len(g.out))
+	var wg sync.WaitGroup
+	wg.Add(len(g.out))
+	for i := 0; i < len(g.out); i++ {
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = g.out[i].Write(g.abortCtx, pck)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < len(errs); i++ {
+		if errs[i] != nil {
+			g.handleError(errs[i])
 		}
 	}
 }
 
+func (g *Generator) closeSinks() error {
+	var errs []error
+	for i := 0; i < len(g.out); i++ {
+		if err := g.out[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Generator) handleError(err error) {
+	if g.onError == nil {
+		return
+	}
+	if fatal := g.onError(err); fatal != nil {
+		g.fail(fatal)
+	}
+}
+
 func (g *Generator) notifyNextTick() {
 	select {
 	case g.nextCh <- struct{}{}:
@@ -318,62 +624,115 @@ func (g *Generator) notifyNextTick() {
 func (g *Generator) doNext() {
 	defer g.wg.Done()
 
-	for {
-		select {
-		case <-g.ctx.Done():
+	for range g.nextCh {
+		if g.isAborted() {
 			return
-		case <-g.nextCh:
-			if g.isClosed() {
-				return
-			}
-			if g.onNext == nil {
-				continue
-			}
-			g.onNext()
 		}
+		if g.onNext == nil {
+			continue
+		}
+		g.onNext()
 	}
 }
 
 func (g *Generator) flush() {
 	if g.index <= g.numWorkers+g.workerSize {
-		g.sliceCh <- slice{from: 0, to: g.index}
-		if g.isClosed() {
-			return
+		if g.send(slice{from: 0, to: g.index}) {
+			g.wait(1)
 		}
-		<-g.waitCh
 	} else {
 		step := g.index / g.numWorkers
 		rem := g.index % g.numWorkers
 		for i := 0; i < g.numWorkers; i++ {
-			if g.isClosed() {
-				return
-			}
 			var s slice
 			s.from = i * step
 			s.to = i*step + step
 			if i == g.numWorkers-1 {
 				s.to += rem
 			}
-			g.sliceCh <- s
-		}
-		for i := 0; i < g.numWorkers; i++ {
-			if g.isClosed() {
+			if !g.send(s) {
 				return
 			}
-			<-g.waitCh
 		}
+		g.wait(g.numWorkers)
 	}
 }
 
-func (g *Generator) isClosed() bool {
+func (g *Generator) send(s slice) bool {
 	select {
-	case <-g.ctx.Done():
+	case g.sliceCh <- s:
+		return true
+	case <-g.abortCtx.Done():
+		return false
+	}
+}
+
+func (g *Generator) wait(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-g.waitCh:
+		case <-g.abortCtx.Done():
+			return
+		}
+	}
+}
+
+// begin moves an idle generator to the running state.
+func (g *Generator) begin() error {
+	if atomic.CompareAndSwapUint32(&g.state, stateIdle, stateRunning) {
+		return nil
+	}
+	if atomic.LoadUint32(&g.state) == stateStopped {
+		return ErrGeneratorStopped
+	}
+	return ErrGeneratorRunning
+}
+
+func (g *Generator) stop() {
+	g.stopOnce.Do(func() {
+		close(g.stopCh)
+	})
+}
+
+func (g *Generator) abort() {
+	g.abortFunc()
+}
+
+func (g *Generator) isStopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-g.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *Generator) isAborted() bool {
+	select {
+	case <-g.abortCtx.Done():
 		return true
 	default:
 		return false
 	}
 }
 
+func (g *Generator) fail(err error) {
+	g.errMu.Lock()
+	if g.err == nil {
+		g.err = err
+	}
+	g.errMu.Unlock()
+	g.stop()
+}
+
+func (g *Generator) error() error {
+	g.errMu.Lock()
+	defer g.errMu.Unlock()
+	return g.err
+}
+
 func (g *Generator) resetPacket() {
 	g.dmu.Lock()
 	defer g.dmu.Unlock()
@@ -382,15 +741,17 @@ func (g *Generator) resetPacket() {
 	}
 }
 
-func (g *Generator) delete(deviceID string) error {
+func (g *Generator) delete(deviceID string) (*Device, error) {
 	for i := 0; i < len(g.devices); i++ {
 		if g.devices[i].ID() == deviceID {
-			err := g.devices[i].unmount()
+			d := g.devices[i]
+			err := d.unmount()
+			g.schedule.remove(d)
 			g.devices = append(g.devices[:i], g.devices[i+1:]...)
-			return err
+			return d, err
 		}
 	}
-	return nil
+	return nil, nil
 }
 
 func (g *Generator) find(deviceID string) (d *Device, ok bool) {
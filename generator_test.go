@@ -1,11 +1,16 @@
 package gpsgen
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mmadfox/go-gpsgen/geojson"
 	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/types"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
 )
@@ -153,17 +158,19 @@ func TestGenerator_Run(t *testing.T) {
 		atomic.AddUint32(&next, 1)
 	})
 
-	gen.OnPacket(func(pck []byte) {
+	gen.OnPacket(func(pck []byte) error {
 		atomic.AddUint32(&packet, uint32(len(pck)))
 		p := new(pb.Packet)
 		require.NoError(t, proto.Unmarshal(pck, p))
 		require.NotEmpty(t, p.Devices)
+		return nil
 	})
 
-	gen.OnError(func(err error) {
+	gen.OnError(func(err error) error {
 		if err != nil {
 			atomic.AddUint32(&e, 1)
 		}
+		return nil
 	})
 
 	devices := make([]*Device, 0)
@@ -187,7 +194,7 @@ func TestGenerator_Run(t *testing.T) {
 		gen.Close()
 	}()
 
-	gen.Run()
+	require.NoError(t, gen.Run(context.Background()))
 
 	require.NotZero(t, atomic.LoadUint32(&packet))
 	require.NotZero(t, atomic.LoadUint32(&next))
@@ -217,14 +224,328 @@ func TestGenerator_Close(t *testing.T) {
 	gen.OnNext(func() {
 		time.Sleep(50 * time.Millisecond)
 	})
-	gen.OnPacket(func(_ []byte) {
+	gen.OnPacket(func(_ []byte) error {
 		time.Sleep(50 * time.Millisecond)
+		return nil
 	})
 	go func() {
 		<-time.After(50 * time.Millisecond)
 		gen.Close()
 	}()
-	gen.Run()
+	require.NoError(t, gen.Run(context.Background()))
+}
+
+func TestGenerator_RunContext(t *testing.T) {
+	gen := New(&Options{Interval: 10 * time.Millisecond})
+	require.NoError(t, gen.Attach(NewTracker()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, gen.Run(ctx))
+	require.ErrorIs(t, gen.Run(ctx), ErrGeneratorStopped)
+}
+
+func TestGenerator_RunFatalError(t *testing.T) {
+	gen := New(&Options{Interval: 10 * time.Millisecond})
+	dev := NewTracker()
+	require.NoError(t, dev.AddRoute(testRoutes()...))
+	require.NoError(t, gen.Attach(dev))
+
+	// without OnError the errors are not fatal
+	errSink := errors.New("sink is down")
+	var packets uint32
+	gen.OnPacket(func([]byte) error {
+		atomic.AddUint32(&packets, 1)
+		return errSink
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, gen.Run(ctx))
+	require.Greater(t, atomic.LoadUint32(&packets), uint32(1))
+
+	gen = New(&Options{Interval: 10 * time.Millisecond})
+	require.NoError(t, gen.Attach(NewTracker()))
+	var calls uint32
+	gen.OnPacket(func([]byte) error {
+		return errSink
+	})
+	gen.OnError(func(err error) error {
+		if atomic.AddUint32(&calls, 1) == 3 {
+			return err
+		}
+		return nil
+	})
+	require.ErrorIs(t, gen.Run(context.Background()), errSink)
+	require.Equal(t, uint32(3), atomic.LoadUint32(&calls))
+}
+
+func TestGenerator_ShutdownDrain(t *testing.T) {
+	gen := New(&Options{Interval: 10 * time.Millisecond})
+	require.NoError(t, gen.Attach(NewTracker()))
+
+	started := make(chan struct{})
+	var delivered uint32
+	var once sync.Once
+	gen.OnPacket(func([]byte) error {
+		once.Do(func() { close(started) })
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddUint32(&delivered, 1)
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- gen.Run(context.Background())
+	}()
+
+	<-started
+	require.NoError(t, gen.Shutdown(context.Background()))
+	require.NoError(t, <-done)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&delivered))
+}
+
+func TestGenerator_ShutdownDeadline(t *testing.T) {
+	gen := New(&Options{Interval: 10 * time.Millisecond})
+	require.NoError(t, gen.Attach(NewTracker()))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	gen.OnPacket(func([]byte) error {
+		once.Do(func() { close(started) })
+		<-release
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- gen.Run(context.Background())
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, gen.Shutdown(ctx), context.DeadlineExceeded)
+	// Run waits for the callback in progress
+	select {
+	case <-done:
+		t.Fatal("Run returned before the callback")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestGenerator_Seed(t *testing.T) {
+	makeDevice := func() *pb.Device {
+		gen := New(&Options{Seed: 123})
+		opts := NewDeviceOptions()
+		opts.Random = gen.Random()
+		dev, err := NewDevice(opts)
+		require.NoError(t, err)
+		// draws from the shared source must not affect the generator source
+		RandomRouteForParis()
+		require.NoError(t, dev.AddRoute(RandomRouteWithSource(gen.Random(), 2.3499, 48.8553, 3, RouteLevelL)))
+		for i := 0; i < 10; i++ {
+			dev.Next(1)
+		}
+		return dev.State()
+	}
+	require.True(t, proto.Equal(makeDevice(), makeDevice()))
+}
+
+const seedRoute = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},
+"geometry":{"type":"LineString","coordinates":[[2.3499,48.8553],[2.3511,48.8562],[2.3530,48.8571],[2.3548,48.8566]]}}]}`
+
+func runSeeded(t *testing.T, seed int64) ([]byte, *Generator, *Device) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	gen := New(&Options{
+		Interval:   time.Second,
+		NumWorkers: 1,
+		Seed:       seed,
+		Clock:      clock,
+	})
+	rnd := gen.Random()
+
+	opts := NewDeviceOptions()
+	opts.Seed = 7
+	seeded, err := NewDevice(opts)
+	require.NoError(t, err)
+	require.NoError(t, seeded.AddRoute(RandomRouteWithSource(rnd, 2.3499, 48.8553, 2, RouteLevelS)))
+	sensor, err := NewSensorWithSource(rnd, "temperature", -10, 30, 8, types.WithSensorRandomMode)
+	require.NoError(t, err)
+	seeded.AddSensor(sensor)
+
+	opts = NewDeviceOptions()
+	opts.Random = rnd
+	sourced, err := NewDevice(opts)
+	require.NoError(t, err)
+	routes, err := geojson.DecodeWithSource(rnd, []byte(seedRoute))
+	require.NoError(t, err)
+	require.NoError(t, sourced.AddRoute(routes...))
+
+	// constant curves draw nothing that shows up in the state before Attach
+	opts = NewDeviceOptions()
+	opts.ID = "lent"
+	opts.Model = types.RandomModelWithSource(rnd).String()
+	opts.Color = "#ff0000"
+	opts.Speed.Min, opts.Speed.Max = 3, 3
+	opts.Navigator.Elevation.Min, opts.Navigator.Elevation.Max = 10, 10
+	lent, err := NewDevice(opts)
+	require.NoError(t, err)
+	require.NoError(t, lent.AddRoute(RandomRouteWithSource(rnd, 2.3499, 48.8553, 1, RouteLevelS)))
+
+	for _, dev := range []*Device{seeded, sourced, lent} {
+		require.NoError(t, gen.Attach(dev))
+	}
+
+	var data []byte
+	gen.OnPacket(func(b []byte) error {
+		data = append(data, b...)
+		return nil
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+	for i := 0; i < 20; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+	return data, gen, lent
+}
+
+func TestGenerator_SeedPackets(t *testing.T) {
+	data1, gen, lent := runSeeded(t, 42)
+	data2, _, _ := runSeeded(t, 42)
+	require.NotEmpty(t, data1)
+	require.Equal(t, data1, data2)
+
+	// a device without a source draws from the generator once attached
+	require.Same(t, gen.Random(), lent.rnd)
+	require.Same(t, gen.Random(), lent.speed.Source())
+}
+
+func TestGenerator_ManualClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval: 5 * time.Second,
+		Clock:    clock,
+	})
+
+	dev, err := NewDevice(nil)
+	require.NoError(t, err)
+	require.NoError(t, dev.AddRoute(testRoutes()...))
+	require.NoError(t, gen.Attach(dev))
+
+	nextCh := make(chan struct{}, 1)
+	timestamps := make(chan int64, 16)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+	gen.OnPacket(func(b []byte) error {
+		pck, err := PacketFromBytes(b)
+		require.NoError(t, err)
+		timestamps <- pck.Timestamp
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(5 * time.Second)
+		<-nextCh
+		require.Equal(t, start.Add(time.Duration(i)*5*time.Second).Unix(), <-timestamps)
+	}
+	require.Equal(t, float64(15), dev.Duration())
+
+	gen.Close()
+	<-done
+}
+
+func TestGenerator_DeviceInterval(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval: time.Second,
+		Clock:    clock,
+	})
+
+	opts := NewDeviceOptions()
+	opts.Interval = 5 * time.Second
+	slow, err := NewDevice(opts)
+	require.NoError(t, err)
+	fast, err := NewDevice(nil)
+	require.NoError(t, err)
+	tag, err := NewDevice(nil)
+	require.NoError(t, err)
+	tag.SetInterval(3 * time.Second)
+	require.Equal(t, 3*time.Second, tag.Interval())
+
+	for _, dev := range []*Device{slow, fast, tag} {
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		require.NoError(t, gen.Attach(dev))
+	}
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+	gen.OnPacket(func(b []byte) error {
+		pck, err := PacketFromBytes(b)
+		require.NoError(t, err)
+		mu.Lock()
+		for _, dev := range pck.Devices {
+			counts[dev.Id]++
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+
+	require.Equal(t, 10, counts[fast.ID()])
+	require.Equal(t, 2, counts[slow.ID()])
+	require.Equal(t, 4, counts[tag.ID()])
+	require.Equal(t, float64(10), fast.Duration())
+	require.Equal(t, float64(6), slow.Duration())
+	require.Equal(t, float64(10), tag.Duration())
+}
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := ScaledClock(start, 60)
+	ticker := clock.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	now := <-ticker.C()
+	require.True(t, now.Sub(start) >= time.Minute)
+	require.True(t, clock.Now().After(start))
 }
 
 func TestGenerator_Each(t *testing.T) {
@@ -8,6 +8,7 @@ import (
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/navigator"
 	"github.com/mmadfox/go-gpsgen/properties"
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 )
@@ -28,6 +29,12 @@ func Encode(routes []*navigator.Route) ([]byte, error) {
 
 // Decode converts GeoJSON data into a slice of navigator.Routes.
 func Decode(data []byte) ([]*navigator.Route, error) {
+	return DecodeWithSource(nil, data)
+}
+
+// DecodeWithSource is like Decode but draws the IDs and colors of new routes
+// and tracks from src. A nil src uses the shared source.
+func DecodeWithSource(src *random.Random, data []byte) ([]*navigator.Route, error) {
 	fc := geojson.NewFeatureCollection()
 	if err := json.Unmarshal(data, &fc); err != nil {
 		return nil, err
@@ -51,12 +58,12 @@ func Decode(data []byte) ([]*navigator.Route, error) {
 			}
 			resetProps(feature.Properties)
 		} else {
-			route = navigator.NewRoute()
+			route = navigator.NewRouteWithSource(src)
 		}
 
 		parseProperties(route, feature.Properties)
 
-		if err := parseGeometries(route, tracksInfo, feature.Geometry); err != nil {
+		if err := parseGeometries(src, route, tracksInfo, feature.Geometry); err != nil {
 			return nil, err
 		}
 
@@ -126,13 +133,13 @@ func parseProperties(route *navigator.Route, props map[string]interface{}) {
 	route.Props().Merge(props)
 }
 
-func parseGeometries(route *navigator.Route, tracks []trackInfo, geom orb.Geometry) error {
+func parseGeometries(src *random.Random, route *navigator.Route, tracks []trackInfo, geom orb.Geometry) error {
 	collection, ok := geom.(orb.Collection)
 	if !ok {
 		if tracks != nil && len(tracks) != 1 {
 			return ErrInvalidRoute
 		}
-		return parseGeometry(route, tracks, geom)
+		return parseGeometry(src, route, tracks, geom)
 	}
 
 	if tracks != nil && len(tracks) != len(collection) {
@@ -140,21 +147,21 @@ func parseGeometries(route *navigator.Route, tracks []trackInfo, geom orb.Geomet
 	}
 
 	for i := 0; i < len(collection); i++ {
-		if err := parseGeometry(route, tracks, collection[i]); err != nil {
+		if err := parseGeometry(src, route, tracks, collection[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func parseGeometry(route *navigator.Route, tracks []trackInfo, geometry orb.Geometry) (err error) {
+func parseGeometry(src *random.Random, route *navigator.Route, tracks []trackInfo, geometry orb.Geometry) (err error) {
 	trackExists := len(tracks) > 0
 	switch geom := geometry.(type) {
 	case orb.LineString:
 		var track *navigator.Track
 		var err error
 		if !trackExists {
-			track, err = navigator.NewTrack(toPoints(geom))
+			track, err = navigator.NewTrackWithSource(src, toPoints(geom))
 		} else {
 			trackInfo := tracks[0]
 			track, err = navigator.RestoreTrack(trackInfo.ID, trackInfo.Color, toPoints(geom))
@@ -169,7 +176,7 @@ func parseGeometry(route *navigator.Route, tracks []trackInfo, geometry orb.Geom
 			return ErrInvalidRoute
 		}
 		for i := 0; i < len(geom); i++ {
-			track, err := navigator.NewTrack(toPoints(geom[i]))
+			track, err := navigator.NewTrackWithSource(src, toPoints(geom[i]))
 			if err != nil {
 				return err
 			}
@@ -182,7 +189,7 @@ func parseGeometry(route *navigator.Route, tracks []trackInfo, geometry orb.Geom
 		var track *navigator.Track
 		var err error
 		if !trackExists {
-			track, err = navigator.NewTrack(toPoints(geom[0]))
+			track, err = navigator.NewTrackWithSource(src, toPoints(geom[0]))
 		} else {
 			trackInfo := tracks[0]
 			track, err = navigator.RestoreTrack(trackInfo.ID, trackInfo.Color, toPoints(geom[0]))
@@ -198,7 +205,7 @@ func parseGeometry(route *navigator.Route, tracks []trackInfo, geometry orb.Geom
 		}
 		for i := 0; i < len(geom); i++ {
 			if len(geom[i]) > 0 {
-				track, err := navigator.NewTrack(toPoints(geom[i][0]))
+				track, err := navigator.NewTrackWithSource(src, toPoints(geom[i][0]))
 				if err != nil {
 					return err
 				}
@@ -209,7 +216,7 @@ func parseGeometry(route *navigator.Route, tracks []trackInfo, geometry orb.Geom
 		if trackExists {
 			return ErrInvalidRoute
 		}
-		track, err := navigator.NewTrack(toPoints(geom))
+		track, err := navigator.NewTrackWithSource(src, toPoints(geom))
 		if err != nil {
 			return err
 		}
@@ -9,7 +9,6 @@ require (
 	github.com/paulmach/orb v0.10.0
 	github.com/stretchr/testify v1.8.2
 	github.com/tkrajina/gpxgo v1.3.0
-	github.com/valyala/fastrand v1.1.0
 	google.golang.org/protobuf v1.30.0
 )
 
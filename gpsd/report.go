@@ -0,0 +1,177 @@
+package gpsd
+
+import (
+	"time"
+
+	"github.com/mmadfox/go-gpsgen/nmea"
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Protocol revision reported in the VERSION response.
+const (
+	ProtoMajor = 3
+	ProtoMinor = 14
+	Release    = "3.25"
+)
+
+// Fix modes of a TPV report.
+const (
+	ModeNoFix = 1
+	Mode3D    = 3
+)
+
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// Version is the VERSION response.
+type Version struct {
+	Class      string `json:"class"`
+	Release    string `json:"release"`
+	Rev        string `json:"rev"`
+	ProtoMajor int    `json:"proto_major"`
+	ProtoMinor int    `json:"proto_minor"`
+}
+
+// DeviceInfo is the DEVICE report. Activated is empty for a device that went away.
+type DeviceInfo struct {
+	Class     string  `json:"class"`
+	Path      string  `json:"path"`
+	Driver    string  `json:"driver,omitempty"`
+	Activated string  `json:"activated,omitempty"`
+	Flags     int     `json:"flags,omitempty"`
+	Native    int     `json:"native"`
+	Cycle     float64 `json:"cycle,omitempty"`
+}
+
+// Devices is the DEVICES response.
+type Devices struct {
+	Class   string       `json:"class"`
+	Devices []DeviceInfo `json:"devices"`
+}
+
+// Watch is the watch policy of a client, sent as the ?WATCH argument and the WATCH response.
+type Watch struct {
+	Class  string `json:"class"`
+	Enable bool   `json:"enable"`
+	JSON   bool   `json:"json"`
+	NMEA   bool   `json:"nmea"`
+	Raw    int    `json:"raw"`
+	Scaled bool   `json:"scaled"`
+	Timing bool   `json:"timing"`
+	Split  bool   `json:"split24"`
+	PPS    bool   `json:"pps"`
+	Device string `json:"device,omitempty"`
+}
+
+// TPV is the time-position-velocity report.
+type TPV struct {
+	Class  string   `json:"class"`
+	Device string   `json:"device"`
+	Mode   int      `json:"mode"`
+	Time   string   `json:"time,omitempty"`
+	Ept    float64  `json:"ept,omitempty"`
+	Lat    *float64 `json:"lat,omitempty"`
+	Lon    *float64 `json:"lon,omitempty"`
+	Alt    *float64 `json:"alt,omitempty"`
+	AltHAE *float64 `json:"altHAE,omitempty"`
+	AltMSL *float64 `json:"altMSL,omitempty"`
+	Track  *float64 `json:"track,omitempty"`
+	Speed  *float64 `json:"speed,omitempty"`
+}
+
+// Satellite is a satellite of the SKY report.
+type Satellite struct {
+	PRN  int     `json:"PRN"`
+	El   float64 `json:"el"`
+	Az   float64 `json:"az"`
+	SS   float64 `json:"ss"`
+	Used bool    `json:"used"`
+}
+
+// Sky is the SKY report.
+type Sky struct {
+	Class      string      `json:"class"`
+	Device     string      `json:"device"`
+	Time       string      `json:"time,omitempty"`
+	HDOP       float64     `json:"hdop,omitempty"`
+	VDOP       float64     `json:"vdop,omitempty"`
+	PDOP       float64     `json:"pdop,omitempty"`
+	NSat       int         `json:"nSat"`
+	USat       int         `json:"uSat"`
+	Satellites []Satellite `json:"satellites"`
+}
+
+// Poll is the ?POLL response.
+type Poll struct {
+	Class  string `json:"class"`
+	Time   string `json:"time"`
+	Active int    `json:"active"`
+	TPV    []TPV  `json:"tpv"`
+	Sky    []Sky  `json:"sky"`
+}
+
+// Error is the ERROR response to a bad request.
+type Error struct {
+	Class   string `json:"class"`
+	Message string `json:"message"`
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func isValid(dev *pb.Device) bool {
+	return !dev.IsOffline && dev.Location != nil
+}
+
+// newTPV converts the device state into a TPV report.
+// A device in offline mode is reported without a fix.
+func newTPV(path string, t time.Time, dev *pb.Device) TPV {
+	tpv := TPV{
+		Class:  "TPV",
+		Device: path,
+		Mode:   ModeNoFix,
+		Time:   formatTime(t),
+	}
+	if !isValid(dev) {
+		return tpv
+	}
+	loc := dev.Location
+	lat, lon, alt := loc.Lat, loc.Lon, loc.Elevation
+	track, speed := loc.Bearing, dev.Speed
+	tpv.Mode = Mode3D
+	tpv.Ept = 0.005
+	tpv.Lat, tpv.Lon = &lat, &lon
+	tpv.Alt, tpv.AltHAE, tpv.AltMSL = &alt, &alt, &alt
+	tpv.Track, tpv.Speed = &track, &speed
+	return tpv
+}
+
+// newSky returns the SKY report with the synthetic constellation used by the nmea package.
+func newSky(path string, t time.Time, dev *pb.Device) Sky {
+	valid := isValid(dev)
+	constellation := nmea.Constellation()
+	sky := Sky{
+		Class:      "SKY",
+		Device:     path,
+		Time:       formatTime(t),
+		NSat:       len(constellation),
+		Satellites: make([]Satellite, len(constellation)),
+	}
+	if valid {
+		sky.HDOP, sky.VDOP, sky.PDOP = nmea.HDOP, nmea.VDOP, nmea.PDOP
+		sky.USat = len(constellation)
+	}
+	for i, s := range constellation {
+		sat := Satellite{
+			PRN:  s.PRN,
+			El:   float64(s.Elevation),
+			Az:   float64(s.Azimuth),
+			Used: valid,
+		}
+		if valid {
+			sat.SS = float64(s.SNR)
+		}
+		sky.Satellites[i] = sat
+	}
+	return sky
+}
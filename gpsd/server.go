@@ -0,0 +1,479 @@
+// Package gpsd emulates the JSON protocol of gpsd, so that clients written
+// against libgps can consume the devices of the generator as GPS receivers.
+package gpsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	gpsgen "github.com/mmadfox/go-gpsgen"
+	"github.com/mmadfox/go-gpsgen/nmea"
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+const (
+	// DefaultAddr is the default address of the server, the gpsd port.
+	DefaultAddr = ":2947"
+
+	// DefaultPathPrefix is the default prefix of the device paths.
+	DefaultPathPrefix = "/dev/gpsgen/"
+
+	driverName     = "gpsgen"
+	seenGPS        = 1
+	clientQueue    = 256
+	writeTimeout   = 5 * time.Second
+	maxRequestSize = 4096
+)
+
+// Options defines the options of the server.
+type Options struct {
+	// Addr is the TCP address to listen on. Default DefaultAddr.
+	Addr string
+
+	// PathPrefix is prepended to the device ID to form the gpsd device path.
+	// Default DefaultPathPrefix.
+	PathPrefix string
+
+	// NMEA is the encoder of the NMEA stream for clients watching with "nmea":true.
+	// If nil, nmea.NewEncoder is used.
+	NMEA *nmea.Encoder
+}
+
+// Server is a gpsd-compatible server.
+// Every device becomes a gpsd device at PathPrefix + device ID.
+// Server implements the gpsgen.Sink interface: every packet written
+// to it is reported to the watching clients as TPV and SKY reports.
+type Server struct {
+	mu      sync.Mutex
+	addr    string
+	prefix  string
+	enc     *nmea.Encoder
+	ln      net.Listener
+	devices map[string]*device
+	order   []string
+	clients map[*client]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type device struct {
+	info DeviceInfo
+	tpv  *TPV
+	sky  *Sky
+}
+
+type client struct {
+	conn  net.Conn
+	out   chan []byte
+	done  chan struct{}
+	once  sync.Once
+	watch Watch
+}
+
+// NewServer creates a new Server with the given options.
+func NewServer(opts *Options) *Server {
+	if opts == nil {
+		opts = new(Options)
+	}
+	s := &Server{
+		addr:    opts.Addr,
+		prefix:  opts.PathPrefix,
+		enc:     opts.NMEA,
+		devices: make(map[string]*device),
+		clients: make(map[*client]struct{}),
+	}
+	if len(s.addr) == 0 {
+		s.addr = DefaultAddr
+	}
+	if len(s.prefix) == 0 {
+		s.prefix = DefaultPathPrefix
+	}
+	if s.enc == nil {
+		s.enc = nmea.NewEncoder()
+	}
+	return s
+}
+
+// Path returns the gpsd device path of the device.
+func (s *Server) Path(deviceID string) string {
+	return s.prefix + deviceID
+}
+
+// ListenAndServe listens on the TCP address of the server and serves the clients.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts the clients on the listener until the server is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if !s.accept(conn) {
+			return nil
+		}
+	}
+}
+
+// Attach registers a device before its first fix.
+// Devices are also registered on their first packet.
+func (s *Server) Attach(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device(deviceID)
+}
+
+// Detach removes a device and reports it as deactivated to the watching clients.
+func (s *Server) Detach(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok {
+		return
+	}
+	delete(s.devices, deviceID)
+	for i := 0; i < len(s.order); i++ {
+		if s.order[i] == deviceID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	info := d.info
+	info.Activated = ""
+	s.broadcast(info.Path, func(c *client) { c.send(info) })
+}
+
+// HandleEvent attaches and detaches devices following the generator events.
+// It is intended to be passed to Generator.OnEvent.
+func (s *Server) HandleEvent(e gpsgen.Event) {
+	switch e.Kind {
+	case gpsgen.EventDeviceAttached:
+		s.Attach(e.DeviceID)
+	case gpsgen.EventDeviceDetached:
+		s.Detach(e.DeviceID)
+	}
+}
+
+// Write reports the devices of the packet to the watching clients.
+// The packet timestamp is used as the fix time.
+func (s *Server) Write(ctx context.Context, pck *pb.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return net.ErrClosed
+	}
+
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	for i := 0; i < len(pck.Devices); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		d := s.device(dev.Id)
+		tpv := newTPV(d.info.Path, t, dev)
+		sky := newSky(d.info.Path, t, dev)
+		d.tpv, d.sky = &tpv, &sky
+
+		var sentences []byte
+		s.broadcast(d.info.Path, func(c *client) {
+			if c.watch.JSON {
+				c.send(tpv)
+				c.send(sky)
+			}
+			if c.watch.NMEA {
+				if sentences == nil {
+					sentences, _ = s.enc.Encode(nil, t, dev)
+				}
+				c.write(sentences)
+			}
+		})
+	}
+	return nil
+}
+
+// Close stops the server and disconnects the clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.clients {
+		c.close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// device returns the registered device, registering it if necessary.
+// The watching clients are notified about a new device.
+func (s *Server) device(deviceID string) *device {
+	d, ok := s.devices[deviceID]
+	if ok {
+		return d
+	}
+	d = &device{info: DeviceInfo{
+		Class:     "DEVICE",
+		Path:      s.Path(deviceID),
+		Driver:    driverName,
+		Activated: formatTime(time.Now()),
+		Flags:     seenGPS,
+	}}
+	s.devices[deviceID] = d
+	s.order = append(s.order, deviceID)
+	s.broadcast(d.info.Path, func(c *client) { c.send(d.info) })
+	return d
+}
+
+// broadcast calls fn for every client watching the device path.
+func (s *Server) broadcast(path string, fn func(c *client)) {
+	for c := range s.clients {
+		if !c.watch.Enable {
+			continue
+		}
+		if len(c.watch.Device) > 0 && c.watch.Device != path {
+			continue
+		}
+		fn(c)
+	}
+}
+
+func (s *Server) accept(conn net.Conn) bool {
+	c := &client{
+		conn: conn,
+		out:  make(chan []byte, clientQueue),
+		done: make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return false
+	}
+	s.clients[c] = struct{}{}
+	c.send(Version{
+		Class:      "VERSION",
+		Release:    Release,
+		Rev:        driverName,
+		ProtoMajor: ProtoMajor,
+		ProtoMinor: ProtoMinor,
+	})
+	s.wg.Add(2)
+	s.mu.Unlock()
+
+	go s.writeLoop(c)
+	go s.readLoop(c)
+	return true
+}
+
+func (s *Server) readLoop(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.close()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, maxRequestSize), maxRequestSize)
+	scanner.Split(splitRequests)
+	for scanner.Scan() {
+		req := strings.TrimSpace(scanner.Text())
+		if len(req) == 0 {
+			continue
+		}
+		s.mu.Lock()
+		s.handle(c, req)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) writeLoop(c *client) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.out:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := c.conn.Write(msg); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// handle executes a request of the client. It is called with s.mu held.
+func (s *Server) handle(c *client, req string) {
+	name, arg, _ := strings.Cut(req, "=")
+	switch name {
+	case "?VERSION":
+		c.send(Version{
+			Class:      "VERSION",
+			Release:    Release,
+			Rev:        driverName,
+			ProtoMajor: ProtoMajor,
+			ProtoMinor: ProtoMinor,
+		})
+	case "?DEVICES":
+		c.send(s.listDevices())
+	case "?DEVICE":
+		s.handleDevice(c, arg)
+	case "?WATCH":
+		s.handleWatch(c, arg)
+	case "?POLL":
+		s.handlePoll(c)
+	default:
+		c.send(Error{Class: "ERROR", Message: fmt.Sprintf("Unrecognized request '%s'", name)})
+	}
+}
+
+func (s *Server) handleWatch(c *client, arg string) {
+	if len(arg) > 0 {
+		watch := c.watch
+		if err := json.Unmarshal([]byte(arg), &watch); err != nil {
+			c.send(Error{Class: "ERROR", Message: "Invalid WATCH: " + err.Error()})
+			return
+		}
+		if watch.Enable && !watch.JSON && !watch.NMEA {
+			watch.JSON = true
+		}
+		c.watch = watch
+	}
+	c.send(s.listDevices())
+	watch := c.watch
+	watch.Class = "WATCH"
+	c.send(watch)
+}
+
+func (s *Server) handleDevice(c *client, arg string) {
+	var req DeviceInfo
+	if len(arg) > 0 {
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			c.send(Error{Class: "ERROR", Message: "Invalid DEVICE: " + err.Error()})
+			return
+		}
+	}
+	for i := 0; i < len(s.order); i++ {
+		d := s.devices[s.order[i]]
+		if len(req.Path) == 0 || req.Path == d.info.Path {
+			c.send(d.info)
+			return
+		}
+	}
+	c.send(Error{Class: "ERROR", Message: "Can't open device"})
+}
+
+func (s *Server) handlePoll(c *client) {
+	poll := Poll{
+		Class:  "POLL",
+		Time:   formatTime(time.Now()),
+		Active: len(s.order),
+		TPV:    []TPV{},
+		Sky:    []Sky{},
+	}
+	for i := 0; i < len(s.order); i++ {
+		d := s.devices[s.order[i]]
+		if d.tpv != nil {
+			poll.TPV = append(poll.TPV, *d.tpv)
+		}
+		if d.sky != nil {
+			poll.Sky = append(poll.Sky, *d.sky)
+		}
+	}
+	c.send(poll)
+}
+
+func (s *Server) listDevices() Devices {
+	devices := Devices{
+		Class:   "DEVICES",
+		Devices: make([]DeviceInfo, 0, len(s.order)),
+	}
+	for i := 0; i < len(s.order); i++ {
+		devices.Devices = append(devices.Devices, s.devices[s.order[i]].info)
+	}
+	return devices
+}
+
+// send queues a JSON response to the client.
+func (c *client) send(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.write(append(data, '\r', '\n'))
+}
+
+// write queues raw data to the client. A client that does not keep up is disconnected.
+func (c *client) write(data []byte) {
+	select {
+	case <-c.done:
+	case c.out <- data:
+	default:
+		c.close()
+	}
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// splitRequests splits the client input into requests terminated by ';' or a newline.
+func splitRequests(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, ";\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	if len(data) >= maxRequestSize {
+		return 0, nil, errors.New("gpsgen/gpsd: request too large")
+	}
+	return 0, nil, nil
+}
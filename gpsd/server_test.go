@@ -0,0 +1,161 @@
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gpsgen "github.com/mmadfox/go-gpsgen"
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testClient) request(req string) {
+	_, err := c.conn.Write([]byte(req))
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) line() string {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	require.NoError(c.t, err)
+	return strings.TrimRight(line, "\r\n")
+}
+
+func (c *testClient) read(class string) map[string]any {
+	var msg map[string]any
+	require.NoError(c.t, json.Unmarshal([]byte(c.line()), &msg))
+	require.Equal(c.t, class, msg["class"])
+	return msg
+}
+
+func startServer(t *testing.T) (*Server, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(nil)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Close())
+		require.NoError(t, <-done)
+	})
+	return srv, ln.Addr().String()
+}
+
+func testPacket(offline bool) *pb.Packet {
+	return &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices: []*pb.Device{{
+			Id:        "dev1",
+			Speed:     11.5,
+			IsOffline: offline,
+			Location: &pb.Device_Location{
+				Lat:       48.1173,
+				Lon:       11.516666,
+				Elevation: 545.4,
+				Bearing:   84.4,
+			},
+		}},
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	srv, addr := startServer(t)
+	ctx := context.Background()
+	srv.HandleEvent(gpsgen.Event{Kind: gpsgen.EventDeviceAttached, DeviceID: "dev2"})
+
+	c := dial(t, addr)
+	version := c.read("VERSION")
+	require.Equal(t, float64(ProtoMajor), version["proto_major"])
+
+	c.request("?DEVICES;\n")
+	devices := c.read("DEVICES")["devices"].([]any)
+	require.Len(t, devices, 1)
+	require.Equal(t, "/dev/gpsgen/dev2", devices[0].(map[string]any)["path"])
+
+	c.request(`?WATCH={"enable":true,"json":true};` + "\n")
+	c.read("DEVICES")
+	watch := c.read("WATCH")
+	require.Equal(t, true, watch["enable"])
+	require.Equal(t, true, watch["json"])
+
+	require.NoError(t, srv.Write(ctx, testPacket(false)))
+	device := c.read("DEVICE")
+	require.Equal(t, "/dev/gpsgen/dev1", device["path"])
+	tpv := c.read("TPV")
+	require.Equal(t, "/dev/gpsgen/dev1", tpv["device"])
+	require.Equal(t, float64(Mode3D), tpv["mode"])
+	require.Equal(t, "2023-03-23T12:35:19.000Z", tpv["time"])
+	require.Equal(t, 48.1173, tpv["lat"])
+	require.Equal(t, 11.516666, tpv["lon"])
+	require.Equal(t, 545.4, tpv["altHAE"])
+	require.Equal(t, 84.4, tpv["track"])
+	require.Equal(t, 11.5, tpv["speed"])
+	sky := c.read("SKY")
+	require.Equal(t, float64(8), sky["uSat"])
+	require.Len(t, sky["satellites"], 8)
+
+	require.NoError(t, srv.Write(ctx, testPacket(true)))
+	tpv = c.read("TPV")
+	require.Equal(t, float64(ModeNoFix), tpv["mode"])
+	require.NotContains(t, tpv, "lat")
+	sky = c.read("SKY")
+	require.Equal(t, float64(0), sky["uSat"])
+
+	c.request("?POLL;")
+	poll := c.read("POLL")
+	require.Equal(t, float64(2), poll["active"])
+	require.Len(t, poll["tpv"], 1)
+
+	srv.HandleEvent(gpsgen.Event{Kind: gpsgen.EventDeviceDetached, DeviceID: "dev1"})
+	device = c.read("DEVICE")
+	require.Equal(t, "/dev/gpsgen/dev1", device["path"])
+	require.NotContains(t, device, "activated")
+
+	c.request("?FOO;")
+	require.Contains(t, c.read("ERROR")["message"], "?FOO")
+}
+
+func TestServer_WatchDevice(t *testing.T) {
+	srv, addr := startServer(t)
+	srv.Attach("dev1")
+
+	c := dial(t, addr)
+	c.read("VERSION")
+	c.request(`?WATCH={"enable":true,"nmea":true,"device":"/dev/gpsgen/dev1"}` + "\n")
+	c.read("DEVICES")
+	watch := c.read("WATCH")
+	require.Equal(t, false, watch["json"])
+	require.Equal(t, true, watch["nmea"])
+
+	pck := testPacket(false)
+	other := &pb.Device{Id: "dev2"}
+	pck.Devices = append([]*pb.Device{other}, pck.Devices...)
+	require.NoError(t, srv.Write(context.Background(), pck))
+	require.True(t, strings.HasPrefix(c.line(), "$GPRMC,123519.00,A,"))
+	for i := 1; i < 7; i++ {
+		require.True(t, strings.HasPrefix(c.line(), "$GP"))
+	}
+
+	c.request(`?DEVICE={"path":"/dev/gpsgen/dev2"};`)
+	require.Equal(t, "/dev/gpsgen/dev2", c.read("DEVICE")["path"])
+}
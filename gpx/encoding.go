@@ -9,6 +9,7 @@ import (
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/navigator"
 	"github.com/mmadfox/go-gpsgen/properties"
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/tkrajina/gpxgo/gpx"
 )
 
@@ -82,6 +83,12 @@ func Encode(routes []*navigator.Route) ([]byte, error) {
 
 // Decode converts GPX data into a slice of navigator.Routes.
 func Decode(data []byte) ([]*navigator.Route, error) {
+	return DecodeWithSource(nil, data)
+}
+
+// DecodeWithSource is like Decode but draws the IDs and colors of new routes
+// and tracks from src. A nil src uses the shared source.
+func DecodeWithSource(src *random.Random, data []byte) ([]*navigator.Route, error) {
 	if len(data) == 0 {
 		return nil, ErrNoRoutes
 	}
@@ -151,8 +158,8 @@ func Decode(data []byte) ([]*navigator.Route, error) {
 		if len(gpxData.Routes) > 0 {
 			routes = make([]*navigator.Route, 0, len(gpxData.Routes))
 			for i := 0; i < len(gpxData.Routes); i++ {
-				route := navigator.NewRoute()
-				track, err := navigator.NewTrack(makePoints(gpxData.Routes[i].Points))
+				route := navigator.NewRouteWithSource(src)
+				track, err := navigator.NewTrackWithSource(src, makePoints(gpxData.Routes[i].Points))
 				if err != nil {
 					return nil, err
 				}
@@ -164,11 +171,11 @@ func Decode(data []byte) ([]*navigator.Route, error) {
 		if len(gpxData.Tracks) > 0 {
 			routes = make([]*navigator.Route, 0, len(gpxData.Tracks))
 			for i := 0; i < len(gpxData.Tracks); i++ {
-				route := navigator.NewRoute()
+				route := navigator.NewRouteWithSource(src)
 				var trackErr error
 				for j := 0; j < len(gpxData.Tracks[i].Segments); j++ {
 					gpxPoints := gpxData.Tracks[i].Segments[j].Points
-					track, err := navigator.NewTrack(makePoints(gpxPoints))
+					track, err := navigator.NewTrackWithSource(src, makePoints(gpxPoints))
 					if err != nil {
 						trackErr = err
 						break
@@ -183,8 +190,8 @@ func Decode(data []byte) ([]*navigator.Route, error) {
 		}
 
 		if len(gpxData.Waypoints) > 0 {
-			route := navigator.NewRoute()
-			track, err := navigator.NewTrack(makePoints(gpxData.Waypoints))
+			route := navigator.NewRouteWithSource(src)
+			track, err := navigator.NewTrackWithSource(src, makePoints(gpxData.Waypoints))
 			if err != nil {
 				return nil, err
 			}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/navigator"
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/stretchr/testify/require"
 	"github.com/tkrajina/gpxgo/gpx"
 )
@@ -258,3 +259,18 @@ func TestDecodeNewRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeWithSource(t *testing.T) {
+	decode := func() []*navigator.Route {
+		routes, err := DecodeWithSource(random.NewRandomWithSeed(1), file("tracks"))
+		require.NoError(t, err)
+		return routes
+	}
+	a, b := decode(), decode()
+	require.Len(t, b, len(a))
+	for i := 0; i < len(a); i++ {
+		require.Equal(t, a[i].ID(), b[i].ID())
+		require.Equal(t, a[i].Color(), b[i].Color())
+		require.Equal(t, a[i].TrackAt(0).ID(), b[i].TrackAt(0).ID())
+	}
+}
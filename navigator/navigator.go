@@ -5,6 +5,7 @@ import (
 
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/mmadfox/go-gpsgen/types"
 )
 
@@ -22,6 +23,7 @@ type Navigator struct {
 	point                  geo.LatLonPoint
 	elevation              *types.Sensor
 	offline                *types.Random
+	rnd                    *random.Random
 	distance               float64
 	skipOffline            bool
 	version                int
@@ -38,7 +40,7 @@ func New(opts ...Option) (*Navigator, error) {
 		return nil, err
 	}
 
-	elevation, err := types.NewSensor("elevation",
+	elevation, err := types.NewSensorWithSource(o.rnd, "elevation",
 		o.elevationMin,
 		o.elevationMax,
 		o.elevationAmplitude,
@@ -52,15 +54,26 @@ func New(opts ...Option) (*Navigator, error) {
 		routes:      make([]*Route, 0),
 		elevation:   elevation,
 		skipOffline: o.skipOffline,
+		rnd:         o.rnd,
 	}
 	switch o.skipOffline {
 	case false:
-		nav.offline = types.NewRandom(o.minOffline, o.maxOffline)
+		nav.offline = types.NewRandomWithSource(o.rnd, o.minOffline, o.maxOffline)
 	}
 
 	return nav, nil
 }
 
+// SetSource sets the random source of the elevation curve and the offline durations.
+// A nil src uses the shared source.
+func (n *Navigator) SetSource(src *random.Random) {
+	n.rnd = src
+	n.elevation.SetSource(src)
+	if n.offline != nil {
+		n.offline.SetSource(src)
+	}
+}
+
 // Location returns the current geographic location of the navigator.
 func (n *Navigator) Location() geo.LatLonPoint {
 	return n.point
@@ -332,6 +345,8 @@ func (n *Navigator) OfflineDuration() int {
 }
 
 // Update updates the navigator's state in the provided Device proto message.
+// UTM and DMS coordinates are only computed when the corresponding
+// location messages are present in the state.
 func (n *Navigator) Update(state *proto.Device) {
 	n.normalizeDeviceState(state)
 
@@ -362,8 +377,12 @@ func (n *Navigator) Update(state *proto.Device) {
 	state.IsOffline = n.offlineIndex > 0
 	state.OfflineDuration = int64(n.offlineIndex)
 
-	setUTM(n.point.Lat, n.point.Lon, state.Location.Utm)
-	setDMS(n.point.Lat, n.point.Lon, state.Location.LatDms, state.Location.LonDms)
+	if state.Location.Utm != nil {
+		setUTM(n.point.Lat, n.point.Lon, state.Location.Utm)
+	}
+	if state.Location.LatDms != nil && state.Location.LonDms != nil {
+		setDMS(n.point.Lat, n.point.Lon, state.Location.LatDms, state.Location.LonDms)
+	}
 }
 
 // NextRoute moves to the next route.
@@ -596,10 +615,12 @@ func (n *Navigator) FromSnapshot(snap *proto.Snapshot_Navigator) {
 		Lon: snap.Point.Lon,
 		Lat: snap.Point.Lat,
 	}
-	n.elevation = new(types.Sensor)
+	if n.elevation == nil {
+		n.elevation = new(types.Sensor)
+	}
 	n.elevation.FromSnapshot(snap.Elevation)
 	if !n.skipOffline {
-		n.offline = types.NewRandom(int(snap.OfflineMin), int(snap.OfflineMax))
+		n.offline = types.NewRandomWithSource(n.rnd, int(snap.OfflineMin), int(snap.OfflineMax))
 	}
 	n.distance = snap.Distance
 	n.skipOffline = snap.SkipOffline
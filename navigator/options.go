@@ -3,6 +3,7 @@ package navigator
 import (
 	"fmt"
 
+	"github.com/mmadfox/go-gpsgen/random"
 	"github.com/mmadfox/go-gpsgen/types"
 )
 
@@ -39,11 +40,19 @@ func WithOffline(min, max int) Option {
 	}
 }
 
+// WithSource sets the random source of the elevation curve and the offline durations.
+func WithSource(src *random.Random) Option {
+	return func(opt *navigatorOptions) {
+		opt.rnd = src
+	}
+}
+
 type navigatorOptions struct {
 	elevationMin, elevationMax                 float64
 	elevationMode                              types.SensorMode
 	minOffline, maxOffline, elevationAmplitude int
 	skipOffline                                bool
+	rnd                                        *random.Random
 }
 
 func (o *navigatorOptions) validate() error {
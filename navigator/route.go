@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/mmadfox/go-gpsgen/properties"
 	"github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 )
 
 // Route represents a route containing tracks and associated properties.
@@ -26,9 +26,16 @@ type RouteSnapshot = proto.Snapshot_Navigator_Route
 
 // NewRoute creates a new Route instance with default values.
 func NewRoute() *Route {
+	return NewRouteWithSource(nil)
+}
+
+// NewRouteWithSource is like NewRoute but draws the ID and the color from src.
+// A nil src uses the shared source.
+func NewRouteWithSource(src *random.Random) *Route {
+	src = random.Or(src)
 	return &Route{
-		id:     uuid.NewString(),
-		color:  colorful.FastHappyColor().Hex(),
+		id:     src.UUID(),
+		color:  src.Color(),
 		tracks: make([]*Track, 0),
 	}
 }
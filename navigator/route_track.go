@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/mmadfox/go-gpsgen/geo"
 	"github.com/mmadfox/go-gpsgen/properties"
 	"github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 )
 
 // Track represents a track composed of segments.
@@ -28,14 +28,21 @@ type TrackSnapshot = proto.Snapshot_Navigator_Route_Track
 
 // NewTrack creates a new Track instance from a list of geographical points.
 func NewTrack(points []geo.LatLonPoint) (*Track, error) {
+	return NewTrackWithSource(nil, points)
+}
+
+// NewTrackWithSource is like NewTrack but draws the ID and the color from src.
+// A nil src uses the shared source.
+func NewTrackWithSource(src *random.Random, points []geo.LatLonPoint) (*Track, error) {
+	src = random.Or(src)
 	segments, dist, err := makeSegments(points)
 	if err != nil {
 		return nil, err
 	}
 	return &Track{
-		id:       uuid.NewString(),
+		id:       src.UUID(),
 		segments: segments,
-		color:    colorful.FastHappyColor().Hex(),
+		color:    src.Color(),
 		dist:     dist,
 		isClosed: isClosed(points),
 	}, nil
@@ -0,0 +1,39 @@
+package nmea
+
+// Dilutions of precision reported with a valid fix.
+const (
+	HDOP = 0.9
+	VDOP = 1.2
+	PDOP = 1.5
+)
+
+// Satellite is a satellite of the synthetic constellation.
+type Satellite struct {
+	PRN       int // Pseudo-random noise number.
+	Elevation int // Elevation in degrees.
+	Azimuth   int // Azimuth in degrees true.
+	SNR       int // Signal-to-noise ratio in dB-Hz, reported with a valid fix only.
+}
+
+var constellation = newConstellation(8)
+
+// Constellation returns the synthetic satellites in view reported in GSA and GSV
+// sentences. The constellation is fixed: every satellite is used for a valid fix.
+func Constellation() []Satellite {
+	sats := make([]Satellite, len(constellation))
+	copy(sats, constellation)
+	return sats
+}
+
+func newConstellation(n int) []Satellite {
+	sats := make([]Satellite, n)
+	for i := 0; i < n; i++ {
+		sats[i] = Satellite{
+			PRN:       i*3 + 2,
+			Elevation: 15 + (i*23)%70,
+			Azimuth:   (i*45 + 17) % 360,
+			SNR:       30 + (i*7)%20,
+		}
+	}
+	return sats
+}
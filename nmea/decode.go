@@ -0,0 +1,362 @@
+package nmea
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmadfox/go-gpsgen/geo"
+	"github.com/mmadfox/go-gpsgen/navigator"
+	"github.com/mmadfox/go-gpsgen/random"
+)
+
+var (
+	ErrNoRoutes         = errors.New("gpsgen/nmea: no routes")
+	ErrInvalidChecksum  = errors.New("gpsgen/nmea: invalid checksum")
+	ErrInvalidSentence  = errors.New("gpsgen/nmea: invalid sentence")
+	ErrUnsupportedField = errors.New("gpsgen/nmea: unsupported field value")
+	ErrLineTooLong      = errors.New("gpsgen/nmea: line too long")
+)
+
+// Track property keys holding the per-point data of decoded tracks.
+const (
+	PropTimes      = "times"
+	PropElevations = "elevations"
+)
+
+// DefaultMaxGap is the default time gap between two fixes that splits a track.
+const DefaultMaxGap = time.Minute
+
+const maxLineSize = 4096
+
+// DecodeOptions defines the options of DecodeReader.
+type DecodeOptions struct {
+	// MaxGap is the time gap between two fixes that starts a new track. Default DefaultMaxGap.
+	MaxGap time.Duration
+
+	// Strict makes the decoding fail on a malformed sentence, a checksum mismatch
+	// or a line longer than 4096 bytes. By default such lines are skipped.
+	Strict bool
+
+	// Random is the source of the route and track IDs and colors. Nil uses the shared source.
+	Random *random.Random
+}
+
+// Decode converts an NMEA 0183 log into a route.
+// See DecodeReader for details.
+func Decode(data []byte) ([]*navigator.Route, error) {
+	if len(data) == 0 {
+		return nil, ErrNoRoutes
+	}
+	return DecodeReader(bytes.NewReader(data), nil)
+}
+
+// DecodeWithSource is like Decode but draws the route and track IDs and colors from src.
+// A nil src uses the shared source.
+func DecodeWithSource(src *random.Random, data []byte) ([]*navigator.Route, error) {
+	if len(data) == 0 {
+		return nil, ErrNoRoutes
+	}
+	return DecodeReader(bytes.NewReader(data), &DecodeOptions{Random: src})
+}
+
+// DecodeReader reads an NMEA 0183 log and converts it into a route.
+// Fixes are taken from RMC and GGA sentences with valid checksums;
+// GGA sentences contribute the elevation of the fix with the same time.
+// GGA sentences carry no date: the ones before the first RMC sentence are
+// kept until its date is known and dropped on fix loss or at the end of
+// the log, and a GGA time that goes back across midnight within MaxGap
+// is moved to the next day.
+// A track ends on fix loss (RMC status V or GGA quality 0) or when
+// the time between two fixes exceeds MaxGap. Tracks with less than
+// two distinct positions are dropped.
+// The time and the elevation of every track point are stored in
+// the PropTimes ([]string, RFC 3339) and PropElevations ([]float64) track properties.
+func DecodeReader(r io.Reader, opts *DecodeOptions) ([]*navigator.Route, error) {
+	if opts == nil {
+		opts = new(DecodeOptions)
+	}
+	d := decoder{maxGap: opts.MaxGap, rnd: opts.Random}
+	if d.maxGap <= 0 {
+		d.maxGap = DefaultMaxGap
+	}
+
+	br := bufio.NewReaderSize(r, maxLineSize)
+	for {
+		data, readErr := readLine(br)
+		if readErr != nil && readErr != io.EOF {
+			if readErr == ErrLineTooLong && !opts.Strict {
+				continue
+			}
+			return nil, readErr
+		}
+		line := strings.TrimSpace(string(data))
+		if len(line) > 0 {
+			fields, err := parseSentence(line)
+			if err == nil {
+				err = d.handle(fields)
+			}
+			if err != nil && opts.Strict {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	d.flush()
+
+	if len(d.tracks) == 0 {
+		return nil, ErrNoRoutes
+	}
+	route := navigator.NewRouteWithSource(d.rnd)
+	for i := 0; i < len(d.tracks); i++ {
+		route.AddTrack(d.tracks[i])
+	}
+	return []*navigator.Route{route}, nil
+}
+
+type fix struct {
+	time      time.Time
+	point     geo.LatLonPoint
+	elevation float64
+}
+
+type decoder struct {
+	maxGap  time.Duration
+	rnd     *random.Random
+	date    time.Time
+	points  []fix
+	pending []fix // GGA fixes before the first date, on the zero date
+	tracks  []*navigator.Track
+}
+
+func (d *decoder) handle(fields []string) error {
+	if len(fields[0]) < 5 {
+		return nil
+	}
+	switch fields[0][len(fields[0])-3:] {
+	case RMC:
+		return d.handleRMC(fields)
+	case GGA:
+		return d.handleGGA(fields)
+	}
+	return nil
+}
+
+// $--RMC,hhmmss.ss,A,llll.ll,a,yyyyy.yy,a,x.x,x.x,ddmmyy,x.x,a*hh
+func (d *decoder) handleRMC(fields []string) error {
+	if len(fields) < 10 {
+		return ErrInvalidSentence
+	}
+	if fields[2] != "A" {
+		d.flush()
+		return nil
+	}
+	date, err := time.Parse("020106", fields[9])
+	if err != nil {
+		return ErrUnsupportedField
+	}
+	d.date = date
+	t, err := parseTime(date, fields[1])
+	if err != nil {
+		return err
+	}
+	point, err := parsePoint(fields[3], fields[4], fields[5], fields[6])
+	if err != nil {
+		return err
+	}
+	d.addPending(t)
+	d.add(fix{time: t, point: point}, false)
+	return nil
+}
+
+// $--GGA,hhmmss.ss,llll.ll,a,yyyyy.yy,a,x,xx,x.x,x.x,M,x.x,M,x.x,xxxx*hh
+func (d *decoder) handleGGA(fields []string) error {
+	if len(fields) < 10 {
+		return ErrInvalidSentence
+	}
+	if fields[6] == "" || fields[6] == "0" {
+		d.flush()
+		return nil
+	}
+	t, err := parseTime(d.date, fields[1])
+	if err != nil {
+		return err
+	}
+	point, err := parsePoint(fields[2], fields[3], fields[4], fields[5])
+	if err != nil {
+		return err
+	}
+	var elevation float64
+	if fields[9] != "" {
+		elevation, err = strconv.ParseFloat(fields[9], 64)
+		if err != nil {
+			return ErrUnsupportedField
+		}
+	}
+	f := fix{time: t, point: point, elevation: elevation}
+	if d.date.IsZero() {
+		d.pending = append(d.pending, f)
+		return nil
+	}
+	if n := len(d.points); n > 0 {
+		f.time = d.rollover(d.points[n-1].time, f.time)
+	}
+	d.add(f, true)
+	return nil
+}
+
+// addPending dates the GGA fixes received before the first RMC fix at time t.
+// A fix later in the day than t precedes midnight.
+func (d *decoder) addPending(t time.Time) {
+	pending := d.pending
+	d.pending = nil
+	for i := 0; i < len(pending); i++ {
+		f := pending[i]
+		f.time = d.date.Add(f.time.Sub(time.Time{}))
+		if f.time.After(t) {
+			f.time = f.time.Add(-24 * time.Hour)
+		}
+		d.add(f, true)
+	}
+}
+
+// rollover moves t to the next day when its time of day went back
+// across midnight since the last fix.
+func (d *decoder) rollover(last, t time.Time) time.Time {
+	if !t.Before(last) {
+		return t
+	}
+	if next := t.Add(24 * time.Hour); next.Sub(last) <= d.maxGap {
+		return next
+	}
+	return t
+}
+
+func (d *decoder) add(f fix, hasElevation bool) {
+	if n := len(d.points); n > 0 {
+		last := &d.points[n-1]
+		if last.time.Equal(f.time) {
+			if hasElevation {
+				last.elevation = f.elevation
+			}
+			return
+		}
+		gap := f.time.Sub(last.time)
+		if gap < 0 || gap > d.maxGap {
+			d.flush()
+		} else if last.point == f.point {
+			return
+		}
+	}
+	d.points = append(d.points, f)
+}
+
+func (d *decoder) flush() {
+	points := d.points
+	d.points = nil
+	d.pending = nil
+	if len(points) < 2 {
+		return
+	}
+	latlon := make([]geo.LatLonPoint, len(points))
+	times := make([]string, len(points))
+	elevations := make([]float64, len(points))
+	for i := 0; i < len(points); i++ {
+		latlon[i] = points[i].point
+		times[i] = points[i].time.Format(time.RFC3339Nano)
+		elevations[i] = points[i].elevation
+	}
+	track, err := navigator.NewTrackWithSource(d.rnd, latlon)
+	if err != nil {
+		return
+	}
+	track.Props()[PropTimes] = times
+	track.Props()[PropElevations] = elevations
+	d.tracks = append(d.tracks, track)
+}
+
+// parseSentence validates the checksum of the sentence and returns its fields.
+// readLine reads the next line of at most maxLineSize bytes.
+// A longer line is discarded up to its end and ErrLineTooLong is returned.
+func readLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	for err == bufio.ErrBufferFull {
+		_, err = br.ReadSlice('\n')
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return nil, ErrLineTooLong
+}
+
+func parseSentence(line string) ([]string, error) {
+	if line[0] != '$' && line[0] != '!' {
+		return nil, ErrInvalidSentence
+	}
+	i := strings.LastIndexByte(line, '*')
+	if i < 0 || len(line)-i-1 != 2 {
+		return nil, ErrInvalidSentence
+	}
+	sum, err := strconv.ParseUint(line[i+1:], 16, 8)
+	if err != nil {
+		return nil, ErrInvalidSentence
+	}
+	body := line[1:i]
+	if Checksum(body) != byte(sum) {
+		return nil, ErrInvalidChecksum
+	}
+	return strings.Split(body, ","), nil
+}
+
+func parseTime(date time.Time, s string) (time.Time, error) {
+	if len(s) < 6 {
+		return time.Time{}, ErrUnsupportedField
+	}
+	hh, err1 := strconv.Atoi(s[0:2])
+	mm, err2 := strconv.Atoi(s[2:4])
+	sec, err3 := strconv.ParseFloat(s[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return time.Time{}, ErrUnsupportedField
+	}
+	return date.Add(time.Duration(hh)*time.Hour +
+		time.Duration(mm)*time.Minute +
+		time.Duration(sec*float64(time.Second))), nil
+}
+
+func parsePoint(lat, ns, lon, ew string) (geo.LatLonPoint, error) {
+	la, err := parseDegrees(lat, ns, "N", "S")
+	if err != nil {
+		return geo.LatLonPoint{}, err
+	}
+	lo, err := parseDegrees(lon, ew, "E", "W")
+	if err != nil {
+		return geo.LatLonPoint{}, err
+	}
+	return geo.LatLonPoint{Lat: la, Lon: lo}, nil
+}
+
+func parseDegrees(v, hemi, pos, neg string) (float64, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, ErrUnsupportedField
+	}
+	deg := float64(int(f / 100))
+	deg += (f - deg*100) / 60
+	switch hemi {
+	case pos:
+	case neg:
+		deg = -deg
+	default:
+		return 0, ErrUnsupportedField
+	}
+	return deg, nil
+}
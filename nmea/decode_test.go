@@ -0,0 +1,195 @@
+package nmea
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmadfox/go-gpsgen/navigator"
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
+	"github.com/stretchr/testify/require"
+)
+
+func testLog(t *testing.T) []byte {
+	enc := &Encoder{Sentences: []string{RMC, GGA, VTG}}
+	start := time.Date(2023, 3, 23, 23, 59, 50, 0, time.UTC)
+	var data []byte
+	for i := 0; i < 20; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		if i >= 15 {
+			// gap
+			ts = ts.Add(5 * time.Minute)
+		}
+		dev := &pb.Device{
+			Speed:     5,
+			IsOffline: i == 5,
+			Location: &pb.Device_Location{
+				Lat:       29.5 + float64(i)*0.001,
+				Lon:       106.4 + float64(i)*0.001,
+				Elevation: float64(100 + i),
+			},
+		}
+		var err error
+		data, err = enc.Encode(data, ts, dev)
+		require.NoError(t, err)
+	}
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	_, err := Decode(nil)
+	require.ErrorIs(t, err, ErrNoRoutes)
+
+	data := testLog(t)
+	data = append(data, "$GPRMC,000100.00,A,2930.000,N,10624.000,E,1.0,0.0,240323,,,A*00\r\n"...)
+	data = append(data, "garbage\r\n"...)
+
+	routes, err := Decode(data)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	route := routes[0]
+	require.Equal(t, 3, route.NumTracks())
+
+	// fix loss at the 6th fix
+	track := route.TrackAt(0)
+	require.Equal(t, 4, track.NumSegments())
+	times, ok := track.Props()[PropTimes].([]string)
+	require.True(t, ok)
+	require.Equal(t, []string{
+		"2023-03-23T23:59:50Z",
+		"2023-03-23T23:59:51Z",
+		"2023-03-23T23:59:52Z",
+		"2023-03-23T23:59:53Z",
+		"2023-03-23T23:59:54Z",
+	}, times)
+	elevations, ok := track.Props()[PropElevations].([]float64)
+	require.True(t, ok)
+	require.Equal(t, []float64{100, 101, 102, 103, 104}, elevations)
+
+	// crosses midnight
+	track = route.TrackAt(1)
+	require.Equal(t, 8, track.NumSegments())
+	times = track.Props()[PropTimes].([]string)
+	require.Equal(t, "2023-03-24T00:00:04Z", times[len(times)-1])
+
+	// after the time gap
+	track = route.TrackAt(2)
+	require.Equal(t, 4, track.NumSegments())
+	seg := track.SegmentAt(0)
+	require.InDelta(t, 29.515, seg.PointA().Lat, 1e-6)
+	require.InDelta(t, 106.415, seg.PointA().Lon, 1e-6)
+}
+
+func TestDecodeReader_Strict(t *testing.T) {
+	data := string(testLog(t))
+	_, err := DecodeReader(strings.NewReader(data), &DecodeOptions{Strict: true})
+	require.NoError(t, err)
+
+	data = strings.Replace(data, "*", "*0", 1)
+	_, err = DecodeReader(strings.NewReader(data), &DecodeOptions{Strict: true})
+	require.ErrorIs(t, err, ErrInvalidSentence)
+
+	bad := "$GPRMC,000100.00,A,2930.000,N,10624.000,E,1.0,0.0,240323,,,A*00\r\n"
+	_, err = DecodeReader(strings.NewReader(bad), &DecodeOptions{Strict: true})
+	require.ErrorIs(t, err, ErrInvalidChecksum)
+
+	routes, err := DecodeReader(strings.NewReader(string(testLog(t))), &DecodeOptions{MaxGap: 10 * time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, 2, routes[0].NumTracks())
+}
+
+func TestDecodeReader_LongLine(t *testing.T) {
+	start := time.Date(2023, 3, 23, 10, 0, 0, 0, time.UTC)
+	junk := strings.Repeat("x", 2*maxLineSize) + "\r\n"
+	data := testFix(t, RMC, start, 0) + junk +
+		testFix(t, RMC, start.Add(time.Second), 1) + junk +
+		testFix(t, RMC, start.Add(2*time.Second), 2)
+
+	routes, err := DecodeReader(strings.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	track := routes[0].TrackAt(0)
+	require.Equal(t, 2, track.NumSegments())
+
+	_, err = DecodeReader(strings.NewReader(data), &DecodeOptions{Strict: true})
+	require.ErrorIs(t, err, ErrLineTooLong)
+
+	// an overlong last line without a line ending
+	routes, err = DecodeReader(strings.NewReader(data+"\r\n"+junk[:len(junk)-2]), nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, routes[0].TrackAt(0).NumSegments())
+}
+
+func testFix(t *testing.T, sentence string, ts time.Time, i int) string {
+	dev := &pb.Device{
+		Location: &pb.Device_Location{
+			Lat:       29.5 + float64(i)*0.001,
+			Lon:       106.4 + float64(i)*0.001,
+			Elevation: float64(100 + i),
+		},
+	}
+	data, err := (&Encoder{Sentences: []string{sentence}}).Encode(nil, ts, dev)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDecode_GGABeforeDate(t *testing.T) {
+	start := time.Date(2023, 3, 23, 23, 59, 58, 0, time.UTC)
+	var log strings.Builder
+	// no date is known for the first two fixes
+	log.WriteString(testFix(t, GGA, start, 0))
+	log.WriteString(testFix(t, GGA, start.Add(time.Second), 1))
+	log.WriteString(testFix(t, GGA, start.Add(2*time.Second), 2))
+	log.WriteString(testFix(t, RMC, start.Add(2*time.Second), 2))
+	log.WriteString(testFix(t, RMC, start.Add(3*time.Second), 3))
+
+	routes, err := Decode([]byte(log.String()))
+	require.NoError(t, err)
+	require.Equal(t, 1, routes[0].NumTracks())
+	track := routes[0].TrackAt(0)
+	require.Equal(t, []string{
+		"2023-03-23T23:59:58Z",
+		"2023-03-23T23:59:59Z",
+		"2023-03-24T00:00:00Z",
+		"2023-03-24T00:00:01Z",
+	}, track.Props()[PropTimes])
+	require.Equal(t, []float64{100, 101, 102, 0}, track.Props()[PropElevations])
+
+	// without a date GGA fixes are dropped
+	_, err = Decode([]byte(testFix(t, GGA, start, 0) + testFix(t, GGA, start.Add(time.Second), 1)))
+	require.ErrorIs(t, err, ErrNoRoutes)
+}
+
+func TestDecode_GGAMidnight(t *testing.T) {
+	start := time.Date(2023, 3, 23, 23, 59, 58, 0, time.UTC)
+	var log strings.Builder
+	log.WriteString(testFix(t, RMC, start, 0))
+	for i := 1; i < 4; i++ {
+		log.WriteString(testFix(t, GGA, start.Add(time.Duration(i)*time.Second), i))
+	}
+
+	routes, err := Decode([]byte(log.String()))
+	require.NoError(t, err)
+	require.Equal(t, 1, routes[0].NumTracks())
+	require.Equal(t, []string{
+		"2023-03-23T23:59:58Z",
+		"2023-03-23T23:59:59Z",
+		"2023-03-24T00:00:00Z",
+		"2023-03-24T00:00:01Z",
+	}, routes[0].TrackAt(0).Props()[PropTimes])
+}
+
+func TestDecodeWithSource(t *testing.T) {
+	data := testLog(t)
+	decode := func() *navigator.Route {
+		routes, err := DecodeWithSource(random.NewRandomWithSeed(1), data)
+		require.NoError(t, err)
+		return routes[0]
+	}
+	a, b := decode(), decode()
+	require.Equal(t, a.ID(), b.ID())
+	for i := 0; i < a.NumTracks(); i++ {
+		require.Equal(t, a.TrackAt(i).ID(), b.TrackAt(i).ID())
+	}
+}
@@ -0,0 +1,265 @@
+package nmea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// ErrNotSupported is returned by OpenReceiver on platforms without pseudo-terminals.
+var ErrNotSupported = errors.New("gpsgen/nmea: virtual receiver is not supported on this platform")
+
+// DefaultBaudRate is the default rate of a virtual receiver.
+const DefaultBaudRate = 4800
+
+// ReceiverOptions defines the options of a virtual GPS receiver.
+type ReceiverOptions struct {
+	// BaudRate limits the stream to BaudRate/10 bytes per second like an 8N1 serial line.
+	// It is also reported as the terminal speed. Default DefaultBaudRate.
+	BaudRate int
+
+	// Symlink is an optional path of a symbolic link to the pseudo-terminal,
+	// e.g. /tmp/gps0. An existing symbolic link is replaced.
+	Symlink string
+}
+
+// Receiver is a virtual GPS receiver that streams NMEA sentences over a pseudo-terminal.
+// Applications open the terminal at Path, or at the symbolic link, like a serial GPS device.
+// Data written while no application reads the terminal and its buffer is full is dropped,
+// as it would be on a real serial line.
+type Receiver struct {
+	wmu      sync.Mutex
+	mu       sync.Mutex
+	pty      *pty
+	path     string
+	symlink  string
+	baudRate int
+	next     time.Time
+	dropped  uint64
+	closed   bool
+}
+
+// OpenReceiver creates a new pseudo-terminal and returns its receiver.
+func OpenReceiver(opts *ReceiverOptions) (*Receiver, error) {
+	if opts == nil {
+		opts = new(ReceiverOptions)
+	}
+	baudRate := opts.BaudRate
+	if baudRate <= 0 {
+		baudRate = DefaultBaudRate
+	}
+	p, path, err := openPTY(baudRate)
+	if err != nil {
+		return nil, err
+	}
+	r := &Receiver{
+		pty:      p,
+		path:     path,
+		baudRate: baudRate,
+	}
+	if len(opts.Symlink) > 0 {
+		if err := replaceSymlink(path, opts.Symlink); err != nil {
+			_ = p.close()
+			return nil, err
+		}
+		r.symlink = opts.Symlink
+	}
+	return r, nil
+}
+
+// Path returns the path of the pseudo-terminal, e.g. /dev/pts/3.
+func (r *Receiver) Path() string {
+	return r.path
+}
+
+// Symlink returns the path of the symbolic link to the pseudo-terminal, if any.
+func (r *Receiver) Symlink() string {
+	return r.symlink
+}
+
+// Dropped returns the number of bytes dropped because nobody read the terminal.
+func (r *Receiver) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Write writes raw data to the terminal at the configured rate.
+// It blocks for the time the data takes on the line.
+func (r *Receiver) Write(data []byte) (int, error) {
+	return r.WriteContext(context.Background(), data)
+}
+
+// WriteContext writes raw data to the terminal at the configured rate.
+// It blocks for the time the data takes on the line or until ctx is done.
+// Writes to the same receiver are sent in order.
+func (r *Receiver) WriteContext(ctx context.Context, data []byte) (int, error) {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	if wait := r.throttle(time.Now(), len(data)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := r.pty.write(data)
+	if err != nil {
+		return n, err
+	}
+	if n < len(data) {
+		atomic.AddUint64(&r.dropped, uint64(len(data)-n))
+	}
+	return len(data), nil
+}
+
+// Close closes the pseudo-terminal and removes the symbolic link.
+func (r *Receiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var errs []error
+	if len(r.symlink) > 0 {
+		if err := os.Remove(r.symlink); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := r.pty.close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ReceiverSink streams every device to its virtual receiver.
+// Devices are encoded under the sink lock, then every receiver is written
+// on its own, so a slow receiver does not hold up the others.
+// It implements the gpsgen.Sink interface.
+type ReceiverSink struct {
+	mu        sync.Mutex
+	enc       *Encoder
+	receivers map[string]*Receiver
+}
+
+// NewReceiverSink creates a ReceiverSink. Devices without a receiver are skipped.
+// The receivers are closed with the sink. If enc is nil, NewEncoder is used.
+func NewReceiverSink(enc *Encoder, receivers map[string]*Receiver) *ReceiverSink {
+	if enc == nil {
+		enc = NewEncoder()
+	}
+	return &ReceiverSink{
+		enc:       enc,
+		receivers: receivers,
+	}
+}
+
+// Write writes the sentences of every device of the packet to its receiver.
+// The packet timestamp is used as the fix time.
+func (s *ReceiverSink) Write(ctx context.Context, pck *pb.Packet) error {
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	type output struct {
+		r    *Receiver
+		data []byte
+	}
+	s.mu.Lock()
+	outputs := make([]output, 0, len(pck.Devices))
+	for i := 0; i < len(pck.Devices); i++ {
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		r, ok := s.receivers[dev.Id]
+		if !ok {
+			continue
+		}
+		data, err := s.enc.Encode(nil, t, dev)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		outputs = append(outputs, output{r: r, data: data})
+	}
+	s.mu.Unlock()
+
+	errs := make([]error, len(outputs))
+	var wg sync.WaitGroup
+	for i := 0; i < len(outputs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = outputs[i].r.WriteContext(ctx, outputs[i].data)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes the receivers.
+func (s *ReceiverSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, r := range s.receivers {
+		if err := r.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteDevice writes the sentences for the device state to the receiver.
+func (r *Receiver) WriteDevice(ctx context.Context, enc *Encoder, t time.Time, dev *pb.Device) error {
+	if enc == nil {
+		enc = NewEncoder()
+	}
+	data, err := enc.Encode(nil, t, dev)
+	if err != nil {
+		return err
+	}
+	_, err = r.WriteContext(ctx, data)
+	return err
+}
+
+func replaceSymlink(target, link string) error {
+	fi, err := os.Lstat(link)
+	switch {
+	case err == nil && fi.Mode()&os.ModeSymlink == 0:
+		return fmt.Errorf("gpsgen/nmea: %s exists and is not a symbolic link", link)
+	case err == nil:
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	return os.Symlink(target, link)
+}
+
+// throttle returns how long to wait before n bytes can be sent
+// and reserves the line time for them.
+func (r *Receiver) throttle(now time.Time, n int) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(n) * 10 * time.Second / time.Duration(r.baudRate))
+	return wait
+}
@@ -0,0 +1,115 @@
+//go:build linux
+
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// cbaud masks the baud rate bits of Cflag. CBAUD is missing from syscall
+// and differs between architectures, so it is built from the rate constants.
+const cbaud = syscall.B50 | syscall.B75 | syscall.B110 | syscall.B134 | syscall.B150 |
+	syscall.B200 | syscall.B300 | syscall.B600 | syscall.B1200 | syscall.B1800 |
+	syscall.B2400 | syscall.B4800 | syscall.B9600 | syscall.B19200 | syscall.B38400 |
+	syscall.B57600 | syscall.B115200 | syscall.B230400 | syscall.B460800 |
+	syscall.B500000 | syscall.B576000 | syscall.B921600 | syscall.B1000000 |
+	syscall.B1152000 | syscall.B1500000 | syscall.B2000000 | syscall.B2500000 |
+	syscall.B3000000 | syscall.B3500000 | syscall.B4000000
+
+var baudRates = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+}
+
+type pty struct {
+	fd int
+}
+
+func openPTY(baudRate int) (*pty, string, error) {
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("gpsgen/nmea: open pty: %w", err)
+	}
+	p := &pty{fd: fd}
+
+	var unlock int32
+	if err := ioctl(fd, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		_ = p.close()
+		return nil, "", fmt.Errorf("gpsgen/nmea: unlock pty: %w", err)
+	}
+	var num uint32
+	if err := ioctl(fd, syscall.TIOCGPTN, unsafe.Pointer(&num)); err != nil {
+		_ = p.close()
+		return nil, "", fmt.Errorf("gpsgen/nmea: pty number: %w", err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", num)
+	if err := makeRaw(path, baudRate); err != nil {
+		_ = p.close()
+		return nil, "", err
+	}
+	return p, path, nil
+}
+
+// makeRaw switches the terminal to raw mode, so sentences pass through unchanged.
+func makeRaw(path string, baudRate int) error {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("gpsgen/nmea: open %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)); err != nil {
+		return fmt.Errorf("gpsgen/nmea: get termios: %w", err)
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	// The speed is set through Cflag only: Ispeed and Ospeed
+	// are not part of syscall.Termios on every architecture.
+	if speed, ok := baudRates[baudRate]; ok {
+		t.Cflag = t.Cflag&^cbaud | speed
+	}
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&t)); err != nil {
+		return fmt.Errorf("gpsgen/nmea: set termios: %w", err)
+	}
+	return nil
+}
+
+// write writes data without blocking and returns the number of bytes accepted
+// by the terminal buffer.
+func (p *pty) write(data []byte) (int, error) {
+	n, err := syscall.Write(p.fd, data)
+	if errors.Is(err, syscall.EAGAIN) {
+		return 0, nil
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+func (p *pty) close() error {
+	return syscall.Close(p.fd)
+}
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
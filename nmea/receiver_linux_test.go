@@ -0,0 +1,79 @@
+//go:build linux
+
+package nmea
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiver(t *testing.T) {
+	link := filepath.Join(t.TempDir(), "gps0")
+	r, err := OpenReceiver(&ReceiverOptions{BaudRate: 115200, Symlink: link})
+	if err != nil {
+		t.Skipf("pseudo-terminals are not available: %v", err)
+	}
+	defer r.Close()
+	require.True(t, strings.HasPrefix(r.Path(), "/dev/pts/"))
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, r.Path(), target)
+
+	tty, err := os.OpenFile(link, os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer tty.Close()
+
+	sink := NewReceiverSink(&Encoder{Sentences: []string{RMC, GGA}}, map[string]*Receiver{"dev1": r})
+	dev2 := testDevice(false)
+	dev2.Id = "dev2"
+	pck := &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices:   []*pb.Device{testDevice(false), dev2},
+	}
+	require.NoError(t, sink.Write(context.Background(), pck))
+
+	scanner := bufio.NewScanner(tty)
+	require.True(t, scanner.Scan())
+	require.True(t, strings.HasPrefix(scanner.Text(), "$GPRMC,123519.00,A,"))
+	require.True(t, scanner.Scan())
+	require.True(t, strings.HasPrefix(scanner.Text(), "$GPGGA,123519.00,"))
+
+	require.NoError(t, sink.Close())
+	_, err = os.Lstat(link)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = r.Write([]byte("x"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestReceiver_throttle(t *testing.T) {
+	r := &Receiver{baudRate: 4800}
+	now := time.Now()
+	require.Zero(t, r.throttle(now, 480))
+	require.Equal(t, time.Second, r.throttle(now, 480))
+	require.Equal(t, 1500*time.Millisecond, r.throttle(now.Add(500*time.Millisecond), 10))
+	require.Zero(t, r.throttle(now.Add(5*time.Second), 10))
+}
+
+func TestReceiver_WriteContext(t *testing.T) {
+	r, err := OpenReceiver(&ReceiverOptions{BaudRate: 4800})
+	if err != nil {
+		t.Skipf("pseudo-terminals are not available: %v", err)
+	}
+	defer r.Close()
+	r.next = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = r.WriteContext(ctx, []byte("x"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package nmea
+
+type pty struct{}
+
+func openPTY(int) (*pty, string, error) {
+	return nil, "", ErrNotSupported
+}
+
+func (p *pty) write(data []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (p *pty) close() error {
+	return nil
+}
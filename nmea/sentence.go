@@ -0,0 +1,281 @@
+package nmea
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Sentence types supported by the Encoder.
+const (
+	GGA = "GGA"
+	RMC = "RMC"
+	VTG = "VTG"
+	GSA = "GSA"
+	GSV = "GSV"
+	ZDA = "ZDA"
+)
+
+const (
+	knotsPerMeterSecond = 1.943844
+	kmhPerMeterSecond   = 3.6
+	defaultTalker       = "GP"
+	maxGSVSatellites    = 4
+)
+
+// DefaultSentences is the default set of sentences emitted per device state.
+var DefaultSentences = []string{RMC, GGA, GSA, GSV, VTG, ZDA}
+
+// Encoder converts device states into NMEA 0183 sentences.
+// Time is taken from the caller since pb.Device carries no wall time.
+// A device in offline mode is reported with an invalid fix.
+type Encoder struct {
+	// Talker is the talker ID of the sentences. Default "GP".
+	Talker string
+
+	// Sentences is the ordered set of sentences emitted by Encode. Default DefaultSentences.
+	Sentences []string
+}
+
+// NewEncoder creates a new Encoder with the default talker and sentences.
+func NewEncoder() *Encoder {
+	return &Encoder{
+		Talker:    defaultTalker,
+		Sentences: DefaultSentences,
+	}
+}
+
+// Encode appends the configured sentences for the device state to dst.
+// Each sentence is terminated by CRLF.
+func (e *Encoder) Encode(dst []byte, t time.Time, dev *pb.Device) ([]byte, error) {
+	sentences := e.Sentences
+	if len(sentences) == 0 {
+		sentences = DefaultSentences
+	}
+	for i := 0; i < len(sentences); i++ {
+		var err error
+		dst, err = e.Append(dst, sentences[i], t, dev)
+		if err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// Append appends the sentences of the given type for the device state to dst.
+// GSV may produce several sentences.
+func (e *Encoder) Append(dst []byte, typ string, t time.Time, dev *pb.Device) ([]byte, error) {
+	t = t.UTC()
+	talker := e.Talker
+	if len(talker) == 0 {
+		talker = defaultTalker
+	}
+	switch typ {
+	case GGA:
+		return appendSentence(dst, talker+GGA, gga(t, dev)), nil
+	case RMC:
+		return appendSentence(dst, talker+RMC, rmc(t, dev)), nil
+	case VTG:
+		return appendSentence(dst, talker+VTG, vtg(dev)), nil
+	case GSA:
+		return appendSentence(dst, talker+GSA, gsa(dev)), nil
+	case GSV:
+		msgs := gsv(dev)
+		for i := 0; i < len(msgs); i++ {
+			dst = appendSentence(dst, talker+GSV, msgs[i])
+		}
+		return dst, nil
+	case ZDA:
+		return appendSentence(dst, talker+ZDA, zda(t)), nil
+	default:
+		return dst, fmt.Errorf("gpsgen/nmea: unsupported sentence %q", typ)
+	}
+}
+
+// Checksum returns the XOR checksum of the sentence body,
+// the characters between '$' and '*'.
+func Checksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
+
+func appendSentence(dst []byte, id string, fields []string) []byte {
+	start := len(dst)
+	dst = append(dst, '$')
+	dst = append(dst, id...)
+	for i := 0; i < len(fields); i++ {
+		dst = append(dst, ',')
+		dst = append(dst, fields[i]...)
+	}
+	sum := Checksum(string(dst[start+1:]))
+	dst = append(dst, '*')
+	dst = append(dst, fmt.Sprintf("%02X", sum)...)
+	return append(dst, '\r', '\n')
+}
+
+func isValid(dev *pb.Device) bool {
+	return dev.GetLocation() != nil && !dev.IsOffline
+}
+
+func gga(t time.Time, dev *pb.Device) []string {
+	loc := dev.GetLocation()
+	lat, ns := formatLat(loc.GetLat())
+	lon, ew := formatLon(loc.GetLon())
+	quality, sats, hdop := "0", "00", ""
+	if isValid(dev) {
+		quality, sats, hdop = "1", fmt.Sprintf("%02d", len(constellation)), formatDOP(HDOP)
+	}
+	return []string{
+		formatTime(t),
+		lat, ns,
+		lon, ew,
+		quality,
+		sats,
+		hdop,
+		formatFloat(loc.GetElevation(), 1), "M",
+		"0.0", "M",
+		"", "",
+	}
+}
+
+func rmc(t time.Time, dev *pb.Device) []string {
+	loc := dev.GetLocation()
+	lat, ns := formatLat(loc.GetLat())
+	lon, ew := formatLon(loc.GetLon())
+	status, mode := "V", "N"
+	if isValid(dev) {
+		status, mode = "A", "A"
+	}
+	return []string{
+		formatTime(t),
+		status,
+		lat, ns,
+		lon, ew,
+		formatFloat(dev.Speed*knotsPerMeterSecond, 1),
+		formatFloat(loc.GetBearing(), 1),
+		t.Format("020106"),
+		"", "",
+		mode,
+	}
+}
+
+func vtg(dev *pb.Device) []string {
+	mode := "N"
+	if isValid(dev) {
+		mode = "A"
+	}
+	return []string{
+		formatFloat(dev.GetLocation().GetBearing(), 1), "T",
+		"", "M",
+		formatFloat(dev.Speed*knotsPerMeterSecond, 1), "N",
+		formatFloat(dev.Speed*kmhPerMeterSecond, 1), "K",
+		mode,
+	}
+}
+
+func gsa(dev *pb.Device) []string {
+	fields := make([]string, 0, 17)
+	fields = append(fields, "A")
+	if !isValid(dev) {
+		fields = append(fields, "1")
+		for i := 0; i < 12; i++ {
+			fields = append(fields, "")
+		}
+		return append(fields, "", "", "")
+	}
+	fields = append(fields, "3")
+	for i := 0; i < 12; i++ {
+		if i < len(constellation) {
+			fields = append(fields, fmt.Sprintf("%02d", constellation[i].PRN))
+		} else {
+			fields = append(fields, "")
+		}
+	}
+	return append(fields, formatDOP(PDOP), formatDOP(HDOP), formatDOP(VDOP))
+}
+
+func gsv(dev *pb.Device) [][]string {
+	valid := isValid(dev)
+	total := (len(constellation) + maxGSVSatellites - 1) / maxGSVSatellites
+	msgs := make([][]string, 0, total)
+	for n := 0; n < total; n++ {
+		fields := []string{
+			strconv.Itoa(total),
+			strconv.Itoa(n + 1),
+			fmt.Sprintf("%02d", len(constellation)),
+		}
+		for i := n * maxGSVSatellites; i < (n+1)*maxGSVSatellites && i < len(constellation); i++ {
+			sat := constellation[i]
+			snr := ""
+			if valid {
+				snr = fmt.Sprintf("%02d", sat.SNR)
+			}
+			fields = append(fields,
+				fmt.Sprintf("%02d", sat.PRN),
+				fmt.Sprintf("%02d", sat.Elevation),
+				fmt.Sprintf("%03d", sat.Azimuth),
+				snr,
+			)
+		}
+		msgs = append(msgs, fields)
+	}
+	return msgs
+}
+
+func zda(t time.Time) []string {
+	return []string{
+		formatTime(t),
+		fmt.Sprintf("%02d", t.Day()),
+		fmt.Sprintf("%02d", int(t.Month())),
+		fmt.Sprintf("%04d", t.Year()),
+		"00", "00",
+	}
+}
+
+func formatDOP(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func formatTime(t time.Time) string {
+	return fmt.Sprintf("%02d%02d%02d.%02d", t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e7)
+}
+
+func formatLat(lat float64) (string, string) {
+	hemi := "N"
+	if lat < 0 {
+		hemi = "S"
+	}
+	deg, min := degMin(lat)
+	return fmt.Sprintf("%02d%08.5f", deg, min), hemi
+}
+
+func formatLon(lon float64) (string, string) {
+	hemi := "E"
+	if lon < 0 {
+		hemi = "W"
+	}
+	deg, min := degMin(lon)
+	return fmt.Sprintf("%03d%08.5f", deg, min), hemi
+}
+
+func degMin(v float64) (int, float64) {
+	v = math.Abs(v)
+	deg := math.Floor(v)
+	min := (v - deg) * 60
+	// avoid 60.00000 minutes after rounding
+	if min >= 59.999995 {
+		deg++
+		min = 0
+	}
+	return int(deg), min
+}
+
+func formatFloat(v float64, prec int) string {
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
@@ -0,0 +1,117 @@
+package nmea
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "dev1",
+		Speed:     11.5,
+		IsOffline: offline,
+		Location: &pb.Device_Location{
+			Lat:       48.1173,
+			Lon:       -11.516666666,
+			Elevation: 545.4,
+			Bearing:   84.4,
+		},
+	}
+}
+
+func lines(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n")
+}
+
+func requireChecksum(t *testing.T, sentence string) {
+	require.True(t, strings.HasPrefix(sentence, "$"))
+	i := strings.LastIndexByte(sentence, '*')
+	require.Greater(t, i, 0)
+	require.Equal(t, fmt.Sprintf("%02X", Checksum(sentence[1:i])), sentence[i+1:])
+}
+
+func TestChecksum(t *testing.T) {
+	body := "GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,"
+	require.Equal(t, byte(0x47), Checksum(body))
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	data, err := NewEncoder().Encode(nil, testTime, testDevice(false))
+	require.NoError(t, err)
+	got := lines(data)
+	require.Len(t, got, 7)
+	for i := 0; i < len(got); i++ {
+		requireChecksum(t, got[i])
+	}
+	require.True(t, strings.HasPrefix(got[0],
+		"$GPRMC,123519.00,A,4807.03800,N,01131.00000,W,22.4,84.4,230323,,,A*"))
+	require.True(t, strings.HasPrefix(got[1],
+		"$GPGGA,123519.00,4807.03800,N,01131.00000,W,1,08,0.9,545.4,M,0.0,M,,*"))
+	require.True(t, strings.HasPrefix(got[2], "$GPGSA,A,3,02,05,08,11,14,17,20,23,,,,,1.5,0.9,1.2*"))
+	require.True(t, strings.HasPrefix(got[3], "$GPGSV,2,1,08,02,"))
+	require.True(t, strings.HasPrefix(got[4], "$GPGSV,2,2,08,14,"))
+	require.True(t, strings.HasPrefix(got[5], "$GPVTG,84.4,T,,M,22.4,N,41.4,K,A*"))
+	require.True(t, strings.HasPrefix(got[6], "$GPZDA,123519.00,23,03,2023,00,00*"))
+}
+
+func TestEncoder_Offline(t *testing.T) {
+	enc := &Encoder{Talker: "GN", Sentences: []string{RMC, GGA, GSA}}
+	data, err := enc.Encode(nil, testTime, testDevice(true))
+	require.NoError(t, err)
+	got := lines(data)
+	require.Len(t, got, 3)
+	require.True(t, strings.HasPrefix(got[0], "$GNRMC,123519.00,V,"))
+	require.True(t, strings.HasSuffix(strings.Split(got[0], "*")[0], ",N"))
+	require.Contains(t, got[1], ",W,0,00,,")
+	require.True(t, strings.HasPrefix(got[2], "$GNGSA,A,1,"))
+
+	_, err = enc.Append(nil, "XXX", testTime, testDevice(false))
+	require.Error(t, err)
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	streams := make(map[string]*closeBuffer)
+	sink := NewSink(&Encoder{Sentences: []string{RMC}}, func(id string) (io.Writer, error) {
+		streams[id] = new(closeBuffer)
+		return streams[id], nil
+	})
+
+	dev2 := testDevice(false)
+	dev2.Id = "dev2"
+	pck := &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices:   []*pb.Device{testDevice(false), dev2},
+	}
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.Len(t, streams, 2)
+	for _, stream := range streams {
+		got := lines(stream.Bytes())
+		require.Len(t, got, 2)
+		require.True(t, strings.HasPrefix(got[0], "$GPRMC,123519.00,A,"))
+	}
+
+	require.NoError(t, sink.Close())
+	require.True(t, streams["dev1"].closed)
+	require.True(t, streams["dev2"].closed)
+}
@@ -0,0 +1,94 @@
+package nmea
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Sink writes an NMEA stream per device.
+// It implements the gpsgen.Sink interface.
+type Sink struct {
+	mu      sync.Mutex
+	enc     *Encoder
+	open    func(deviceID string) (io.Writer, error)
+	writers map[string]io.Writer
+	buf     []byte
+}
+
+// NewSink creates a new Sink. The open function is called once per device
+// to obtain the writer of its stream, e.g. a file or a serial port.
+// If open returns a nil writer, the device is skipped.
+// If enc is nil, NewEncoder is used.
+func NewSink(enc *Encoder, open func(deviceID string) (io.Writer, error)) *Sink {
+	if enc == nil {
+		enc = NewEncoder()
+	}
+	return &Sink{
+		enc:     enc,
+		open:    open,
+		writers: make(map[string]io.Writer),
+	}
+}
+
+// Write writes the sentences of every device of the packet to the device stream.
+// The packet timestamp is used as the fix time.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	for i := 0; i < len(pck.Devices); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		w, ok := s.writers[dev.Id]
+		if !ok {
+			var err error
+			w, err = s.open(dev.Id)
+			if err != nil {
+				return err
+			}
+			s.writers[dev.Id] = w
+		}
+		if w == nil {
+			continue
+		}
+		data, err := s.enc.Encode(s.buf[:0], t, dev)
+		if err != nil {
+			return err
+		}
+		s.buf = data
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the device writers that implement io.Closer.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for id, w := range s.writers {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delete(s.writers, id)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// DefaultTimeout is the default timeout of dialing and writing a message.
+const DefaultTimeout = 10 * time.Second
+
+// ErrUnsupportedNetwork is returned by Dial for networks other than TCP and UDP.
+var ErrUnsupportedNetwork = errors.New("gpsgen/protocol: unsupported network")
+
+// EncodeFunc appends the message of the device state at time t to dst.
+type EncodeFunc func(dst []byte, t time.Time, dev *pb.Device) []byte
+
+// Client sends the messages of a text protocol over TCP or UDP.
+// Messages are not acknowledged.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// Dial connects to the server. The network is "tcp" or "udp".
+// If timeout is zero, DefaultTimeout is used.
+func Dial(ctx context.Context, network, addr string, timeout time.Duration) (*Client, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return nil, ErrUnsupportedNetwork
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, timeout: timeout}, nil
+}
+
+// Send writes the message. Over UDP every message is a datagram.
+func (c *Client) Send(ctx context.Context, msg []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetWriteDeadline(deadline)
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Sink sends every device of a packet as a message of a text protocol,
+// one connection per device. Devices are sent as the generator emits them,
+// so every device keeps its own interval. Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	devices *DeviceSink
+}
+
+// NewSink creates a new Sink sending the messages produced by encode.
+func NewSink(network, addr string, timeout time.Duration, encode EncodeFunc) *Sink {
+	dial := func(ctx context.Context, _ string) (DeviceConn, error) {
+		c, err := Dial(ctx, network, addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &textConn{Client: c, encode: encode}, nil
+	}
+	return &Sink{devices: NewDeviceSink(dial, DefaultConcurrency)}
+}
+
+// Write sends the devices of the packet concurrently, each over its own connection.
+// The packet timestamp is used as the fix time. A device connection that fails
+// is closed and dialed again by the next Write.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	return s.devices.Write(ctx, pck)
+}
+
+// Close closes the device connections.
+func (s *Sink) Close() error {
+	return s.devices.Close()
+}
+
+// textConn sends the messages of a single device.
+type textConn struct {
+	*Client
+	encode EncodeFunc
+	buf    []byte
+}
+
+func (c *textConn) SendDevice(ctx context.Context, t time.Time, dev *pb.Device) error {
+	c.buf = c.encode(c.buf[:0], t, dev)
+	return c.Send(ctx, c.buf)
+}
@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeID(dst []byte, t time.Time, dev *pb.Device) []byte {
+	dst = append(dst, dev.Id...)
+	dst = append(dst, ' ')
+	dst = t.UTC().AppendFormat(dst, time.RFC3339)
+	return append(dst, '\n')
+}
+
+func testPacket() *pb.Packet {
+	return &pb.Packet{
+		Timestamp: time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC).Unix(),
+		Devices:   []*pb.Device{{Id: "dev1"}, {Id: "dev2"}},
+	}
+}
+
+func TestSink_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	lines := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	sink := NewSink("tcp", ln.Addr().String(), 0, encodeID)
+	require.NoError(t, sink.Write(context.Background(), testPacket()))
+	require.NoError(t, sink.Write(context.Background(), testPacket()))
+	require.NoError(t, sink.Close())
+	got := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		got[<-lines]++
+	}
+	require.Equal(t, map[string]int{
+		"dev1 2023-03-23T12:35:19Z": 2,
+		"dev2 2023-03-23T12:35:19Z": 2,
+	}, got)
+}
+
+func TestSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink := NewSink("udp", conn.LocalAddr().String(), time.Second, encodeID)
+	require.NoError(t, sink.Write(context.Background(), testPacket()))
+	defer sink.Close()
+
+	buf := make([]byte, 128)
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		got[string(buf[:n])] = true
+	}
+	require.True(t, got["dev1 2023-03-23T12:35:19Z\n"])
+	require.True(t, got["dev2 2023-03-23T12:35:19Z\n"])
+
+	_, err = Dial(context.Background(), "unix", "/tmp/x", 0)
+	require.ErrorIs(t, err, ErrUnsupportedNetwork)
+}
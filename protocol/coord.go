@@ -0,0 +1,25 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+)
+
+// FormatDegMin formats the absolute value of a coordinate in degrees and
+// decimal minutes, e.g. DDMM.MMMM for a latitude (width 2, precision 4)
+// and DDDMM.MMMM for a longitude (width 3, precision 4).
+func FormatDegMin(v float64, width, prec int) string {
+	scale := math.Pow10(prec)
+	minutes := math.Round(math.Abs(v)*60*scale) / scale
+	deg := math.Floor(minutes / 60)
+	minutes -= deg * 60
+	return fmt.Sprintf("%0*d%0*.*f", width, int(deg), prec+3, prec, minutes)
+}
+
+// Hemisphere returns the hemisphere letter of a coordinate: pos for values >= 0, neg otherwise.
+func Hemisphere(v float64, pos, neg byte) byte {
+	if v < 0 {
+		return neg
+	}
+	return pos
+}
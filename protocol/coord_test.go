@@ -0,0 +1,16 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatDegMin(t *testing.T) {
+	require.Equal(t, "2240.5518", FormatDegMin(22.67586333, 2, 4))
+	require.Equal(t, "11358.3239", FormatDegMin(113.97206483, 3, 4))
+	require.Equal(t, "01131.0000", FormatDegMin(-11.516666666, 3, 4))
+	require.Equal(t, "4900.0000", FormatDegMin(48.9999999, 2, 4))
+	require.Equal(t, byte('S'), Hemisphere(-0.1, 'N', 'S'))
+	require.Equal(t, byte('E'), Hemisphere(0, 'E', 'W'))
+}
@@ -0,0 +1,194 @@
+package gt06
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+// DefaultTimeout is the default timeout of dialing, writing and waiting for a response.
+const DefaultTimeout = 10 * time.Second
+
+// ErrNoResponse is returned when the server answers with an unexpected packet.
+var ErrNoResponse = errors.New("gpsgen/gt06: unexpected server response")
+
+// ClientOptions defines the options of a Client.
+type ClientOptions struct {
+	// IMEI is the IMEI sent in the login packet.
+	IMEI string
+
+	// Protocol is the location protocol. Default ProtocolLocation.
+	Protocol byte
+
+	// Cell is the base station reported by the terminal.
+	Cell Cell
+
+	// Timeout limits dialing, writing a packet and waiting for its response.
+	// Default DefaultTimeout.
+	Timeout time.Duration
+
+	// OnMessage is called with the packets sent by the server other than
+	// the responses, e.g. commands. It is called while a response is awaited.
+	OnMessage func(p *Packet)
+}
+
+// Client is a TCP client of a GT06 server.
+// Login, heartbeat and alarm packets wait for the server response;
+// location packets are not acknowledged by the protocol.
+type Client struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	enc       *Encoder
+	timeout   time.Duration
+	onMessage func(p *Packet)
+	buf       []byte
+}
+
+// Dial connects to the server and logs in with the IMEI.
+func Dial(ctx context.Context, addr string, opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = new(ClientOptions)
+	}
+	c := &Client{
+		enc:       &Encoder{Protocol: opts.Protocol, Cell: opts.Cell},
+		timeout:   opts.Timeout,
+		onMessage: opts.OnMessage,
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	data, err := c.enc.AppendLogin(nil, opts.IMEI)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	if err := c.roundTrip(ctx, data, ProtocolLogin); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// SendLocation sends the location of the device state at time t.
+func (c *Client) SendLocation(ctx context.Context, t time.Time, dev *pb.Device) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = c.enc.AppendLocation(c.buf[:0], t, dev)
+	return c.write(ctx, c.buf)
+}
+
+// SendHeartbeat sends the terminal status of the device and waits for the response.
+func (c *Client) SendHeartbeat(ctx context.Context, dev *pb.Device) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = c.enc.AppendHeartbeat(c.buf[:0], dev)
+	return c.roundTrip(ctx, c.buf, ProtocolHeartbeat)
+}
+
+// SendAlarm sends the alarm with the device state at time t and waits for the response.
+func (c *Client) SendAlarm(ctx context.Context, t time.Time, dev *pb.Device, alarm Alarm) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = c.enc.AppendAlarm(c.buf[:0], t, dev, alarm)
+	return c.roundTrip(ctx, c.buf, ProtocolAlarm)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) write(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.setDeadline(ctx)
+	_, err := c.conn.Write(data)
+	return err
+}
+
+// roundTrip writes the packet and reads until the response with the same serial number.
+func (c *Client) roundTrip(ctx context.Context, data []byte, protocol byte) error {
+	if err := c.write(ctx, data); err != nil {
+		return err
+	}
+	serial := c.enc.Serial()
+	for {
+		p, err := ReadPacket(c.conn)
+		if err != nil {
+			return err
+		}
+		if p.Protocol == protocol && p.Serial == serial {
+			return nil
+		}
+		if p.Protocol == protocol {
+			return fmt.Errorf("%w: serial %d, want %d", ErrNoResponse, p.Serial, serial)
+		}
+		if c.onMessage != nil {
+			c.onMessage(p)
+		}
+	}
+}
+
+func (c *Client) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetDeadline(deadline)
+}
+
+// SendDevice sends the device state at time t: a location packet
+// if the device has a fix and a heartbeat if it is in offline mode.
+func (c *Client) SendDevice(ctx context.Context, t time.Time, dev *pb.Device) error {
+	if isValid(dev) {
+		return c.SendLocation(ctx, t, dev)
+	}
+	return c.SendHeartbeat(ctx, dev)
+}
+
+// Sink sends the devices of every packet to a GT06 server, one connection
+// per device. The IMEI of a device is derived from its ID with protocol.IMEI.
+// Devices with a fix are sent as location packets, devices in offline mode
+// as heartbeats. Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	devices *protocol.DeviceSink
+}
+
+// NewSink creates a new Sink. The IMEI of opts is ignored.
+func NewSink(addr string, opts *ClientOptions) *Sink {
+	var o ClientOptions
+	if opts != nil {
+		o = *opts
+	}
+	dial := func(ctx context.Context, deviceID string) (protocol.DeviceConn, error) {
+		opts := o
+		opts.IMEI = protocol.IMEI(deviceID)
+		return Dial(ctx, addr, &opts)
+	}
+	return &Sink{devices: protocol.NewDeviceSink(dial, protocol.DefaultConcurrency)}
+}
+
+// Write sends the devices of the packet concurrently, each over its own connection.
+// The packet timestamp is used as the fix time. A device connection that fails
+// is closed and dialed again by the next Write.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	return s.devices.Write(ctx, pck)
+}
+
+// Close closes the device connections.
+func (s *Sink) Close() error {
+	return s.devices.Close()
+}
@@ -0,0 +1,115 @@
+package gt06
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+type session struct {
+	imei    string
+	packets []*Packet
+}
+
+// serve runs a server that answers login, heartbeat and alarm packets.
+// A command is sent before every heartbeat response.
+func serve(t *testing.T) (string, <-chan session) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan session, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var s session
+				defer func() { sessions <- s }()
+				for {
+					p, err := ReadPacket(conn)
+					if err != nil {
+						return
+					}
+					s.packets = append(s.packets, p)
+					switch p.Protocol {
+					case ProtocolLogin:
+						s.imei, _ = p.IMEI()
+					case ProtocolHeartbeat:
+						_, _ = conn.Write(appendPacket(nil, ProtocolCommand, []byte("STATUS#"), 7))
+					case ProtocolAlarm:
+					default:
+						continue
+					}
+					_, _ = conn.Write(AppendResponse(nil, p.Protocol, p.Serial))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func TestClient(t *testing.T) {
+	addr, sessions := serve(t)
+	ctx := context.Background()
+
+	var commands []*Packet
+	c, err := Dial(ctx, addr, &ClientOptions{
+		IMEI:      "356307042441013",
+		Protocol:  ProtocolLocation22,
+		OnMessage: func(p *Packet) { commands = append(commands, p) },
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.SendLocation(ctx, testTime, testDevice(false)))
+	require.NoError(t, c.SendHeartbeat(ctx, testDevice(false)))
+	require.NoError(t, c.SendAlarm(ctx, testTime, testDevice(false), AlarmOverSpeed))
+	require.NoError(t, c.Close())
+
+	s := <-sessions
+	require.Equal(t, "356307042441013", s.imei)
+	require.Len(t, s.packets, 4)
+	require.Equal(t, ProtocolLocation22, s.packets[1].Protocol)
+	for i := 0; i < len(s.packets); i++ {
+		require.Equal(t, uint16(i+1), s.packets[i].Serial)
+	}
+	require.Len(t, commands, 1)
+	require.Equal(t, []byte("STATUS#"), commands[0].Content)
+
+	_, err = Dial(ctx, addr, &ClientOptions{IMEI: "imei"})
+	require.ErrorIs(t, err, ErrInvalidIMEI)
+}
+
+func TestSink(t *testing.T) {
+	addr, sessions := serve(t)
+	sink := NewSink(addr, nil)
+	pck := &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices:   []*pb.Device{testDevice(false), testDevice(false)},
+	}
+	pck.Devices[1].Id = "dev2"
+	ctx := context.Background()
+	require.NoError(t, sink.Write(ctx, pck))
+	pck.Devices[0].IsOffline = true
+	pck.Devices[1].IsOffline = true
+	require.NoError(t, sink.Write(ctx, pck))
+	require.NoError(t, sink.Close())
+
+	imeis := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		s := <-sessions
+		imeis[s.imei] = true
+		require.Len(t, s.packets, 3)
+		require.Equal(t, ProtocolLocation, s.packets[1].Protocol)
+		require.Equal(t, ProtocolHeartbeat, s.packets[2].Protocol)
+	}
+	require.Equal(t, map[string]bool{
+		protocol.IMEI("dev1"): true,
+		protocol.IMEI("dev2"): true,
+	}, imeis)
+}
@@ -0,0 +1,230 @@
+package gt06
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Alarm is the alarm type of an alarm packet.
+type Alarm byte
+
+// Alarm types.
+const (
+	AlarmNormal     Alarm = 0x00
+	AlarmSOS        Alarm = 0x01
+	AlarmPowerCut   Alarm = 0x02
+	AlarmVibration  Alarm = 0x03
+	AlarmEnterFence Alarm = 0x04
+	AlarmExitFence  Alarm = 0x05
+	AlarmOverSpeed  Alarm = 0x06
+	AlarmMoved      Alarm = 0x09
+	AlarmLowBattery Alarm = 0x0E
+)
+
+// Course and status bits of the GPS part.
+const (
+	statusPositioned = 1 << 12
+	statusWest       = 1 << 11
+	statusNorth      = 1 << 10
+)
+
+// Terminal information bits.
+const (
+	terminalACC      = 1 << 1
+	terminalTracking = 1 << 6
+)
+
+const (
+	numSatellites = 8
+	kmhPerMS      = 3.6
+	languageEN    = 0x02
+	gsmStrong     = 4
+	gsmWeak       = 1
+	lbsLength     = 9
+)
+
+// Cell is the base station reported in the LBS part of location and alarm packets.
+type Cell struct {
+	MCC    uint16
+	MNC    byte
+	LAC    uint16
+	CellID uint32
+}
+
+// Encoder builds the packets of a terminal.
+// Every packet gets the next serial number, so an Encoder
+// must be used by one connection only.
+type Encoder struct {
+	// Protocol is the location protocol: ProtocolLocation or ProtocolLocation22.
+	// Default ProtocolLocation.
+	Protocol byte
+
+	// Cell is the base station of the terminal.
+	Cell Cell
+
+	serial uint16
+	buf    []byte
+}
+
+// NewEncoder creates a new Encoder of ProtocolLocation packets.
+func NewEncoder() *Encoder {
+	return &Encoder{Protocol: ProtocolLocation}
+}
+
+// Serial returns the serial number of the last packet.
+func (e *Encoder) Serial() uint16 {
+	return e.serial
+}
+
+// AppendLogin appends the login packet with the IMEI to dst.
+func (e *Encoder) AppendLogin(dst []byte, imei string) ([]byte, error) {
+	if len(imei) == 0 || len(imei) > 2*imeiBCDSize {
+		return dst, ErrInvalidIMEI
+	}
+	var digits [2 * imeiBCDSize]byte
+	offset := len(digits) - len(imei)
+	for i := 0; i < len(imei); i++ {
+		if imei[i] < '0' || imei[i] > '9' {
+			return dst, ErrInvalidIMEI
+		}
+		digits[offset+i] = imei[i] - '0'
+	}
+	content := e.content()
+	for i := 0; i < imeiBCDSize; i++ {
+		content = append(content, digits[2*i]<<4|digits[2*i+1])
+	}
+	return e.appendPacket(dst, ProtocolLogin, content), nil
+}
+
+// AppendLocation appends the location packet of the device state at time t to dst.
+// A device in offline mode is reported as not positioned.
+func (e *Encoder) AppendLocation(dst []byte, t time.Time, dev *pb.Device) []byte {
+	protocol := e.Protocol
+	if protocol != ProtocolLocation22 {
+		protocol = ProtocolLocation
+	}
+	content := e.appendGPS(e.content(), t, dev)
+	content = e.appendCell(content)
+	if protocol == ProtocolLocation22 {
+		var acc byte
+		if isValid(dev) && dev.Speed > 0 {
+			acc = 1
+		}
+		// ACC, upload mode (by interval) and real-time upload.
+		content = append(content, acc, 0x00, 0x00)
+	}
+	return e.appendPacket(dst, protocol, content)
+}
+
+// AppendHeartbeat appends the heartbeat packet with the terminal status of the device to dst.
+func (e *Encoder) AppendHeartbeat(dst []byte, dev *pb.Device) []byte {
+	content := e.appendStatus(e.content(), dev, AlarmNormal)
+	return e.appendPacket(dst, ProtocolHeartbeat, content)
+}
+
+// AppendAlarm appends the alarm packet of the device state at time t to dst.
+func (e *Encoder) AppendAlarm(dst []byte, t time.Time, dev *pb.Device, alarm Alarm) []byte {
+	content := e.appendGPS(e.content(), t, dev)
+	content = append(content, lbsLength)
+	content = e.appendCell(content)
+	content = e.appendStatus(content, dev, alarm)
+	return e.appendPacket(dst, ProtocolAlarm, content)
+}
+
+func (e *Encoder) content() []byte {
+	return e.buf[:0]
+}
+
+func (e *Encoder) appendPacket(dst []byte, protocol byte, content []byte) []byte {
+	e.buf = content
+	e.serial++
+	return appendPacket(dst, protocol, content, e.serial)
+}
+
+func (e *Encoder) appendGPS(dst []byte, t time.Time, dev *pb.Device) []byte {
+	t = t.UTC()
+	dst = append(dst,
+		byte(t.Year()%100), byte(t.Month()), byte(t.Day()),
+		byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+
+	var lat, lon, bearing float64
+	if loc := dev.Location; loc != nil {
+		lat, lon, bearing = loc.Lat, loc.Lon, loc.Bearing
+	}
+	var sats, speed byte
+	status := uint16(math.Round(bearing)) % 360
+	if isValid(dev) {
+		sats = numSatellites
+		speed = byte(math.Min(math.Round(dev.Speed*kmhPerMS), math.MaxUint8))
+		status |= statusPositioned
+	}
+	if lat >= 0 {
+		status |= statusNorth
+	}
+	if lon < 0 {
+		status |= statusWest
+	}
+	dst = append(dst, 0xC0|sats)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(math.Round(math.Abs(lat)*coordScale)))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(math.Round(math.Abs(lon)*coordScale)))
+	dst = append(dst, speed)
+	return binary.BigEndian.AppendUint16(dst, status)
+}
+
+func (e *Encoder) appendCell(dst []byte) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, e.Cell.MCC)
+	dst = append(dst, e.Cell.MNC)
+	dst = binary.BigEndian.AppendUint16(dst, e.Cell.LAC)
+	return append(dst, byte(e.Cell.CellID>>16), byte(e.Cell.CellID>>8), byte(e.Cell.CellID))
+}
+
+// appendStatus appends the terminal information, voltage level,
+// GSM signal strength and alarm/language bytes.
+func (e *Encoder) appendStatus(dst []byte, dev *pb.Device, alarm Alarm) []byte {
+	var info byte
+	gsm := byte(gsmWeak)
+	if isValid(dev) {
+		info |= terminalTracking
+		gsm = gsmStrong
+		if dev.Speed > 0 {
+			info |= terminalACC
+		}
+	}
+	info |= terminalAlarm(alarm) << 3
+	return append(dst, info, voltageLevel(dev), gsm, byte(alarm), languageEN)
+}
+
+// terminalAlarm returns the alarm bits of the terminal information.
+func terminalAlarm(alarm Alarm) byte {
+	switch alarm {
+	case AlarmSOS:
+		return 0b100
+	case AlarmLowBattery:
+		return 0b011
+	case AlarmPowerCut:
+		return 0b010
+	case AlarmVibration:
+		return 0b001
+	}
+	return 0
+}
+
+// voltageLevel maps the battery charge to the levels 0 (no power) to 6 (very high).
+// A device without a battery is reported as externally powered.
+func voltageLevel(dev *pb.Device) byte {
+	if dev.Battery == nil {
+		return 6
+	}
+	charge := dev.Battery.Charge
+	if charge <= 0 {
+		return 0
+	}
+	return byte(math.Min(1+charge/100*5, 6))
+}
+
+func isValid(dev *pb.Device) bool {
+	return !dev.IsOffline && dev.Location != nil
+}
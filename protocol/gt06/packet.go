@@ -0,0 +1,191 @@
+// Package gt06 implements the GT06 (Concox) binary protocol of GPS trackers.
+package gt06
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Protocol numbers.
+const (
+	ProtocolLogin      byte = 0x01
+	ProtocolLocation   byte = 0x12
+	ProtocolHeartbeat  byte = 0x13
+	ProtocolAlarm      byte = 0x16
+	ProtocolLocation22 byte = 0x22
+	ProtocolCommand    byte = 0x80
+)
+
+const (
+	startShort  = 0x7878
+	startLong   = 0x7979
+	stopBits    = 0x0D0A
+	coordScale  = 60 * 30000
+	frameExtra  = 2 + 1 + 2 // start, length and stop bits
+	imeiBCDSize = 8
+)
+
+var (
+	ErrInvalidPacket = errors.New("gpsgen/gt06: invalid packet")
+	ErrChecksum      = errors.New("gpsgen/gt06: checksum mismatch")
+	ErrInvalidIMEI   = errors.New("gpsgen/gt06: invalid IMEI")
+)
+
+// Packet is a decoded GT06 packet.
+type Packet struct {
+	Protocol byte
+	Content  []byte
+	Serial   uint16
+}
+
+// Location is the GPS part of a location or alarm packet.
+type Location struct {
+	Time       time.Time
+	Satellites int
+	Lat        float64
+	Lon        float64
+	Speed      int // km/h
+	Course     int // degrees from north
+	Positioned bool
+}
+
+// IMEI returns the IMEI of a login packet.
+func (p *Packet) IMEI() (string, error) {
+	if p.Protocol != ProtocolLogin || len(p.Content) < imeiBCDSize {
+		return "", ErrInvalidPacket
+	}
+	var imei [2 * imeiBCDSize]byte
+	for i := 0; i < imeiBCDSize; i++ {
+		imei[2*i] = '0' + p.Content[i]>>4
+		imei[2*i+1] = '0' + p.Content[i]&0x0F
+	}
+	return string(imei[1:]), nil
+}
+
+// Location returns the GPS part of a location or alarm packet.
+func (p *Packet) Location() (Location, error) {
+	switch p.Protocol {
+	case ProtocolLocation, ProtocolLocation22, ProtocolAlarm:
+	default:
+		return Location{}, ErrInvalidPacket
+	}
+	c := p.Content
+	if len(c) < 18 {
+		return Location{}, ErrInvalidPacket
+	}
+	loc := Location{
+		Time: time.Date(2000+int(c[0]), time.Month(c[1]), int(c[2]),
+			int(c[3]), int(c[4]), int(c[5]), 0, time.UTC),
+		Satellites: int(c[6] & 0x0F),
+		Lat:        float64(binary.BigEndian.Uint32(c[7:])) / coordScale,
+		Lon:        float64(binary.BigEndian.Uint32(c[11:])) / coordScale,
+		Speed:      int(c[15]),
+	}
+	status := binary.BigEndian.Uint16(c[16:])
+	loc.Course = int(status & 0x03FF)
+	loc.Positioned = status&statusPositioned != 0
+	if status&statusNorth == 0 {
+		loc.Lat = -loc.Lat
+	}
+	if status&statusWest != 0 {
+		loc.Lon = -loc.Lon
+	}
+	return loc, nil
+}
+
+// AppendResponse appends the server response to the packet with the protocol and serial number to dst.
+func AppendResponse(dst []byte, protocol byte, serial uint16) []byte {
+	return appendPacket(dst, protocol, nil, serial)
+}
+
+// Decode decodes a GT06 packet including the start and stop bits.
+func Decode(data []byte) (*Packet, error) {
+	if len(data) < frameExtra+5 {
+		return nil, ErrInvalidPacket
+	}
+	var body []byte
+	switch binary.BigEndian.Uint16(data) {
+	case startShort:
+		body = data[3 : len(data)-2]
+		if int(data[2]) != len(body) {
+			return nil, ErrInvalidPacket
+		}
+	case startLong:
+		body = data[4 : len(data)-2]
+		if int(binary.BigEndian.Uint16(data[2:])) != len(body) {
+			return nil, ErrInvalidPacket
+		}
+	default:
+		return nil, ErrInvalidPacket
+	}
+	if binary.BigEndian.Uint16(data[len(data)-2:]) != stopBits || len(body) < 5 {
+		return nil, ErrInvalidPacket
+	}
+	crc := binary.BigEndian.Uint16(body[len(body)-2:])
+	if CRC16(data[2:len(data)-4]) != crc {
+		return nil, ErrChecksum
+	}
+	return &Packet{
+		Protocol: body[0],
+		Content:  append([]byte(nil), body[1:len(body)-4]...),
+		Serial:   binary.BigEndian.Uint16(body[len(body)-4:]),
+	}, nil
+}
+
+// ReadPacket reads and decodes a GT06 packet.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:3]); err != nil {
+		return nil, err
+	}
+	var frame []byte
+	switch binary.BigEndian.Uint16(head[:]) {
+	case startShort:
+		frame = make([]byte, 3+int(head[2])+2)
+		copy(frame, head[:3])
+		if _, err := io.ReadFull(r, frame[3:]); err != nil {
+			return nil, err
+		}
+	case startLong:
+		if _, err := io.ReadFull(r, head[3:]); err != nil {
+			return nil, err
+		}
+		frame = make([]byte, 4+int(binary.BigEndian.Uint16(head[2:]))+2)
+		copy(frame, head[:])
+		if _, err := io.ReadFull(r, frame[4:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidPacket
+	}
+	return Decode(frame)
+}
+
+// CRC16 returns the CRC-ITU (CRC-16/X-25) checksum of the data.
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// appendPacket appends a short packet with the content to dst.
+func appendPacket(dst []byte, protocol byte, content []byte, serial uint16) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, startShort)
+	start := len(dst)
+	dst = append(dst, byte(1+len(content)+4), protocol)
+	dst = append(dst, content...)
+	dst = binary.BigEndian.AppendUint16(dst, serial)
+	dst = binary.BigEndian.AppendUint16(dst, CRC16(dst[start:]))
+	return binary.BigEndian.AppendUint16(dst, stopBits)
+}
@@ -0,0 +1,118 @@
+package gt06
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "dev1",
+		Speed:     11.5,
+		IsOffline: offline,
+		Battery:   &pb.Device_Battery{Charge: 50},
+		Location: &pb.Device_Location{
+			Lat:     -48.1173,
+			Lon:     -11.516666,
+			Bearing: 84.4,
+		},
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	require.Equal(t, uint16(0x906E), CRC16([]byte("123456789")))
+}
+
+func TestEncoder_Login(t *testing.T) {
+	enc := NewEncoder()
+	data, err := enc.AppendLogin(nil, "123456789012345")
+	require.NoError(t, err)
+	require.Equal(t, "78780d01012345678901234500018cdd0d0a", hex.EncodeToString(data))
+	require.Equal(t, uint16(1), enc.Serial())
+
+	p, err := Decode(data)
+	require.NoError(t, err)
+	imei, err := p.IMEI()
+	require.NoError(t, err)
+	require.Equal(t, "123456789012345", imei)
+
+	_, err = enc.AppendLogin(nil, "12345678901234x")
+	require.ErrorIs(t, err, ErrInvalidIMEI)
+
+	data[len(data)-3]++
+	_, err = Decode(data)
+	require.ErrorIs(t, err, ErrChecksum)
+}
+
+func TestEncoder_Location(t *testing.T) {
+	for _, protocol := range []byte{ProtocolLocation, ProtocolLocation22} {
+		enc := &Encoder{
+			Protocol: protocol,
+			Cell:     Cell{MCC: 460, MNC: 1, LAC: 0x2866, CellID: 0x1F4D},
+		}
+		data := enc.AppendLocation(nil, testTime, testDevice(false))
+		data = enc.AppendLocation(data, testTime, testDevice(true))
+
+		r := bytes.NewReader(data)
+		p, err := ReadPacket(r)
+		require.NoError(t, err)
+		require.Equal(t, protocol, p.Protocol)
+		require.Equal(t, uint16(1), p.Serial)
+		loc, err := p.Location()
+		require.NoError(t, err)
+		require.Equal(t, Location{
+			Time:       testTime,
+			Satellites: 8,
+			Lat:        loc.Lat,
+			Lon:        loc.Lon,
+			Speed:      41,
+			Course:     84,
+			Positioned: true,
+		}, loc)
+		require.InDelta(t, -48.1173, loc.Lat, 1e-6)
+		require.InDelta(t, -11.516666, loc.Lon, 1e-6)
+		// MCC, MNC, LAC and cell ID follow the GPS part.
+		require.Equal(t, []byte{0x01, 0xCC, 0x01, 0x28, 0x66, 0x00, 0x1F, 0x4D}, p.Content[18:26])
+		if protocol == ProtocolLocation22 {
+			require.Equal(t, []byte{1, 0, 0}, p.Content[26:])
+		}
+
+		p, err = ReadPacket(r)
+		require.NoError(t, err)
+		require.Equal(t, uint16(2), p.Serial)
+		loc, err = p.Location()
+		require.NoError(t, err)
+		require.False(t, loc.Positioned)
+		require.Zero(t, loc.Satellites)
+		require.Zero(t, loc.Speed)
+	}
+}
+
+func TestEncoder_Status(t *testing.T) {
+	enc := NewEncoder()
+	p, err := Decode(enc.AppendHeartbeat(nil, testDevice(false)))
+	require.NoError(t, err)
+	require.Equal(t, ProtocolHeartbeat, p.Protocol)
+	require.Equal(t, []byte{0x42, 3, 4, 0, 2}, p.Content)
+
+	p, err = Decode(enc.AppendAlarm(nil, testTime, testDevice(true), AlarmSOS))
+	require.NoError(t, err)
+	require.Equal(t, ProtocolAlarm, p.Protocol)
+	require.Equal(t, uint16(2), p.Serial)
+	require.Equal(t, byte(lbsLength), p.Content[18])
+	require.Equal(t, []byte{0x20, 3, 1, byte(AlarmSOS), 2}, p.Content[27:])
+	loc, err := p.Location()
+	require.NoError(t, err)
+	require.True(t, testTime.Equal(loc.Time))
+
+	_, err = p.IMEI()
+	require.ErrorIs(t, err, ErrInvalidPacket)
+	require.Equal(t, "787805130001e9f10d0a", hex.EncodeToString(AppendResponse(nil, ProtocolHeartbeat, 1)))
+}
@@ -0,0 +1,105 @@
+// Package h02 implements the H02 text protocol of GPS trackers:
+//
+//	*HQ,865205030330012,V1,145452,A,2240.5518,N,11358.3239,E,0.00,0,100815,FFFFFBFF#
+package h02
+
+import (
+	"strconv"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+const (
+	// DefaultStatus is the status word of a terminal without active signals.
+	DefaultStatus uint32 = 0xFFFFFFFF
+
+	knotsPerMS = 1.943844
+)
+
+// Encoder converts device states into V1 location messages.
+type Encoder struct {
+	// Manufacturer is the manufacturer code after the start mark. Default "HQ".
+	Manufacturer string
+
+	// Status maps sensor names to bits (0-31) of the status word.
+	// H02 status bits are active low: the bit of a sensor with a non-zero
+	// value is cleared.
+	Status map[string]uint
+}
+
+// NewEncoder creates a new Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{Manufacturer: "HQ"}
+}
+
+// Append appends the V1 message of the device state at time t to dst.
+// The terminal ID is the IMEI derived from the device ID with protocol.IMEI.
+// A device in offline mode is reported with the invalid flag V.
+func (e *Encoder) Append(dst []byte, t time.Time, dev *pb.Device) []byte {
+	manufacturer := e.Manufacturer
+	if len(manufacturer) == 0 {
+		manufacturer = "HQ"
+	}
+	t = t.UTC()
+	var lat, lon, bearing float64
+	if loc := dev.Location; loc != nil {
+		lat, lon, bearing = loc.Lat, loc.Lon, loc.Bearing
+	}
+	valid := byte('A')
+	speed := dev.Speed * knotsPerMS
+	if dev.IsOffline || dev.Location == nil {
+		valid, speed = 'V', 0
+	}
+
+	dst = append(dst, '*')
+	dst = append(dst, manufacturer...)
+	dst = append(dst, ',')
+	dst = append(dst, protocol.IMEI(dev.Id)...)
+	dst = append(dst, ",V1,"...)
+	dst = t.AppendFormat(dst, "150405")
+	dst = append(dst, ',', valid, ',')
+	dst = append(dst, protocol.FormatDegMin(lat, 2, 4)...)
+	dst = append(dst, ',', protocol.Hemisphere(lat, 'N', 'S'), ',')
+	dst = append(dst, protocol.FormatDegMin(lon, 3, 4)...)
+	dst = append(dst, ',', protocol.Hemisphere(lon, 'E', 'W'), ',')
+	dst = strconv.AppendFloat(dst, speed, 'f', 2, 64)
+	dst = append(dst, ',')
+	dst = strconv.AppendInt(dst, int64(bearing+0.5)%360, 10)
+	dst = append(dst, ',')
+	dst = t.AppendFormat(dst, "020106")
+	dst = append(dst, ',')
+	dst = appendHex(dst, e.status(dev))
+	return append(dst, '#')
+}
+
+func (e *Encoder) status(dev *pb.Device) uint32 {
+	status := DefaultStatus
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		bit, ok := e.Status[sensor.Name]
+		if !ok || bit > 31 || sensor.ValY == 0 {
+			continue
+		}
+		status &^= 1 << bit
+	}
+	return status
+}
+
+func appendHex(dst []byte, v uint32) []byte {
+	const digits = "0123456789ABCDEF"
+	for shift := 28; shift >= 0; shift -= 4 {
+		dst = append(dst, digits[v>>uint(shift)&0x0F])
+	}
+	return dst
+}
+
+// NewSink creates a Sink sending the devices as H02 messages over the network, "tcp" or "udp".
+// If enc is nil, NewEncoder is used.
+func NewSink(network, addr string, enc *Encoder, timeout time.Duration) *protocol.Sink {
+	if enc == nil {
+		enc = NewEncoder()
+	}
+	return protocol.NewSink(network, addr, timeout, enc.Append)
+}
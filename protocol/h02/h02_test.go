@@ -0,0 +1,58 @@
+package h02
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2015, 8, 10, 14, 54, 52, 0, time.UTC)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "865205030330012",
+		Speed:     1.5,
+		IsOffline: offline,
+		Location: &pb.Device_Location{
+			Lat:     22.67586333,
+			Lon:     -113.97206483,
+			Bearing: 84.6,
+		},
+		Sensors: []*pb.Device_Sensor{
+			{Name: "door", ValX: 0, ValY: 1},
+			{Name: "sos", ValX: 1, ValY: 0},
+		},
+	}
+}
+
+func TestEncoder_Append(t *testing.T) {
+	enc := NewEncoder()
+	enc.Status = map[string]uint{"door": 10, "sos": 1}
+	got := string(enc.Append(nil, testTime, testDevice(false)))
+	require.Equal(t, "*HQ,865205030330012,V1,145452,A,2240.5518,N,11358.3239,W,2.92,85,100815,FFFFFBFF#", got)
+
+	got = string((&Encoder{}).Append(nil, testTime, testDevice(true)))
+	require.Equal(t, "*HQ,865205030330012,V1,145452,V,2240.5518,N,11358.3239,W,0.00,85,100815,FFFFFFFF#", got)
+}
+
+func TestSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink := NewSink("udp", conn.LocalAddr().String(), nil, time.Second)
+	defer sink.Close()
+	pck := &pb.Packet{Timestamp: testTime.Unix(), Devices: []*pb.Device{{Id: "dev1"}}}
+	require.NoError(t, sink.Write(context.Background(), pck))
+
+	buf := make([]byte, 256)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "*HQ,"+protocol.IMEI("dev1")+",V1,145452,V,0000.0000,N,00000.0000,E,0.00,0,100815,FFFFFFFF#", string(buf[:n]))
+}
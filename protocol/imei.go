@@ -0,0 +1,53 @@
+// Package protocol contains the helpers shared by the telematics protocol packages.
+package protocol
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+const imeiLen = 15
+
+// IMEI returns the IMEI reported for the device.
+// A device ID of 15 digits is used as is. Any other ID is hashed
+// into a stable 15-digit IMEI with a valid Luhn check digit.
+func IMEI(deviceID string) string {
+	if isIMEI(deviceID) {
+		return deviceID
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(deviceID))
+	body := strconv.FormatUint(h.Sum64()%1e14, 10)
+	for len(body) < imeiLen-1 {
+		body = "0" + body
+	}
+	return body + string(rune('0'+luhn(body)))
+}
+
+func isIMEI(s string) bool {
+	if len(s) != imeiLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn returns the check digit of the digits.
+func luhn(digits string) int {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
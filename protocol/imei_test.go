@@ -0,0 +1,19 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIMEI(t *testing.T) {
+	require.Equal(t, "356307042441013", IMEI("356307042441013"))
+	require.Equal(t, 8, luhn("49015420323751"))
+
+	imei := IMEI("7c5b1f38-2a6b-4b7d-9a0e-1a4f9f1d6b20")
+	require.Len(t, imei, 15)
+	require.True(t, isIMEI(imei))
+	require.Equal(t, imei, IMEI("7c5b1f38-2a6b-4b7d-9a0e-1a4f9f1d6b20"))
+	require.Equal(t, int(imei[14]-'0'), luhn(imei[:14]))
+	require.NotEqual(t, imei, IMEI("dev2"))
+}
@@ -0,0 +1,255 @@
+// Package osmand implements the OsmAnd HTTP position protocol accepted by Traccar.
+package osmand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+const (
+	// DefaultConcurrency is the default number of concurrent requests.
+	DefaultConcurrency = 16
+
+	// DefaultRetries is the default number of retries of a failed request.
+	DefaultRetries = 2
+
+	// DefaultRetryDelay is the default delay before the first retry.
+	// The delay doubles with every retry.
+	DefaultRetryDelay = 500 * time.Millisecond
+
+	// DefaultTimeout is the default timeout of a request.
+	DefaultTimeout = 10 * time.Second
+
+	knotsPerMS = 1.943844
+)
+
+var ErrStatus = errors.New("gpsgen/osmand: unexpected response status")
+
+// Parameters of a position request.
+const (
+	ParamID        = "id"
+	ParamTimestamp = "timestamp"
+	ParamLat       = "lat"
+	ParamLon       = "lon"
+	ParamSpeed     = "speed"
+	ParamBearing   = "bearing"
+	ParamAltitude  = "altitude"
+	ParamBattery   = "batt"
+	ParamValid     = "valid"
+)
+
+// Options defines the options of a Sink.
+type Options struct {
+	// URL is the endpoint of the server, e.g. http://localhost:5055/.
+	URL string
+
+	// Method is http.MethodGet (default) or http.MethodPost.
+	// GET sends the parameters in the query, POST as a form.
+	Method string
+
+	// Client is the HTTP client. By default a client with a connection pool
+	// of Concurrency connections and DefaultTimeout is used.
+	Client *http.Client
+
+	// Concurrency limits the number of requests in flight. Default DefaultConcurrency.
+	Concurrency int
+
+	// Retries is the number of retries of a request that failed with a network error
+	// or a 5xx or 429 status. Default DefaultRetries; a negative value disables retries.
+	Retries int
+
+	// RetryDelay is the delay before the first retry. Default DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// Sink sends every device of a packet as an OsmAnd position request.
+// Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	url        string
+	method     string
+	client     *http.Client
+	ownClient  bool
+	sem        chan struct{}
+	retries    int
+	retryDelay time.Duration
+}
+
+// NewSink creates a new Sink.
+func NewSink(opts *Options) (*Sink, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	if _, err := url.ParseRequestURI(opts.URL); err != nil {
+		return nil, fmt.Errorf("gpsgen/osmand: invalid URL: %w", err)
+	}
+	s := &Sink{
+		url:        opts.URL,
+		method:     strings.ToUpper(opts.Method),
+		client:     opts.Client,
+		retries:    opts.Retries,
+		retryDelay: opts.RetryDelay,
+	}
+	switch s.method {
+	case "":
+		s.method = http.MethodGet
+	case http.MethodGet, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("gpsgen/osmand: unsupported method %s", opts.Method)
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	s.sem = make(chan struct{}, concurrency)
+	if s.client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = concurrency
+		transport.MaxConnsPerHost = concurrency
+		s.client = &http.Client{Transport: transport, Timeout: DefaultTimeout}
+		s.ownClient = true
+	}
+	if s.retries == 0 {
+		s.retries = DefaultRetries
+	}
+	if s.retryDelay <= 0 {
+		s.retryDelay = DefaultRetryDelay
+	}
+	return s, nil
+}
+
+// Params returns the request parameters of the device state at time t.
+// Speed is converted to knots. Sensors are sent as extra parameters named after
+// the sensor; a sensor named like a standard parameter is skipped.
+func Params(t time.Time, dev *pb.Device) url.Values {
+	params := url.Values{}
+	params.Set(ParamID, dev.Id)
+	params.Set(ParamTimestamp, strconv.FormatInt(t.Unix(), 10))
+	if loc := dev.Location; loc != nil {
+		params.Set(ParamLat, formatFloat(loc.Lat))
+		params.Set(ParamLon, formatFloat(loc.Lon))
+		params.Set(ParamBearing, formatFloat(loc.Bearing))
+		params.Set(ParamAltitude, formatFloat(loc.Elevation))
+	}
+	params.Set(ParamSpeed, formatFloat(dev.Speed*knotsPerMS))
+	if dev.Battery != nil {
+		params.Set(ParamBattery, formatFloat(dev.Battery.Charge))
+	}
+	params.Set(ParamValid, strconv.FormatBool(!dev.IsOffline && dev.Location != nil))
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		if len(sensor.Name) == 0 || params.Has(sensor.Name) {
+			continue
+		}
+		params.Set(sensor.Name, formatFloat(sensor.ValY))
+	}
+	return params
+}
+
+// Write sends the devices of the packet concurrently.
+// The packet timestamp is used as the fix time.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	errs := make([]error, len(pck.Devices))
+	var wg sync.WaitGroup
+	for i := 0; i < len(pck.Devices); i++ {
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		params := Params(t, dev)
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-s.sem
+				wg.Done()
+			}()
+			errs[i] = s.send(ctx, params)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes the idle connections of the default client.
+func (s *Sink) Close() error {
+	if s.ownClient {
+		s.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// send sends the request and retries it on temporary failures.
+func (s *Sink) send(ctx context.Context, params url.Values) error {
+	delay := s.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.do(ctx, params)
+		if err == nil || !retry || attempt >= s.retries {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// do sends the request once and reports whether a failure is worth a retry.
+func (s *Sink) do(ctx context.Context, params url.Values) (bool, error) {
+	var req *http.Request
+	var err error
+	if s.method == http.MethodPost {
+		req, err = http.NewRequestWithContext(ctx, s.method, s.url, strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, s.method, s.url, nil)
+		if err == nil && len(req.URL.RawQuery) > 0 {
+			req.URL.RawQuery += "&" + params.Encode()
+		} else if err == nil {
+			req.URL.RawQuery = params.Encode()
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,146 @@
+package osmand
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+func testDevice(id string) *pb.Device {
+	return &pb.Device{
+		Id:      id,
+		Speed:   10,
+		Battery: &pb.Device_Battery{Charge: 87.5},
+		Location: &pb.Device_Location{
+			Lat:       48.1173,
+			Lon:       -11.5166,
+			Elevation: 545.4,
+			Bearing:   84.4,
+		},
+		Sensors: []*pb.Device_Sensor{
+			{Name: "temperature", ValX: 0.25, ValY: -12.5},
+			{Name: "lat", ValX: 0.5, ValY: 1},
+		},
+	}
+}
+
+func TestParams(t *testing.T) {
+	params := Params(testTime, testDevice("dev1"))
+	require.Equal(t, url.Values{
+		"id":          {"dev1"},
+		"timestamp":   {"1679574919"},
+		"lat":         {"48.1173"},
+		"lon":         {"-11.5166"},
+		"speed":       {"19.43844"},
+		"bearing":     {"84.4"},
+		"altitude":    {"545.4"},
+		"batt":        {"87.5"},
+		"valid":       {"true"},
+		"temperature": {"-12.5"},
+	}, params)
+
+	dev := &pb.Device{Id: "dev2", IsOffline: true}
+	params = Params(testTime, dev)
+	require.Equal(t, "false", params.Get(ParamValid))
+	require.False(t, params.Has(ParamLat))
+}
+
+type server struct {
+	mu       sync.Mutex
+	requests []url.Values
+	inFlight int32
+	maxIn    int32
+	fail     map[string]int
+	status   int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxIn)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxIn, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	_ = r.ParseForm()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.Form.Get(ParamID)
+	if s.fail[id] > 0 {
+		s.fail[id]--
+		w.WriteHeader(s.status)
+		return
+	}
+	s.requests = append(s.requests, r.Form)
+}
+
+func testPacket(n int) *pb.Packet {
+	pck := &pb.Packet{Timestamp: testTime.Unix()}
+	for i := 0; i < n; i++ {
+		pck.Devices = append(pck.Devices, testDevice(fmt.Sprintf("dev%d", i)))
+	}
+	return pck
+}
+
+func TestSink(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		srv := &server{fail: map[string]int{"dev3": 2}, status: http.StatusServiceUnavailable}
+		ts := httptest.NewServer(srv)
+		sink, err := NewSink(&Options{
+			URL:         ts.URL + "/?key=secret",
+			Method:      method,
+			Concurrency: 4,
+			RetryDelay:  time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, sink.Write(context.Background(), testPacket(12)))
+		require.NoError(t, sink.Close())
+		ts.Close()
+
+		require.Len(t, srv.requests, 12)
+		require.LessOrEqual(t, srv.maxIn, int32(4))
+		require.Equal(t, "secret", srv.requests[0].Get("key"))
+		require.Equal(t, "1679574919", srv.requests[0].Get(ParamTimestamp))
+	}
+}
+
+func TestSink_Errors(t *testing.T) {
+	srv := &server{fail: map[string]int{"dev0": 5, "dev1": 1}, status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	sink, err := NewSink(&Options{URL: ts.URL, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	err = sink.Write(context.Background(), testPacket(3))
+	require.ErrorIs(t, err, ErrStatus)
+	require.Len(t, srv.requests, 2)
+	require.Equal(t, 5-(1+DefaultRetries), srv.fail["dev0"])
+
+	srv.fail = map[string]int{"dev0": 1}
+	srv.status = http.StatusBadRequest
+	srv.requests = nil
+	sink, err = NewSink(&Options{URL: ts.URL, Retries: -1})
+	require.NoError(t, err)
+	err = sink.Write(context.Background(), testPacket(1))
+	require.ErrorIs(t, err, ErrStatus)
+	require.Empty(t, srv.requests)
+
+	_, err = NewSink(&Options{URL: "localhost"})
+	require.Error(t, err)
+	_, err = NewSink(&Options{URL: ts.URL, Method: http.MethodPut})
+	require.Error(t, err)
+}
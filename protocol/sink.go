@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// DefaultConcurrency is the default number of devices a DeviceSink sends at a time.
+const DefaultConcurrency = 16
+
+// DeviceConn is the connection of a single device.
+type DeviceConn interface {
+	// SendDevice sends the device state at time t.
+	SendDevice(ctx context.Context, t time.Time, dev *pb.Device) error
+
+	// Close closes the connection.
+	Close() error
+}
+
+// DialFunc opens the connection of the device.
+type DialFunc func(ctx context.Context, deviceID string) (DeviceConn, error)
+
+// DeviceSink sends every device of a packet over its own connection.
+// Devices are sent concurrently, at most concurrency at a time,
+// while the states of a device are sent in the order they were written.
+// A connection that fails is closed and dialed again by the next write
+// of the device. DeviceSink implements the gpsgen.Sink interface.
+type DeviceSink struct {
+	mu      sync.Mutex
+	dial    DialFunc
+	sem     chan struct{}
+	devices map[string]*deviceConn
+}
+
+type deviceConn struct {
+	mu   sync.Mutex
+	conn DeviceConn
+}
+
+// NewDeviceSink creates a new DeviceSink that opens the device connections with dial.
+// If concurrency is zero, DefaultConcurrency is used.
+func NewDeviceSink(dial DialFunc, concurrency int) *DeviceSink {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	return &DeviceSink{
+		dial:    dial,
+		sem:     make(chan struct{}, concurrency),
+		devices: make(map[string]*deviceConn),
+	}
+}
+
+// Write sends the devices of the packet. The packet timestamp is used as the fix time.
+func (s *DeviceSink) Write(ctx context.Context, pck *pb.Packet) error {
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	return s.Send(ctx, t, pck.Devices)
+}
+
+// Send sends the device states at time t and waits until all of them are sent.
+// A failing device does not stop the others; the errors of all devices are joined.
+func (s *DeviceSink) Send(ctx context.Context, t time.Time, devices []*pb.Device) error {
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i := 0; i < len(devices); i++ {
+		dev := devices[i]
+		if dev == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		d := s.device(dev.Id)
+		// the device lock is taken in packet order and released by the sender,
+		// so the states of a device never overtake each other
+		d.mu.Lock()
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			d.mu.Unlock()
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-s.sem
+				d.mu.Unlock()
+				wg.Done()
+			}()
+			errs[i] = s.send(ctx, d, t, dev)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes the device connections.
+func (s *DeviceSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for id, d := range s.devices {
+		d.mu.Lock()
+		if d.conn != nil {
+			if err := d.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			d.conn = nil
+		}
+		d.mu.Unlock()
+		delete(s.devices, id)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *DeviceSink) device(deviceID string) *deviceConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok {
+		d = new(deviceConn)
+		s.devices[deviceID] = d
+	}
+	return d
+}
+
+// send sends the device state over its connection, dialing it if necessary.
+// It is called with the device lock held.
+func (s *DeviceSink) send(ctx context.Context, d *deviceConn, t time.Time, dev *pb.Device) error {
+	if d.conn == nil {
+		conn, err := s.dial(ctx, dev.Id)
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+	if err := d.conn.SendDevice(ctx, t, dev); err != nil {
+		_ = d.conn.Close()
+		d.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	fail   bool
+	mu     *sync.Mutex
+	sent   map[string][]int64
+	active *int32
+	peak   *int32
+}
+
+func (c *fakeConn) SendDevice(_ context.Context, t time.Time, dev *pb.Device) error {
+	n := atomic.AddInt32(c.active, 1)
+	defer atomic.AddInt32(c.active, -1)
+	for {
+		peak := atomic.LoadInt32(c.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(c.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if c.fail {
+		return errors.New("send failed")
+	}
+	c.mu.Lock()
+	c.sent[dev.Id] = append(c.sent[dev.Id], t.Unix())
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func TestDeviceSink(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		active int32
+		peak   int32
+		dials  int32
+	)
+	sent := make(map[string][]int64)
+	dial := func(_ context.Context, deviceID string) (DeviceConn, error) {
+		atomic.AddInt32(&dials, 1)
+		if deviceID == "nodial" {
+			return nil, errors.New("dial failed")
+		}
+		return &fakeConn{
+			fail:   deviceID == "fail",
+			mu:     &mu,
+			sent:   sent,
+			active: &active,
+			peak:   &peak,
+		}, nil
+	}
+	sink := NewDeviceSink(dial, 2)
+
+	ids := []string{"dev1", "fail", "dev2", "nodial", "dev3"}
+	for ts := int64(1); ts <= 3; ts++ {
+		pck := &pb.Packet{Timestamp: ts}
+		for _, id := range ids {
+			pck.Devices = append(pck.Devices, &pb.Device{Id: id})
+		}
+		err := sink.Write(context.Background(), pck)
+		require.Error(t, err)
+		require.ErrorContains(t, err, "send failed")
+		require.ErrorContains(t, err, "dial failed")
+	}
+	require.NoError(t, sink.Close())
+
+	require.LessOrEqual(t, peak, int32(2))
+	// dev1, dev2 and dev3 are dialed once, fail and nodial on every write
+	require.Equal(t, int32(3+2*3), dials)
+	for _, id := range []string{"dev1", "dev2", "dev3"} {
+		require.Equal(t, []int64{1, 2, 3}, sent[id])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink = NewDeviceSink(dial, 0)
+	err := sink.Write(ctx, &pb.Packet{Devices: []*pb.Device{{Id: "dev1"}}})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,182 @@
+package teltonika
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+// DefaultTimeout is the default timeout of dialing, writing and waiting for an acknowledgement.
+const DefaultTimeout = 10 * time.Second
+
+var (
+	ErrRejected        = errors.New("gpsgen/teltonika: IMEI rejected by server")
+	ErrNotAcknowledged = errors.New("gpsgen/teltonika: records not acknowledged")
+)
+
+// ClientOptions defines the options of a Client.
+type ClientOptions struct {
+	// IMEI is the IMEI sent in the handshake.
+	IMEI string
+
+	// Encoder encodes the packets. Default NewEncoder.
+	Encoder *Encoder
+
+	// Timeout limits dialing, writing a packet and waiting for its acknowledgement.
+	// Default DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Client is a TCP client of a Teltonika server.
+// Every packet sent is confirmed by the server with the number of accepted records.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	enc     *Encoder
+	timeout time.Duration
+	buf     []byte
+}
+
+// Dial connects to the server and performs the IMEI handshake.
+func Dial(ctx context.Context, addr string, opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = new(ClientOptions)
+	}
+	c := &Client{
+		enc:     opts.Encoder,
+		timeout: opts.Timeout,
+	}
+	if c.enc == nil {
+		c.enc = NewEncoder()
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	if err := c.handshake(ctx, opts.IMEI); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) handshake(ctx context.Context, imei string) error {
+	c.setDeadline(ctx)
+	if _, err := c.conn.Write(AppendIMEI(nil, imei)); err != nil {
+		return err
+	}
+	var ack [1]byte
+	if _, err := io.ReadFull(c.conn, ack[:]); err != nil {
+		return err
+	}
+	if ack[0] != 1 {
+		return ErrRejected
+	}
+	return nil
+}
+
+// Send sends the records and waits until the server acknowledges them.
+// Records are split into packets of at most MaxRecords.
+func (c *Client) Send(ctx context.Context, records ...Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(records) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := len(records)
+		if n > MaxRecords {
+			n = MaxRecords
+		}
+		if err := c.send(ctx, records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// SendDevice sends the device state at time t as a single record.
+func (c *Client) SendDevice(ctx context.Context, t time.Time, dev *pb.Device) error {
+	return c.Send(ctx, c.enc.Record(t, dev))
+}
+
+func (c *Client) send(ctx context.Context, records []Record) error {
+	data, err := c.enc.Encode(c.buf[:0], records)
+	if err != nil {
+		return err
+	}
+	c.buf = data
+	c.setDeadline(ctx)
+	if _, err := c.conn.Write(data); err != nil {
+		return err
+	}
+	var ack [4]byte
+	if _, err := io.ReadFull(c.conn, ack[:]); err != nil {
+		return err
+	}
+	if n := binary.BigEndian.Uint32(ack[:]); n != uint32(len(records)) {
+		return fmt.Errorf("%w: %d of %d", ErrNotAcknowledged, n, len(records))
+	}
+	return nil
+}
+
+func (c *Client) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetDeadline(deadline)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Sink sends the devices of every packet to a Teltonika server,
+// one connection per device. The IMEI of a device is derived from its ID
+// with protocol.IMEI. Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	devices *protocol.DeviceSink
+}
+
+// NewSink creates a new Sink. The IMEI of opts is ignored.
+func NewSink(addr string, opts *ClientOptions) *Sink {
+	var o ClientOptions
+	if opts != nil {
+		o = *opts
+	}
+	dial := func(ctx context.Context, deviceID string) (protocol.DeviceConn, error) {
+		opts := o
+		opts.IMEI = protocol.IMEI(deviceID)
+		return Dial(ctx, addr, &opts)
+	}
+	return &Sink{devices: protocol.NewDeviceSink(dial, protocol.DefaultConcurrency)}
+}
+
+// Write sends the devices of the packet concurrently, each over its own connection.
+// The packet timestamp is used as the record time. A device connection that fails
+// is closed and dialed again by the next Write.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	return s.devices.Write(ctx, pck)
+}
+
+// Close closes the device connections.
+func (s *Sink) Close() error {
+	return s.devices.Close()
+}
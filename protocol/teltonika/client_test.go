@@ -0,0 +1,118 @@
+package teltonika
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+type session struct {
+	imei    string
+	packets []*Packet
+}
+
+// serve runs a server that accepts every IMEI except "000000000000000"
+// and acknowledges all but the records of the reject count.
+func serve(t *testing.T, reject int) (string, <-chan session) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan session, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var s session
+				defer func() { sessions <- s }()
+				if s.imei, err = ReadIMEI(conn); err != nil {
+					return
+				}
+				if s.imei == "000000000000000" {
+					_, _ = conn.Write([]byte{0})
+					return
+				}
+				_, _ = conn.Write([]byte{1})
+				for {
+					pck, err := ReadPacket(conn)
+					if err != nil {
+						return
+					}
+					s.packets = append(s.packets, pck)
+					_, _ = conn.Write(binary.BigEndian.AppendUint32(nil, uint32(len(pck.Records)-reject)))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func TestClient(t *testing.T) {
+	addr, sessions := serve(t, 0)
+	ctx := context.Background()
+
+	c, err := Dial(ctx, addr, &ClientOptions{IMEI: "356307042441013", Encoder: &Encoder{Codec: Codec8E}})
+	require.NoError(t, err)
+	require.NoError(t, c.SendDevice(ctx, testTime, testDevice(false)))
+	records := make([]Record, MaxRecords+1)
+	for i := 0; i < len(records); i++ {
+		records[i] = Record{Time: testTime.Add(time.Duration(i) * time.Second)}
+	}
+	require.NoError(t, c.Send(ctx, records...))
+	require.NoError(t, c.Close())
+
+	s := <-sessions
+	require.Equal(t, "356307042441013", s.imei)
+	require.Len(t, s.packets, 3)
+	require.Equal(t, Codec8E, s.packets[0].Codec)
+	require.Len(t, s.packets[1].Records, MaxRecords)
+	require.Len(t, s.packets[2].Records, 1)
+
+	_, err = Dial(ctx, addr, &ClientOptions{IMEI: "000000000000000"})
+	require.ErrorIs(t, err, ErrRejected)
+}
+
+func TestClient_NotAcknowledged(t *testing.T) {
+	addr, _ := serve(t, 1)
+	ctx := context.Background()
+	c, err := Dial(ctx, addr, &ClientOptions{IMEI: "356307042441013"})
+	require.NoError(t, err)
+	defer c.Close()
+	err = c.Send(ctx, Record{Time: testTime}, Record{Time: testTime})
+	require.ErrorIs(t, err, ErrNotAcknowledged)
+}
+
+func TestSink(t *testing.T) {
+	addr, sessions := serve(t, 0)
+	sink := NewSink(addr, nil)
+	dev2 := testDevice(false)
+	dev2.Id = "dev2"
+	pck := &pb.Packet{
+		Timestamp: testTime.Unix(),
+		Devices:   []*pb.Device{testDevice(false), dev2},
+	}
+	ctx := context.Background()
+	require.NoError(t, sink.Write(ctx, pck))
+	require.NoError(t, sink.Write(ctx, pck))
+	require.NoError(t, sink.Close())
+
+	got := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		s := <-sessions
+		got[s.imei] = len(s.packets)
+		require.True(t, testTime.Equal(s.packets[0].Records[0].Time))
+	}
+	require.Equal(t, map[string]int{
+		protocol.IMEI("dev1"): 2,
+		protocol.IMEI("dev2"): 2,
+	}, got)
+}
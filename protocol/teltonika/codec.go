@@ -0,0 +1,464 @@
+// Package teltonika implements the Teltonika Codec 8 and Codec 8 Extended
+// AVL protocol used by the FMB device family.
+package teltonika
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// Codec IDs.
+const (
+	Codec8  byte = 0x08
+	Codec8E byte = 0x8E
+)
+
+// Record priorities.
+const (
+	PriorityLow   byte = 0
+	PriorityHigh  byte = 1
+	PriorityPanic byte = 2
+)
+
+// IO element IDs reported for every record.
+const (
+	IOGNSSStatus   uint16 = 69
+	IOBatteryLevel uint16 = 113
+	IOMovement     uint16 = 240
+)
+
+// MaxRecords is the maximum number of records in a packet.
+const MaxRecords = 255
+
+// MaxPacketSize is the maximum size of the data field accepted by ReadPacket.
+const MaxPacketSize = 1 << 16
+
+const (
+	headerSize    = 8
+	numSatellites = 8
+	kmhPerMS      = 3.6
+	coordScale    = 1e7
+)
+
+var (
+	ErrInvalidPacket = errors.New("gpsgen/teltonika: invalid packet")
+	ErrChecksum      = errors.New("gpsgen/teltonika: checksum mismatch")
+	ErrInvalidRecord = errors.New("gpsgen/teltonika: invalid record")
+	ErrUnknownCodec  = errors.New("gpsgen/teltonika: unknown codec")
+)
+
+// IOElement is an IO element of an AVL record.
+// Fixed-size values are held in Value; the variable-length values
+// of Codec 8 Extended are held in Data.
+type IOElement struct {
+	ID uint16
+
+	// Size is the size of Value in bytes: 1, 2, 4 or 8.
+	// Any other size marks a variable-length element.
+	Size int
+
+	Value uint64
+	Data  []byte
+}
+
+// Int returns the value as a signed integer.
+func (e IOElement) Int() int64 {
+	switch e.Size {
+	case 1:
+		return int64(int8(e.Value))
+	case 2:
+		return int64(int16(e.Value))
+	case 4:
+		return int64(int32(e.Value))
+	}
+	return int64(e.Value)
+}
+
+// Record is an AVL data record.
+type Record struct {
+	Time       time.Time
+	Priority   byte
+	Lon        float64
+	Lat        float64
+	Altitude   int16  // meters
+	Angle      uint16 // degrees from north
+	Satellites byte
+	Speed      uint16 // km/h
+	EventID    uint16
+	IO         []IOElement
+}
+
+// Element returns the IO element with the given ID.
+func (r *Record) Element(id uint16) (IOElement, bool) {
+	for i := 0; i < len(r.IO); i++ {
+		if r.IO[i].ID == id {
+			return r.IO[i], true
+		}
+	}
+	return IOElement{}, false
+}
+
+// Packet is a decoded AVL data packet.
+type Packet struct {
+	Codec   byte
+	Records []Record
+}
+
+// IOMapping maps a device sensor to an IO element.
+type IOMapping struct {
+	ID uint16
+
+	// Size is the size of the value in bytes: 1, 2, 4 or 8. Default 4.
+	Size int
+
+	// Scale is applied to the sensor value before rounding. Default 1.
+	Scale float64
+}
+
+// Encoder converts device states into AVL records and packets.
+type Encoder struct {
+	// Codec is Codec8 or Codec8E. Default Codec8.
+	Codec byte
+
+	// Priority is the priority of the records.
+	Priority byte
+
+	// IO maps sensor names to IO elements. Unmapped sensors are not reported.
+	IO map[string]IOMapping
+}
+
+// NewEncoder creates a new Codec 8 Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{Codec: Codec8}
+}
+
+// Record converts the device state at time t into an AVL record.
+// A device in offline mode is reported without satellites and speed.
+func (e *Encoder) Record(t time.Time, dev *pb.Device) Record {
+	rec := Record{
+		Time:     t,
+		Priority: e.Priority,
+	}
+	valid := !dev.IsOffline && dev.Location != nil
+	if loc := dev.Location; loc != nil {
+		rec.Lon = loc.Lon
+		rec.Lat = loc.Lat
+		rec.Altitude = int16(clamp(math.Round(loc.Elevation), math.MinInt16, math.MaxInt16))
+		rec.Angle = uint16(math.Round(loc.Bearing)) % 360
+	}
+	gnss, moving := uint64(2), uint64(0)
+	if valid {
+		rec.Satellites = numSatellites
+		rec.Speed = uint16(clamp(math.Round(dev.Speed*kmhPerMS), 0, math.MaxUint16))
+		gnss = 1
+		if rec.Speed > 0 {
+			moving = 1
+		}
+	}
+	rec.IO = append(rec.IO,
+		IOElement{ID: IOGNSSStatus, Size: 1, Value: gnss},
+		IOElement{ID: IOMovement, Size: 1, Value: moving},
+	)
+	if dev.Battery != nil {
+		level := clamp(math.Round(dev.Battery.Charge), 0, 100)
+		rec.IO = append(rec.IO, IOElement{ID: IOBatteryLevel, Size: 1, Value: uint64(level)})
+	}
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		m, ok := e.IO[sensor.Name]
+		if !ok {
+			continue
+		}
+		size, scale := m.Size, m.Scale
+		if size == 0 {
+			size = 4
+		}
+		if scale == 0 {
+			scale = 1
+		}
+		rec.IO = append(rec.IO, IOElement{
+			ID:    m.ID,
+			Size:  size,
+			Value: uint64(int64(math.Round(sensor.ValY * scale))),
+		})
+	}
+	return rec
+}
+
+// Encode appends the AVL packet of the records to dst.
+func (e *Encoder) Encode(dst []byte, records []Record) ([]byte, error) {
+	codec := e.Codec
+	if codec == 0 {
+		codec = Codec8
+	}
+	if codec != Codec8 && codec != Codec8E {
+		return dst, ErrUnknownCodec
+	}
+	if len(records) == 0 || len(records) > MaxRecords {
+		return dst, fmt.Errorf("%w: %d records", ErrInvalidPacket, len(records))
+	}
+
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0, 0, 0, 0)
+	dst = append(dst, codec, byte(len(records)))
+	var err error
+	for i := 0; i < len(records); i++ {
+		if dst, err = appendRecord(dst, codec, &records[i]); err != nil {
+			return dst[:start], err
+		}
+	}
+	dst = append(dst, byte(len(records)))
+	data := dst[start+headerSize:]
+	binary.BigEndian.PutUint32(dst[start+4:], uint32(len(data)))
+	return binary.BigEndian.AppendUint32(dst, uint32(CRC16(data))), nil
+}
+
+// Decode decodes an AVL data packet.
+func Decode(data []byte) (*Packet, error) {
+	if len(data) < headerSize+4 || binary.BigEndian.Uint32(data) != 0 {
+		return nil, ErrInvalidPacket
+	}
+	size := int(binary.BigEndian.Uint32(data[4:]))
+	if size+headerSize+4 != len(data) || size < 3 {
+		return nil, ErrInvalidPacket
+	}
+	body := data[headerSize : headerSize+size]
+	if uint32(CRC16(body)) != binary.BigEndian.Uint32(data[headerSize+size:]) {
+		return nil, ErrChecksum
+	}
+	pck := &Packet{Codec: body[0]}
+	if pck.Codec != Codec8 && pck.Codec != Codec8E {
+		return nil, ErrUnknownCodec
+	}
+	n := int(body[1])
+	if int(body[len(body)-1]) != n {
+		return nil, ErrInvalidPacket
+	}
+	r := reader{data: body[2 : len(body)-1]}
+	pck.Records = make([]Record, n)
+	for i := 0; i < n; i++ {
+		pck.Records[i] = r.record(pck.Codec)
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return nil, ErrInvalidPacket
+	}
+	return pck, nil
+}
+
+// ReadPacket reads and decodes an AVL data packet.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if binary.BigEndian.Uint32(header[:]) != 0 || size > MaxPacketSize {
+		return nil, ErrInvalidPacket
+	}
+	data := make([]byte, headerSize+int(size)+4)
+	copy(data, header[:])
+	if _, err := io.ReadFull(r, data[headerSize:]); err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// AppendIMEI appends the IMEI handshake message to dst.
+func AppendIMEI(dst []byte, imei string) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(imei)))
+	return append(dst, imei...)
+}
+
+// ReadIMEI reads the IMEI handshake message.
+func ReadIMEI(r io.Reader) (string, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	n := binary.BigEndian.Uint16(size[:])
+	if n == 0 || n > 32 {
+		return "", ErrInvalidPacket
+	}
+	imei := make([]byte, n)
+	if _, err := io.ReadFull(r, imei); err != nil {
+		return "", err
+	}
+	return string(imei), nil
+}
+
+// CRC16 returns the CRC-16/IBM checksum of the data.
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+func appendRecord(dst []byte, codec byte, rec *Record) ([]byte, error) {
+	dst = binary.BigEndian.AppendUint64(dst, uint64(rec.Time.UnixMilli()))
+	dst = append(dst, rec.Priority)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(int32(math.Round(rec.Lon*coordScale))))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(int32(math.Round(rec.Lat*coordScale))))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(rec.Altitude))
+	dst = binary.BigEndian.AppendUint16(dst, rec.Angle)
+	dst = append(dst, rec.Satellites)
+	dst = binary.BigEndian.AppendUint16(dst, rec.Speed)
+
+	var groups [5][]IOElement
+	for i := 0; i < len(rec.IO); i++ {
+		el := rec.IO[i]
+		g := group(el.Size)
+		if codec == Codec8 && (g == 4 || el.ID > math.MaxUint8) {
+			return dst, fmt.Errorf("%w: IO element %d is not supported by Codec 8", ErrInvalidRecord, el.ID)
+		}
+		if g == 4 && len(el.Data) > math.MaxUint16 {
+			return dst, fmt.Errorf("%w: IO element %d is too large", ErrInvalidRecord, el.ID)
+		}
+		groups[g] = append(groups[g], el)
+	}
+
+	if codec == Codec8 {
+		dst = append(dst, byte(rec.EventID), byte(len(rec.IO)))
+		for g := 0; g < 4; g++ {
+			dst = append(dst, byte(len(groups[g])))
+			for _, el := range groups[g] {
+				dst = append(dst, byte(el.ID))
+				dst = appendValue(dst, el)
+			}
+		}
+		return dst, nil
+	}
+
+	dst = binary.BigEndian.AppendUint16(dst, rec.EventID)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(rec.IO)))
+	for g := 0; g < 5; g++ {
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(groups[g])))
+		for _, el := range groups[g] {
+			dst = binary.BigEndian.AppendUint16(dst, el.ID)
+			if g == 4 {
+				dst = binary.BigEndian.AppendUint16(dst, uint16(len(el.Data)))
+				dst = append(dst, el.Data...)
+				continue
+			}
+			dst = appendValue(dst, el)
+		}
+	}
+	return dst, nil
+}
+
+// group returns the index of the IO element group by value size.
+func group(size int) int {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	case 8:
+		return 3
+	}
+	return 4
+}
+
+func appendValue(dst []byte, el IOElement) []byte {
+	switch el.Size {
+	case 1:
+		return append(dst, byte(el.Value))
+	case 2:
+		return binary.BigEndian.AppendUint16(dst, uint16(el.Value))
+	case 4:
+		return binary.BigEndian.AppendUint32(dst, uint32(el.Value))
+	}
+	return binary.BigEndian.AppendUint64(dst, el.Value)
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = ErrInvalidPacket
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint(size int) uint64 {
+	b := r.next(size)
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *reader) record(codec byte) Record {
+	var rec Record
+	rec.Time = time.UnixMilli(int64(r.uint(8)))
+	rec.Priority = byte(r.uint(1))
+	rec.Lon = float64(int32(r.uint(4))) / coordScale
+	rec.Lat = float64(int32(r.uint(4))) / coordScale
+	rec.Altitude = int16(r.uint(2))
+	rec.Angle = uint16(r.uint(2))
+	rec.Satellites = byte(r.uint(1))
+	rec.Speed = uint16(r.uint(2))
+
+	// Codec 8 uses 1-byte IDs and counts, Codec 8E uses 2-byte ones
+	// and adds the group of variable-length elements.
+	width, numGroups := 1, 4
+	if codec == Codec8E {
+		width, numGroups = 2, 5
+	}
+	rec.EventID = uint16(r.uint(width))
+	total := int(r.uint(width))
+	sizes := [5]int{1, 2, 4, 8, 0}
+	for g := 0; g < numGroups && r.err == nil; g++ {
+		n := int(r.uint(width))
+		for i := 0; i < n && r.err == nil; i++ {
+			el := IOElement{ID: uint16(r.uint(width)), Size: sizes[g]}
+			if g == 4 {
+				el.Data = append([]byte(nil), r.next(int(r.uint(2)))...)
+			} else {
+				el.Value = r.uint(el.Size)
+			}
+			rec.IO = append(rec.IO, el)
+		}
+	}
+	if len(rec.IO) != total {
+		r.err = ErrInvalidPacket
+	}
+	return rec
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
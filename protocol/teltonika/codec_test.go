@@ -0,0 +1,144 @@
+package teltonika
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+const (
+	codec8Sample = "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF"
+
+	codec8ESample = "000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994"
+)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "dev1",
+		Speed:     11.5,
+		IsOffline: offline,
+		Battery:   &pb.Device_Battery{Charge: 87.6},
+		Location: &pb.Device_Location{
+			Lat:       48.1173,
+			Lon:       -11.516666,
+			Elevation: 545.4,
+			Bearing:   84.4,
+		},
+		Sensors: []*pb.Device_Sensor{
+			{Name: "temperature", ValX: 0.25, ValY: -12.5},
+			{Name: "unmapped", ValX: 0.5, ValY: 1},
+		},
+	}
+}
+
+func TestDecode_Samples(t *testing.T) {
+	for _, sample := range []string{codec8Sample, codec8ESample} {
+		data, err := hex.DecodeString(sample)
+		require.NoError(t, err)
+		pck, err := Decode(data)
+		require.NoError(t, err)
+		require.Len(t, pck.Records, 1)
+
+		got, err := (&Encoder{Codec: pck.Codec}).Encode(nil, pck.Records)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+
+	data, _ := hex.DecodeString(codec8Sample)
+	pck, _ := Decode(data)
+	rec := pck.Records[0]
+	require.Equal(t, int64(0x16B40D8EA30), rec.Time.UnixMilli())
+	require.Equal(t, PriorityHigh, rec.Priority)
+	require.Equal(t, uint16(1), rec.EventID)
+	el, ok := rec.Element(0x42)
+	require.True(t, ok)
+	require.Equal(t, IOElement{ID: 0x42, Size: 2, Value: 0x5E0F}, el)
+
+	data, _ = hex.DecodeString(codec8ESample)
+	pck, _ = Decode(data)
+	require.Equal(t, Codec8E, pck.Codec)
+	el, ok = pck.Records[0].Element(0x0E)
+	require.True(t, ok)
+	require.Equal(t, uint64(0x1DD7E06A), el.Value)
+
+	data[len(data)-1]++
+	_, err := Decode(data)
+	require.ErrorIs(t, err, ErrChecksum)
+	_, err = Decode(data[:20])
+	require.ErrorIs(t, err, ErrInvalidPacket)
+}
+
+func TestEncoder_RoundTrip(t *testing.T) {
+	for _, codec := range []byte{Codec8, Codec8E} {
+		enc := &Encoder{
+			Codec:    codec,
+			Priority: PriorityLow,
+			IO: map[string]IOMapping{
+				"temperature": {ID: 72, Size: 2, Scale: 10},
+			},
+		}
+		records := []Record{
+			enc.Record(testTime, testDevice(false)),
+			enc.Record(testTime.Add(time.Second), testDevice(true)),
+		}
+		data, err := enc.Encode(nil, records)
+		require.NoError(t, err)
+		pck, err := Decode(data)
+		require.NoError(t, err)
+		require.Equal(t, codec, pck.Codec)
+		require.Len(t, pck.Records, 2)
+
+		rec := pck.Records[0]
+		require.True(t, testTime.Equal(rec.Time))
+		require.InDelta(t, 48.1173, rec.Lat, 1e-7)
+		require.InDelta(t, -11.516666, rec.Lon, 1e-7)
+		require.Equal(t, int16(545), rec.Altitude)
+		require.Equal(t, uint16(84), rec.Angle)
+		require.Equal(t, uint16(41), rec.Speed)
+		require.Equal(t, byte(8), rec.Satellites)
+		require.Len(t, rec.IO, 4)
+		el, _ := rec.Element(IOGNSSStatus)
+		require.Equal(t, uint64(1), el.Value)
+		el, _ = rec.Element(IOMovement)
+		require.Equal(t, uint64(1), el.Value)
+		el, _ = rec.Element(IOBatteryLevel)
+		require.Equal(t, uint64(88), el.Value)
+		el, _ = rec.Element(72)
+		require.Equal(t, int64(-125), el.Int())
+
+		rec = pck.Records[1]
+		require.Zero(t, rec.Speed)
+		require.Zero(t, rec.Satellites)
+		el, _ = rec.Element(IOGNSSStatus)
+		require.Equal(t, uint64(2), el.Value)
+	}
+}
+
+func TestEncoder_Errors(t *testing.T) {
+	enc := NewEncoder()
+	_, err := enc.Encode(nil, nil)
+	require.ErrorIs(t, err, ErrInvalidPacket)
+
+	rec := Record{Time: testTime, IO: []IOElement{{ID: 300, Size: 1}}}
+	_, err = enc.Encode(nil, []Record{rec})
+	require.ErrorIs(t, err, ErrInvalidRecord)
+	rec.IO = []IOElement{{ID: 1, Data: []byte("text")}}
+	_, err = enc.Encode(nil, []Record{rec})
+	require.ErrorIs(t, err, ErrInvalidRecord)
+
+	enc.Codec = Codec8E
+	data, err := enc.Encode(nil, []Record{rec})
+	require.NoError(t, err)
+	pck, err := Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte("text"), pck.Records[0].IO[0].Data)
+
+	enc.Codec = 0x0C
+	_, err = enc.Encode(nil, []Record{rec})
+	require.ErrorIs(t, err, ErrUnknownCodec)
+}
@@ -0,0 +1,99 @@
+// Package tk103 implements the TK103 text protocol of GPS trackers:
+//
+//	(027028641389BR00080612A2232.9828N11404.9297E000.0022828000.0000000000L00000000)
+package tk103
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+const (
+	serialLen = 12
+	kmhPerMS  = 3.6
+	numIO     = 8
+)
+
+// Encoder converts device states into BR00 location messages.
+type Encoder struct {
+	// Status maps sensor names to the IO state flags (0-7).
+	// The flag of a sensor with a non-zero value is set to 1.
+	Status map[string]uint
+}
+
+// NewEncoder creates a new Encoder.
+func NewEncoder() *Encoder {
+	return new(Encoder)
+}
+
+// Serial returns the 12-digit terminal serial number of the device,
+// the last digits of the IMEI derived with protocol.IMEI.
+func Serial(deviceID string) string {
+	imei := protocol.IMEI(deviceID)
+	return imei[len(imei)-serialLen:]
+}
+
+// Append appends the BR00 message of the device state at time t to dst.
+// A device in offline mode is reported with the invalid flag V.
+// The mileage is the distance traveled in meters.
+func (e *Encoder) Append(dst []byte, t time.Time, dev *pb.Device) []byte {
+	t = t.UTC()
+	var lat, lon, bearing float64
+	if loc := dev.Location; loc != nil {
+		lat, lon, bearing = loc.Lat, loc.Lon, loc.Bearing
+	}
+	valid := byte('A')
+	speed := dev.Speed * kmhPerMS
+	if dev.IsOffline || dev.Location == nil {
+		valid, speed = 'V', 0
+	}
+	var mileage float64
+	if dev.Distance != nil {
+		mileage = dev.Distance.CurrentDistance
+	}
+
+	dst = append(dst, '(')
+	dst = append(dst, Serial(dev.Id)...)
+	dst = append(dst, "BR00"...)
+	dst = t.AppendFormat(dst, "060102")
+	dst = append(dst, valid)
+	dst = append(dst, protocol.FormatDegMin(lat, 2, 4)...)
+	dst = append(dst, protocol.Hemisphere(lat, 'N', 'S'))
+	dst = append(dst, protocol.FormatDegMin(lon, 3, 4)...)
+	dst = append(dst, protocol.Hemisphere(lon, 'E', 'W'))
+	dst = fmt.Appendf(dst, "%05.1f", math.Min(speed, 999.9))
+	dst = t.AppendFormat(dst, "150405")
+	dst = fmt.Appendf(dst, "%06.2f", math.Mod(bearing, 360))
+	dst = e.appendIO(dst, dev)
+	dst = fmt.Appendf(dst, "L%08X", uint32(mileage))
+	return append(dst, ')')
+}
+
+func (e *Encoder) appendIO(dst []byte, dev *pb.Device) []byte {
+	var io [numIO]byte
+	for i := 0; i < numIO; i++ {
+		io[i] = '0'
+	}
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		flag, ok := e.Status[sensor.Name]
+		if !ok || flag >= numIO || sensor.ValY == 0 {
+			continue
+		}
+		io[flag] = '1'
+	}
+	return append(dst, io[:]...)
+}
+
+// NewSink creates a Sink sending the devices as TK103 messages over the network, "tcp" or "udp".
+// If enc is nil, NewEncoder is used.
+func NewSink(network, addr string, enc *Encoder, timeout time.Duration) *protocol.Sink {
+	if enc == nil {
+		enc = NewEncoder()
+	}
+	return protocol.NewSink(network, addr, timeout, enc.Append)
+}
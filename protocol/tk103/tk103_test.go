@@ -0,0 +1,65 @@
+package tk103
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2008, 6, 12, 2, 28, 28, 0, time.UTC)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "359027028641389",
+		Speed:     10,
+		IsOffline: offline,
+		Distance:  &pb.Device_Distance{CurrentDistance: 1234.5},
+		Location: &pb.Device_Location{
+			Lat:     -22.54971333,
+			Lon:     114.08216167,
+			Bearing: 270.5,
+		},
+		Sensors: []*pb.Device_Sensor{
+			{Name: "ignition", ValX: 0, ValY: 1},
+			{Name: "door", ValX: 1, ValY: 0},
+		},
+	}
+}
+
+func TestEncoder_Append(t *testing.T) {
+	require.Equal(t, "027028641389", Serial("359027028641389"))
+
+	enc := &Encoder{Status: map[string]uint{"ignition": 0, "door": 1}}
+	got := string(enc.Append(nil, testTime, testDevice(false)))
+	require.Equal(t, "(027028641389BR00080612A2232.9828S11404.9297E036.0022828270.5010000000L000004D2)", got)
+
+	got = string(NewEncoder().Append(nil, testTime, testDevice(true)))
+	require.Equal(t, "(027028641389BR00080612V2232.9828S11404.9297E000.0022828270.5000000000L000004D2)", got)
+}
+
+func TestSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	done := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString(')')
+		done <- line
+	}()
+
+	sink := NewSink("tcp", ln.Addr().String(), nil, 0)
+	pck := &pb.Packet{Timestamp: testTime.Unix(), Devices: []*pb.Device{testDevice(false)}}
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.NoError(t, sink.Close())
+	require.Equal(t, "(027028641389BR00080612A2232.9828S11404.9297E036.0022828270.5000000000L000004D2)", <-done)
+}
@@ -0,0 +1,299 @@
+package wialon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+const (
+	// DefaultTimeout is the default timeout of dialing, writing and waiting for a response.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultBufferSize is the default number of records buffered by a Sink per offline device.
+	DefaultBufferSize = 1000
+
+	// MaxBlackBoxRecords is the maximum number of records sent in one black box message.
+	MaxBlackBoxRecords = 5000
+)
+
+var (
+	ErrRejected        = errors.New("gpsgen/wialon: login rejected")
+	ErrPassword        = errors.New("gpsgen/wialon: invalid password")
+	ErrNotAcknowledged = errors.New("gpsgen/wialon: message not acknowledged")
+	ErrInvalidResponse = errors.New("gpsgen/wialon: invalid response")
+)
+
+// ClientOptions defines the options of a Client.
+type ClientOptions struct {
+	// IMEI is the unit identifier sent in the login message.
+	IMEI string
+
+	// Password is the unit password. Default NA.
+	Password string
+
+	// Encoder encodes the messages. Default NewEncoder.
+	Encoder *Encoder
+
+	// Timeout limits dialing, writing a message and waiting for its response.
+	// Default DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Client is a TCP client of a Wialon IPS server.
+// Every message waits for the server response.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	enc     *Encoder
+	timeout time.Duration
+	buf     []byte
+}
+
+// Dial connects to the server and logs in.
+func Dial(ctx context.Context, addr string, opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = new(ClientOptions)
+	}
+	c := &Client{
+		enc:     opts.Encoder,
+		timeout: opts.Timeout,
+	}
+	if c.enc == nil {
+		c.enc = NewEncoder()
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	resp, err := c.roundTrip(ctx, c.enc.AppendLogin(nil, opts.IMEI, opts.Password), "AL")
+	if err == nil {
+		switch resp {
+		case "1":
+		case "01":
+			err = ErrPassword
+		case "0":
+			err = ErrRejected
+		default:
+			err = fmt.Errorf("%w: %s", ErrNotAcknowledged, resp)
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// SendShortData sends the short data message of the device state at time t.
+func (c *Client) SendShortData(ctx context.Context, t time.Time, dev *pb.Device) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = c.enc.AppendShortData(c.buf[:0], t, dev)
+	return c.expect(ctx, c.buf, "ASD", "1")
+}
+
+// SendData sends the extended data message of the device state at time t.
+func (c *Client) SendData(ctx context.Context, t time.Time, dev *pb.Device) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = c.enc.AppendData(c.buf[:0], t, dev)
+	return c.expect(ctx, c.buf, "AD", "1")
+}
+
+// SendBlackBox sends the records produced by Encoder.AppendRecord as black box messages
+// of at most MaxBlackBoxRecords records.
+func (c *Client) SendBlackBox(ctx context.Context, records [][]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(records) > 0 {
+		n := len(records)
+		if n > MaxBlackBoxRecords {
+			n = MaxBlackBoxRecords
+		}
+		c.buf = c.enc.AppendBlackBox(c.buf[:0], records[:n])
+		if err := c.expect(ctx, c.buf, "AB", strconv.Itoa(n)); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// Ping sends the ping message that keeps the connection alive.
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.roundTrip(ctx, c.enc.AppendPing(nil), "AP")
+	return err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) expect(ctx context.Context, msg []byte, typ, want string) error {
+	resp, err := c.roundTrip(ctx, msg, typ)
+	if err != nil {
+		return err
+	}
+	if resp != want {
+		return fmt.Errorf("%w: #%s#%s", ErrNotAcknowledged, typ, resp)
+	}
+	return nil
+}
+
+// roundTrip writes the message and returns the body of the response of the type.
+func (c *Client) roundTrip(ctx context.Context, msg []byte, typ string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetDeadline(deadline)
+	if _, err := c.conn.Write(msg); err != nil {
+		return "", err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	prefix := "#" + typ + "#"
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, prefix) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidResponse, line)
+	}
+	return line[len(prefix):], nil
+}
+
+// Sink sends the devices of every packet to a Wialon IPS server as extended
+// data messages, one connection per device. The IMEI of a device is derived
+// from its ID with protocol.IMEI. A device in offline mode is treated as
+// a unit without a connection: its states are kept in a black box of
+// BufferSize records that is sent when the device comes back online.
+// Sink implements the gpsgen.Sink interface.
+type Sink struct {
+	mu       sync.Mutex
+	enc      *Encoder
+	size     int
+	devices  *protocol.DeviceSink
+	blackBox map[string][][]byte
+}
+
+// NewSink creates a new Sink. The IMEI of opts is ignored.
+// If bufferSize is zero, DefaultBufferSize is used.
+func NewSink(addr string, opts *ClientOptions, bufferSize int) *Sink {
+	var o ClientOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Encoder == nil {
+		o.Encoder = NewEncoder()
+	}
+	s := &Sink{
+		enc:      o.Encoder,
+		size:     bufferSize,
+		blackBox: make(map[string][][]byte),
+	}
+	if s.size <= 0 {
+		s.size = DefaultBufferSize
+	}
+	dial := func(ctx context.Context, deviceID string) (protocol.DeviceConn, error) {
+		opts := o
+		opts.IMEI = protocol.IMEI(deviceID)
+		c, err := Dial(ctx, addr, &opts)
+		if err != nil {
+			return nil, err
+		}
+		return &unit{Client: c, sink: s}, nil
+	}
+	s.devices = protocol.NewDeviceSink(dial, protocol.DefaultConcurrency)
+	return s
+}
+
+// Write sends the online devices of the packet concurrently, each over its own
+// connection, and buffers the offline ones. The packet timestamp is used as
+// the fix time. A device connection that fails is closed and dialed again
+// by the next Write.
+func (s *Sink) Write(ctx context.Context, pck *pb.Packet) error {
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = time.Now()
+	}
+	online := make([]*pb.Device, 0, len(pck.Devices))
+	s.mu.Lock()
+	for i := 0; i < len(pck.Devices); i++ {
+		dev := pck.Devices[i]
+		if dev == nil {
+			continue
+		}
+		if dev.IsOffline {
+			s.buffer(t, dev)
+			continue
+		}
+		online = append(online, dev)
+	}
+	s.mu.Unlock()
+	return s.devices.Send(ctx, t, online)
+}
+
+// Close closes the device connections. Buffered records are dropped.
+func (s *Sink) Close() error {
+	err := s.devices.Close()
+	s.mu.Lock()
+	s.blackBox = make(map[string][][]byte)
+	s.mu.Unlock()
+	return err
+}
+
+// buffer keeps the record of an offline device, dropping the oldest one when the buffer is full.
+func (s *Sink) buffer(t time.Time, dev *pb.Device) {
+	records := s.blackBox[dev.Id]
+	if len(records) >= s.size {
+		records = append(records[:0], records[len(records)-s.size+1:]...)
+	}
+	s.blackBox[dev.Id] = append(records, s.enc.AppendRecord(nil, t, dev))
+}
+
+// unit is the connection of a device that flushes its black box
+// before the first message after the device comes back online.
+type unit struct {
+	*Client
+	sink *Sink
+}
+
+func (u *unit) SendDevice(ctx context.Context, t time.Time, dev *pb.Device) error {
+	u.sink.mu.Lock()
+	records := u.sink.blackBox[dev.Id]
+	u.sink.mu.Unlock()
+	if len(records) > 0 {
+		if err := u.SendBlackBox(ctx, records); err != nil {
+			return err
+		}
+		u.sink.mu.Lock()
+		delete(u.sink.blackBox, dev.Id)
+		u.sink.mu.Unlock()
+	}
+	return u.SendData(ctx, t, dev)
+}
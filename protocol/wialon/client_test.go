@@ -0,0 +1,119 @@
+package wialon
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a server that accepts the password "secret" or NA
+// and acknowledges every message.
+func serve(t *testing.T) (string, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan []string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var msgs []string
+				defer func() { sessions <- msgs }()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					msgs = append(msgs, line)
+					parts := strings.SplitN(line[1:], "#", 2)
+					var resp string
+					switch parts[0] {
+					case TypeLogin:
+						resp = "#AL#1"
+						if !strings.Contains(line, ";secret;") && !strings.Contains(line, ";NA;") {
+							resp = "#AL#01"
+						}
+					case TypeShortData:
+						resp = "#ASD#1"
+					case TypeData:
+						resp = "#AD#1"
+					case TypeBlackBox:
+						resp = "#AB#" + string(rune('0'+strings.Count(line, "|")+1))
+					case TypePing:
+						resp = "#AP#"
+					}
+					_, _ = conn.Write([]byte(resp + "\r\n"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func TestClient(t *testing.T) {
+	addr, sessions := serve(t)
+	ctx := context.Background()
+
+	c, err := Dial(ctx, addr, &ClientOptions{IMEI: "356307042441013", Password: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, c.SendShortData(ctx, testTime, testDevice(false)))
+	require.NoError(t, c.SendData(ctx, testTime, testDevice(false)))
+	enc := NewEncoder()
+	records := [][]byte{
+		enc.AppendRecord(nil, testTime, testDevice(true)),
+		enc.AppendRecord(nil, testTime, testDevice(true)),
+	}
+	require.NoError(t, c.SendBlackBox(ctx, records))
+	require.NoError(t, c.Ping(ctx))
+	require.NoError(t, c.Close())
+
+	msgs := <-sessions
+	require.Len(t, msgs, 5)
+	require.Equal(t, "2.0;356307042441013;secret", requireMessage(t, TypeLogin, msgs[0]))
+	requireMessage(t, TypeShortData, msgs[1])
+	requireMessage(t, TypeData, msgs[2])
+	requireMessage(t, TypeBlackBox, msgs[3])
+
+	_, err = Dial(ctx, addr, &ClientOptions{IMEI: "356307042441013", Password: "wrong"})
+	require.ErrorIs(t, err, ErrPassword)
+	<-sessions
+}
+
+func TestSink(t *testing.T) {
+	addr, sessions := serve(t)
+	ctx := context.Background()
+	sink := NewSink(addr, nil, 2)
+
+	pck := &pb.Packet{Timestamp: testTime.Unix(), Devices: []*pb.Device{testDevice(true)}}
+	for i := 0; i < 3; i++ {
+		pck.Timestamp++
+		require.NoError(t, sink.Write(ctx, pck))
+	}
+	pck.Devices[0].IsOffline = false
+	pck.Timestamp++
+	require.NoError(t, sink.Write(ctx, pck))
+	require.NoError(t, sink.Write(ctx, pck))
+	require.NoError(t, sink.Close())
+
+	msgs := <-sessions
+	require.Len(t, msgs, 4)
+	require.Equal(t, "2.0;"+protocol.IMEI("dev1")+";NA", requireMessage(t, TypeLogin, msgs[0]))
+	body := requireMessage(t, TypeBlackBox, msgs[1])
+	records := strings.Split(body, "|")
+	require.Len(t, records, 2)
+	require.True(t, strings.HasPrefix(records[0], "230323;123521;"))
+	require.True(t, strings.HasPrefix(records[1], "230323;123522;"))
+	require.True(t, strings.HasPrefix(requireMessage(t, TypeData, msgs[2]), "230323;123523;"))
+	requireMessage(t, TypeData, msgs[3])
+}
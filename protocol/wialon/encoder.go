@@ -0,0 +1,213 @@
+// Package wialon implements the Wialon IPS 2.0 protocol.
+package wialon
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/protocol"
+)
+
+// Version is the protocol version sent in the login message.
+const Version = "2.0"
+
+// Message types.
+const (
+	TypeLogin     = "L"
+	TypeShortData = "SD"
+	TypeData      = "D"
+	TypeBlackBox  = "B"
+	TypePing      = "P"
+)
+
+// ParamBattery is the name of the parameter holding the battery charge in percent.
+const ParamBattery = "batt"
+
+const (
+	na            = "NA"
+	numSatellites = 8
+	hdop          = "0.9"
+	kmhPerMS      = 3.6
+	paramDouble   = '2'
+)
+
+// Encoder converts device states into Wialon IPS messages.
+type Encoder struct {
+	// Inputs maps sensor names to the bits of the digital inputs.
+	// The bit of a sensor with a non-zero value is set.
+	Inputs map[string]uint
+}
+
+// NewEncoder creates a new Encoder.
+func NewEncoder() *Encoder {
+	return new(Encoder)
+}
+
+// AppendLogin appends the login message to dst. An empty password is sent as NA.
+func (e *Encoder) AppendLogin(dst []byte, imei, password string) []byte {
+	if len(password) == 0 {
+		password = na
+	}
+	return appendMessage(dst, TypeLogin, []byte(Version+";"+imei+";"+password+";"))
+}
+
+// AppendShortData appends the short data message of the device state at time t to dst.
+func (e *Encoder) AppendShortData(dst []byte, t time.Time, dev *pb.Device) []byte {
+	body := appendShort(nil, t, dev)
+	return appendMessage(dst, TypeShortData, append(body, ';'))
+}
+
+// AppendData appends the extended data message of the device state at time t to dst.
+func (e *Encoder) AppendData(dst []byte, t time.Time, dev *pb.Device) []byte {
+	body := e.AppendRecord(nil, t, dev)
+	return appendMessage(dst, TypeData, append(body, ';'))
+}
+
+// AppendRecord appends the body of the extended data message of the device state
+// at time t to dst, without the message type and checksum. Records are collected
+// into black box messages with AppendBlackBox.
+// Sensors are sent as double parameters named after the sensor,
+// the battery charge as the ParamBattery parameter.
+func (e *Encoder) AppendRecord(dst []byte, t time.Time, dev *pb.Device) []byte {
+	dst = appendShort(dst, t, dev)
+	dst = append(dst, ';')
+	if hasFix(dev) {
+		dst = append(dst, hdop...)
+	} else {
+		dst = append(dst, na...)
+	}
+	dst = append(dst, ';')
+	dst = strconv.AppendUint(dst, uint64(e.inputs(dev)), 10)
+	// outputs, adc and iButton
+	dst = append(dst, ";0;;NA;"...)
+
+	n := 0
+	if dev.Battery != nil {
+		dst = appendParam(dst, ParamBattery, dev.Battery.Charge)
+		n++
+	}
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		name := paramName(sensor.Name)
+		if len(name) == 0 {
+			continue
+		}
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendParam(dst, name, sensor.ValY)
+		n++
+	}
+	if n == 0 {
+		dst = append(dst, na...)
+	}
+	return dst
+}
+
+// AppendBlackBox appends the black box message of the records to dst.
+func (e *Encoder) AppendBlackBox(dst []byte, records [][]byte) []byte {
+	var body []byte
+	for i := 0; i < len(records); i++ {
+		if i > 0 {
+			body = append(body, '|')
+		}
+		body = append(body, records[i]...)
+	}
+	return appendMessage(dst, TypeBlackBox, append(body, ';'))
+}
+
+// AppendPing appends the ping message to dst.
+func (e *Encoder) AppendPing(dst []byte) []byte {
+	return append(dst, "#P#\r\n"...)
+}
+
+func (e *Encoder) inputs(dev *pb.Device) uint32 {
+	var inputs uint32
+	for i := 0; i < len(dev.Sensors); i++ {
+		sensor := dev.Sensors[i]
+		bit, ok := e.Inputs[sensor.Name]
+		if !ok || bit > 31 || sensor.ValY == 0 {
+			continue
+		}
+		inputs |= 1 << bit
+	}
+	return inputs
+}
+
+// appendShort appends the fields shared by the short and extended data messages:
+// date;time;lat1;lat2;lon1;lon2;speed;course;alt;sats
+// A device in offline mode keeps its last position without satellites.
+func appendShort(dst []byte, t time.Time, dev *pb.Device) []byte {
+	t = t.UTC()
+	dst = t.AppendFormat(dst, "020106;150405;")
+	loc := dev.Location
+	if loc == nil {
+		return append(dst, "NA;NA;NA;NA;NA;NA;NA;NA"...)
+	}
+	dst = append(dst, protocol.FormatDegMin(loc.Lat, 2, 4)...)
+	dst = append(dst, ';', protocol.Hemisphere(loc.Lat, 'N', 'S'), ';')
+	dst = append(dst, protocol.FormatDegMin(loc.Lon, 3, 4)...)
+	dst = append(dst, ';', protocol.Hemisphere(loc.Lon, 'E', 'W'), ';')
+	dst = strconv.AppendInt(dst, int64(math.Round(dev.Speed*kmhPerMS)), 10)
+	dst = append(dst, ';')
+	dst = strconv.AppendInt(dst, int64(math.Round(loc.Bearing))%360, 10)
+	dst = append(dst, ';')
+	dst = strconv.AppendInt(dst, int64(math.Round(loc.Elevation)), 10)
+	dst = append(dst, ';')
+	if !hasFix(dev) {
+		return append(dst, na...)
+	}
+	return strconv.AppendInt(dst, numSatellites, 10)
+}
+
+func appendParam(dst []byte, name string, v float64) []byte {
+	dst = append(dst, name...)
+	dst = append(dst, ':', paramDouble, ':')
+	return strconv.AppendFloat(dst, v, 'f', -1, 64)
+}
+
+// paramName replaces the separators of the protocol in a sensor name.
+func paramName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', ',', ';', '|', '#', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func hasFix(dev *pb.Device) bool {
+	return dev.Location != nil && !dev.IsOffline
+}
+
+// appendMessage appends #type#body with the checksum of the body.
+// The body ends with the ';' preceding the checksum.
+func appendMessage(dst []byte, typ string, body []byte) []byte {
+	dst = append(dst, '#')
+	dst = append(dst, typ...)
+	dst = append(dst, '#')
+	dst = append(dst, body...)
+	dst = fmt.Appendf(dst, "%04X", CRC16(body))
+	return append(dst, '\r', '\n')
+}
+
+// CRC16 returns the CRC-16/ARC checksum of the data used by Wialon IPS 2.0.
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
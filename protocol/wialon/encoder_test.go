@@ -0,0 +1,76 @@
+package wialon
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2023, 3, 23, 12, 35, 19, 0, time.UTC)
+
+func testDevice(offline bool) *pb.Device {
+	return &pb.Device{
+		Id:        "dev1",
+		Speed:     11.5,
+		IsOffline: offline,
+		Battery:   &pb.Device_Battery{Charge: 87.5},
+		Location: &pb.Device_Location{
+			Lat:       48.1173,
+			Lon:       -11.516666666,
+			Elevation: 545.4,
+			Bearing:   84.4,
+		},
+		Sensors: []*pb.Device_Sensor{
+			{Name: "engine temp", ValX: 0.25, ValY: -12.5},
+			{Name: "ignition", ValX: 0, ValY: 1},
+		},
+	}
+}
+
+// requireMessage checks the checksum of the message and returns its body.
+func requireMessage(t *testing.T, typ, msg string) string {
+	prefix := "#" + typ + "#"
+	require.True(t, strings.HasPrefix(msg, prefix), msg)
+	require.True(t, strings.HasSuffix(msg, "\r\n"))
+	msg = strings.TrimSuffix(msg[len(prefix):], "\r\n")
+	i := strings.LastIndexByte(msg, ';')
+	require.Equal(t, fmt.Sprintf("%04X", CRC16([]byte(msg[:i+1]))), msg[i+1:])
+	return msg[:i]
+}
+
+func TestCRC16(t *testing.T) {
+	require.Equal(t, uint16(0xBB3D), CRC16([]byte("123456789")))
+}
+
+func TestEncoder(t *testing.T) {
+	enc := &Encoder{Inputs: map[string]uint{"ignition": 0}}
+
+	msg := string(enc.AppendLogin(nil, "356307042441013", ""))
+	require.Equal(t, "2.0;356307042441013;NA", requireMessage(t, TypeLogin, msg))
+
+	msg = string(enc.AppendShortData(nil, testTime, testDevice(false)))
+	require.Equal(t, "230323;123519;4807.0380;N;01131.0000;W;41;84;545;8", requireMessage(t, TypeShortData, msg))
+
+	msg = string(enc.AppendData(nil, testTime, testDevice(false)))
+	require.Equal(t, "230323;123519;4807.0380;N;01131.0000;W;41;84;545;8;0.9;1;0;;NA;"+
+		"batt:2:87.5,engine_temp:2:-12.5,ignition:2:1", requireMessage(t, TypeData, msg))
+
+	msg = string(NewEncoder().AppendData(nil, testTime, &pb.Device{}))
+	require.Equal(t, "230323;123519;NA;NA;NA;NA;NA;NA;NA;NA;NA;0;0;;NA;NA", requireMessage(t, TypeData, msg))
+
+	require.Equal(t, "230323;123519;4807.0380;N;01131.0000;W;41;84;545;NA;NA;1;0;;NA;"+
+		"batt:2:87.5,engine_temp:2:-12.5,ignition:2:1", string(enc.AppendRecord(nil, testTime, testDevice(true))))
+
+	records := [][]byte{
+		enc.AppendRecord(nil, testTime, testDevice(true)),
+		enc.AppendRecord(nil, testTime.Add(time.Second), testDevice(true)),
+	}
+	msg = string(enc.AppendBlackBox(nil, records))
+	body := requireMessage(t, TypeBlackBox, msg)
+	require.Equal(t, string(records[0])+"|"+string(records[1]), body)
+	require.Equal(t, "#P#\r\n", string(enc.AppendPing(nil)))
+}
@@ -2,7 +2,6 @@ package random
 
 import (
 	"errors"
-	"math/rand"
 	"strings"
 
 	"github.com/mmadfox/go-gpsgen/geo"
@@ -417,8 +416,8 @@ func LatLonByCountry(countryCode string) (geo.LatLonPoint, error) {
 		return geo.LatLonPoint{}, err
 	}
 	return geo.LatLonPoint{
-		Lon: rand.Float64()*(bbox.MaxLon-bbox.MinLon) + bbox.MinLon,
-		Lat: rand.Float64()*(bbox.MaxLat-bbox.MinLat) + bbox.MinLat,
+		Lon: defaultRnd.Float64()*(bbox.MaxLon-bbox.MinLon) + bbox.MinLon,
+		Lat: defaultRnd.Float64()*(bbox.MaxLat-bbox.MinLat) + bbox.MinLat,
 	}, nil
 }
 
@@ -431,7 +430,7 @@ func LatLon() geo.LatLonPoint {
 }
 
 func rnd() float64 {
-	return rand.Float64() - 0.5
+	return defaultRnd.Float64() - 0.5
 }
 
 func lon() float64 {
@@ -14,9 +14,17 @@ const (
 	maxZoom       = 1000        // Maximum zoom level for polygon generation
 )
 
-// Polygon generates a random polygon with the specified number of points and zoom level.
+// Polygon generates a random polygon with the specified number of points and zoom level
+// from the shared source.
 // It returns a slice of [2]float64 representing the polygon's coordinates.
 func Polygon(points int, zoom float64) [][2]float64 {
+	return defaultRnd.Polygon(points, zoom)
+}
+
+// Polygon generates a random polygon with the specified number of points and zoom level
+// from the source.
+// It returns a slice of [2]float64 representing the polygon's coordinates.
+func (r *Random) Polygon(points int, zoom float64) [][2]float64 {
 	if points < 0 {
 		points = defaultPoints
 	}
@@ -29,7 +37,7 @@ func Polygon(points int, zoom float64) [][2]float64 {
 	coordinates := make([][2]float64, points+1)
 	offsets := make([]float64, points)
 	for i := 0; i < points; i++ {
-		v := defaultRnd.Float64()
+		v := r.Float64()
 		if i == 0 {
 			offsets[i] = v
 		} else {
@@ -39,7 +47,7 @@ func Polygon(points int, zoom float64) [][2]float64 {
 	last := offsets[len(offsets)-1]
 	for i := 0; i < points; i++ {
 		cur := (offsets[i] * mp * math.Phi) / last
-		factor := randFactor(minFactor, maxFactor)
+		factor := r.factor(minFactor, maxFactor)
 		var p1, p2 float64
 		if zoom > 0 {
 			p1 = factor * zoom * math.Sin(cur)
@@ -54,6 +62,6 @@ func Polygon(points int, zoom float64) [][2]float64 {
 	return coordinates
 }
 
-func randFactor(min, max float64) float64 {
-	return min + defaultRnd.ExpFloat64()*(max-min)
+func (r *Random) factor(min, max float64) float64 {
+	return min + r.ExpFloat64()*(max-min)
 }
@@ -4,19 +4,52 @@ import (
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucasb-eyer/go-colorful"
 )
 
 var defaultRnd = NewRandom()
 
+// Random is a goroutine-safe source of pseudo-random values.
 type Random struct {
 	mu  sync.RWMutex
 	rnd *rand.Rand
 }
 
+// NewRandom creates a new Random seeded with the current time.
 func NewRandom() *Random {
+	return NewRandomWithSeed(time.Now().UnixNano())
+}
+
+// NewRandomWithSeed creates a new Random with the given seed.
+// Two sources created with the same seed produce the same sequence of values.
+func NewRandomWithSeed(seed int64) *Random {
 	return &Random{
-		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Or returns r, or the shared source if r is nil.
+func Or(r *Random) *Random {
+	if r == nil {
+		return defaultRnd
 	}
+	return r
+}
+
+// Default returns the shared source used by the packages of the module
+// for route, curve, offline, color and identifier generation
+// when no source is injected.
+func Default() *Random {
+	return defaultRnd
+}
+
+// Seed reseeds the source.
+func (r *Random) Seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rnd.Seed(seed)
 }
 
 func (r *Random) Intn(n int) int {
@@ -36,3 +69,50 @@ func (r *Random) ExpFloat64() float64 {
 	defer r.mu.Unlock()
 	return r.rnd.ExpFloat64()
 }
+
+// Read fills p with pseudo-random bytes. It always returns len(p) and a nil error.
+func (r *Random) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rnd.Read(p)
+}
+
+// UUID generates a version 4 UUID string from the source.
+func (r *Random) UUID() string {
+	id, err := uuid.NewRandomFromReader(r)
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// Color generates a random bright color in hex format from the source.
+func (r *Random) Color() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return colorful.Hsv(
+		r.rnd.Float64()*360.0,
+		0.7+r.rnd.Float64()*0.3,
+		0.6+r.rnd.Float64()*0.3,
+	).Hex()
+}
+
+// Float64 returns a pseudo-random number in [0.0,1.0) from the shared source.
+func Float64() float64 {
+	return defaultRnd.Float64()
+}
+
+// Intn returns a pseudo-random number in [0,n) from the shared source.
+func Intn(n int) int {
+	return defaultRnd.Intn(n)
+}
+
+// UUID generates a version 4 UUID string from the shared source.
+func UUID() string {
+	return defaultRnd.UUID()
+}
+
+// Color generates a random bright color in hex format from the shared source.
+func Color() string {
+	return defaultRnd.Color()
+}
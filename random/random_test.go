@@ -0,0 +1,36 @@
+package random
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandom_Seed(t *testing.T) {
+	a := NewRandomWithSeed(42)
+	b := NewRandomWithSeed(42)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, a.Float64(), b.Float64())
+		require.Equal(t, a.Intn(100), b.Intn(100))
+	}
+	require.Equal(t, a.UUID(), b.UUID())
+	require.Equal(t, a.Color(), b.Color())
+
+	a.Seed(7)
+	b.Seed(7)
+	require.Equal(t, a.ExpFloat64(), b.ExpFloat64())
+}
+
+func TestRandom_Independent(t *testing.T) {
+	a := NewRandomWithSeed(1)
+	id1, color1, poly1, str1 := a.UUID(), a.Color(), a.Polygon(8, 10), a.String(8)
+	// values drawn from other sources must not affect the sequence
+	Default().Float64()
+	NewRandomWithSeed(1).Float64()
+	b := NewRandomWithSeed(1)
+	id2, color2, poly2, str2 := b.UUID(), b.Color(), b.Polygon(8, 10), b.String(8)
+	require.Equal(t, id1, id2)
+	require.Equal(t, color1, color2)
+	require.Equal(t, poly1, poly2)
+	require.Equal(t, str1, str2)
+}
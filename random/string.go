@@ -3,18 +3,25 @@ package random
 const charset = "abcdefghijklmnopqrstuvwxyz" +
 	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-// String generates a random string of the specified length using the default charset.
+// String generates a random string of the specified length using the default charset
+// from the shared source.
 func String(length int) string {
-	return stringWithCharset(length, charset)
+	return defaultRnd.String(length)
 }
 
-func stringWithCharset(length int, charset string) string {
+// String generates a random string of the specified length using the default charset
+// from the source.
+func (r *Random) String(length int) string {
+	return r.stringWithCharset(length, charset)
+}
+
+func (r *Random) stringWithCharset(length int, charset string) string {
 	if length <= 0 {
 		return ""
 	}
 	b := make([]byte, length)
 	for i := range b {
-		chi := defaultRnd.Intn(len(charset))
+		chi := r.Intn(len(charset))
 		b[i] = charset[chi]
 	}
 	return string(b)
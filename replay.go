@@ -0,0 +1,306 @@
+package gpsgen
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Recorder is a Sink that stores timestamped packets in a framed stream
+// that can be played back by a Replayer.
+// Each frame holds the recording time in Unix nanoseconds followed by
+// the binary protobuf packet; frames are protected by a CRC.
+type Recorder struct {
+	mu    sync.Mutex
+	pw    *PacketWriter
+	clock Clock
+	buf   []byte
+}
+
+// NewRecorder creates a new Recorder that writes to w.
+// Packets without a timestamp are recorded with the time of clock;
+// if clock is nil, RealClock is used.
+func NewRecorder(w io.Writer, clock Clock) *Recorder {
+	if clock == nil {
+		clock = RealClock()
+	}
+	return &Recorder{
+		pw:    NewPacketWriter(w, true),
+		clock: clock,
+	}
+}
+
+// Write records the packet with its timestamp,
+// or with the current time of the clock if the packet has none.
+func (r *Recorder) Write(_ context.Context, pck *pb.Packet) error {
+	t := time.Unix(pck.Timestamp, 0)
+	if pck.Timestamp == 0 {
+		t = r.clock.Now()
+	}
+	return r.Record(t, pck)
+}
+
+// Record records the packet with the given time.
+func (r *Recorder) Record(t time.Time, pck *pb.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := binary.BigEndian.AppendUint64(r.buf[:0], uint64(t.UnixNano()))
+	buf, err := proto.MarshalOptions{}.MarshalAppend(buf, pck)
+	if err != nil {
+		return err
+	}
+	r.buf = buf
+	return r.pw.WriteFrame(buf)
+}
+
+// Close does not close the underlying writer.
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// ReplayOptions defines the options of a Replayer.
+type ReplayOptions struct {
+	// Speed is the playback speed factor, e.g. 0.5 for half and 10 for ten times
+	// the recorded speed. Default 1.
+	Speed float64
+
+	// Offset skips the packets recorded within Offset from the start of the recording.
+	Offset time.Duration
+
+	// Loop restarts the playback from Offset when the recording ends.
+	Loop bool
+
+	// DeviceIDs limits the playback to the given devices. Default all devices.
+	DeviceIDs []string
+
+	// Clock is used to wait between packets. Default RealClock.
+	Clock Clock
+
+	// Encoder encodes the packets passed to the OnPacket callback. Default ProtoEncoder.
+	Encoder Encoder
+}
+
+// Replayer plays back a recording made by a Recorder through
+// the OnPacket callback and sinks, preserving the recorded timing.
+// The packets keep their recorded timestamps.
+type Replayer struct {
+	r        io.ReadSeeker
+	speed    float64
+	offset   time.Duration
+	loop     bool
+	devices  map[string]struct{}
+	clock    Clock
+	encoder  Encoder
+	onPacket func([]byte) error
+	sinks    []Sink
+
+	// index of the first frame at Offset, found by the first playback
+	pr      *PacketReader
+	indexed bool
+	pos     int64
+	start   time.Time
+}
+
+type recordedPacket struct {
+	time   time.Time
+	packet *pb.Packet
+}
+
+// NewReplayer creates a new Replayer that reads the recording from r.
+func NewReplayer(r io.ReadSeeker, opts *ReplayOptions) *Replayer {
+	if opts == nil {
+		opts = new(ReplayOptions)
+	}
+	rp := &Replayer{
+		r:       r,
+		speed:   opts.Speed,
+		offset:  opts.Offset,
+		loop:    opts.Loop,
+		clock:   opts.Clock,
+		encoder: opts.Encoder,
+	}
+	if rp.speed <= 0 {
+		rp.speed = 1
+	}
+	if rp.clock == nil {
+		rp.clock = RealClock()
+	}
+	if rp.encoder == nil {
+		rp.encoder = ProtoEncoder{}
+	}
+	if len(opts.DeviceIDs) > 0 {
+		rp.devices = make(map[string]struct{}, len(opts.DeviceIDs))
+		for i := 0; i < len(opts.DeviceIDs); i++ {
+			rp.devices[opts.DeviceIDs[i]] = struct{}{}
+		}
+	}
+	return rp
+}
+
+// OnPacket sets a callback function to handle the replayed packets.
+func (rp *Replayer) OnPacket(fn func([]byte) error) {
+	rp.onPacket = fn
+}
+
+// AddSink adds a sink that receives every replayed packet.
+// Sinks are closed when Run returns.
+func (rp *Replayer) AddSink(sink Sink) {
+	if sink == nil {
+		return
+	}
+	rp.sinks = append(rp.sinks, sink)
+}
+
+// Run plays back the recording. It blocks until the recording ends,
+// or ctx ends when looping, and returns the first error of the OnPacket callback,
+// a sink or the recording.
+func (rp *Replayer) Run(ctx context.Context) (err error) {
+	defer func() {
+		for i := 0; i < len(rp.sinks); i++ {
+			if cerr := rp.sinks[i].Close(); cerr != nil {
+				err = errors.Join(err, cerr)
+			}
+		}
+	}()
+
+	for {
+		played, err := rp.play(ctx)
+		if err != nil {
+			return err
+		}
+		if !rp.loop || !played {
+			return nil
+		}
+	}
+}
+
+func (rp *Replayer) play(ctx context.Context) (played bool, err error) {
+	var start, prev time.Time
+	if rp.indexed {
+		if _, err := rp.r.Seek(rp.pos, io.SeekStart); err != nil {
+			return false, err
+		}
+		rp.pr.resume(rp.r, rp.pos)
+		start = rp.start
+	} else {
+		if _, err := rp.r.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		rp.pr = NewPacketReader(rp.r)
+		if err := rp.pr.readHeader(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	pr := rp.pr
+
+	for {
+		pos := pr.offset()
+		rec, err := readRecordedPacket(pr)
+		if errors.Is(err, io.EOF) {
+			return played, nil
+		}
+		if err != nil {
+			return played, err
+		}
+		if start.IsZero() {
+			start = rec.time
+		}
+		if rec.time.Sub(start) < rp.offset {
+			continue
+		}
+		if !rp.indexed {
+			rp.indexed, rp.pos, rp.start = true, pos, start
+		}
+		if !prev.IsZero() {
+			delay := time.Duration(float64(rec.time.Sub(prev)) / rp.speed)
+			if err := rp.sleep(ctx, delay); err != nil {
+				return played, err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return played, err
+		}
+		prev = rec.time
+
+		if !rp.filter(rec.packet) {
+			continue
+		}
+		if err := rp.deliver(ctx, rec.packet); err != nil {
+			return played, err
+		}
+		played = true
+	}
+}
+
+func (rp *Replayer) filter(pck *pb.Packet) bool {
+	if rp.devices == nil {
+		return len(pck.Devices) > 0
+	}
+	devices := pck.Devices[:0]
+	for i := 0; i < len(pck.Devices); i++ {
+		if _, ok := rp.devices[pck.Devices[i].Id]; ok {
+			devices = append(devices, pck.Devices[i])
+		}
+	}
+	pck.Devices = devices
+	return len(devices) > 0
+}
+
+func (rp *Replayer) deliver(ctx context.Context, pck *pb.Packet) error {
+	if rp.onPacket != nil {
+		data, err := rp.encoder.Encode(nil, pck)
+		if err != nil {
+			return err
+		}
+		if err := rp.onPacket(data); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(rp.sinks); i++ {
+		if err := rp.sinks[i].Write(ctx, pck); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rp *Replayer) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	ticker := rp.clock.NewTicker(d)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func readRecordedPacket(pr *PacketReader) (*recordedPacket, error) {
+	data, err := pr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("gpsgen: invalid recorded packet")
+	}
+	pck := new(pb.Packet)
+	if err := proto.Unmarshal(data[8:], pck); err != nil {
+		return nil, err
+	}
+	return &recordedPacket{
+		time:   time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+		packet: pck,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package gpsgen
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecording(t *testing.T) *bytes.Reader {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf, clock)
+	for i := 0; i < 5; i++ {
+		pck := &pb.Packet{
+			Timestamp: clock.Now().Unix(),
+			Devices:   []*pb.Device{{Id: "a", Speed: float64(i)}, {Id: "b", Speed: float64(i)}},
+		}
+		require.NoError(t, rec.Write(context.Background(), pck))
+		clock.Advance(time.Second)
+	}
+	require.NoError(t, rec.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestReplayer(t *testing.T) {
+	var packets []*pb.Packet
+	rp := NewReplayer(testRecording(t), &ReplayOptions{Speed: 100})
+	rp.OnPacket(func(b []byte) error {
+		pck, err := PacketFromBytes(b)
+		require.NoError(t, err)
+		packets = append(packets, pck)
+		return nil
+	})
+	start := time.Now()
+	require.NoError(t, rp.Run(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	require.Len(t, packets, 5)
+	for i := 0; i < len(packets); i++ {
+		require.Len(t, packets[i].Devices, 2)
+		require.Equal(t, float64(i), packets[i].Devices[0].Speed)
+	}
+}
+
+func TestReplayer_SeekAndFilter(t *testing.T) {
+	var packets []*pb.Packet
+	rp := NewReplayer(testRecording(t), &ReplayOptions{
+		Speed:     1000,
+		Offset:    2 * time.Second,
+		DeviceIDs: []string{"b"},
+	})
+	rp.AddSink(SinkFunc(func(_ context.Context, pck *pb.Packet) error {
+		packets = append(packets, pck)
+		return nil
+	}))
+	require.NoError(t, rp.Run(context.Background()))
+	require.Len(t, packets, 3)
+	for i := 0; i < len(packets); i++ {
+		require.Len(t, packets[i].Devices, 1)
+		require.Equal(t, "b", packets[i].Devices[0].Id)
+		require.Equal(t, float64(i+2), packets[i].Devices[0].Speed)
+	}
+}
+
+func TestReplayer_Loop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var speeds []float64
+	rp := NewReplayer(testRecording(t), &ReplayOptions{
+		Speed:  1000,
+		Offset: 3 * time.Second,
+		Loop:   true,
+	})
+	rp.AddSink(SinkFunc(func(_ context.Context, pck *pb.Packet) error {
+		speeds = append(speeds, pck.Devices[0].Speed)
+		if len(speeds) == 5 {
+			cancel()
+		}
+		return nil
+	}))
+	require.ErrorIs(t, rp.Run(ctx), context.Canceled)
+	require.Equal(t, []float64{3, 4, 3, 4, 3}, speeds)
+}
+
+func TestReplayer_InvalidRecording(t *testing.T) {
+	rp := NewReplayer(bytes.NewReader([]byte("invalid")), nil)
+	require.ErrorIs(t, rp.Run(context.Background()), ErrInvalidStream)
+}
+
+type seekRecorder struct {
+	*bytes.Reader
+	seeks []int64
+}
+
+func (r *seekRecorder) Seek(offset int64, whence int) (int64, error) {
+	r.seeks = append(r.seeks, offset)
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestReplayer_LoopIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var speeds []float64
+	r := &seekRecorder{Reader: testRecording(t)}
+	rp := NewReplayer(r, &ReplayOptions{
+		Speed:  1000,
+		Offset: 3 * time.Second,
+		Loop:   true,
+	})
+	rp.AddSink(SinkFunc(func(_ context.Context, pck *pb.Packet) error {
+		speeds = append(speeds, pck.Devices[0].Speed)
+		if len(speeds) == 6 {
+			cancel()
+		}
+		return nil
+	}))
+	require.ErrorIs(t, rp.Run(ctx), context.Canceled)
+	require.Equal(t, []float64{3, 4, 3, 4, 3, 4}, speeds)
+	// only the first playback scans from the start
+	require.GreaterOrEqual(t, len(r.seeks), 3)
+	require.Equal(t, int64(0), r.seeks[0])
+	require.Greater(t, r.seeks[1], int64(0))
+	for i := 2; i < len(r.seeks); i++ {
+		require.Equal(t, r.seeks[1], r.seeks[i])
+	}
+}
+
+func TestRecorder_PacketTime(t *testing.T) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf, clock)
+	ts := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, rec.Write(context.Background(), &pb.Packet{Timestamp: ts.Unix()}))
+	require.NoError(t, rec.Write(context.Background(), &pb.Packet{}))
+
+	pr := NewPacketReader(&buf)
+	got, err := readRecordedPacket(pr)
+	require.NoError(t, err)
+	require.True(t, ts.Equal(got.time))
+	got, err = readRecordedPacket(pr)
+	require.NoError(t, err)
+	require.True(t, clock.Now().Equal(got.time))
+}
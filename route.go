@@ -21,6 +21,13 @@ const (
 // The generated route is centered around the provided latitude and longitude.
 // Returns a random route with tracks, or nil if an error occurs during track creation.
 func RandomRoute(lon, lat float64, numTrack int, level int) *navigator.Route {
+	return RandomRouteWithSource(nil, lon, lat, numTrack, level)
+}
+
+// RandomRouteWithSource is like RandomRoute but draws the route from src,
+// so the same seed reproduces the same route. A nil src uses the shared source.
+func RandomRouteWithSource(src *random.Random, lon, lat float64, numTrack int, level int) *navigator.Route {
+	src = random.Or(src)
 	if numTrack < 0 {
 		numTrack = 1
 	}
@@ -30,14 +37,14 @@ func RandomRoute(lon, lat float64, numTrack int, level int) *navigator.Route {
 	if level > RouteLevelXXL {
 		level = RouteLevelXXL
 	}
-	route := navigator.NewRoute()
-	routeName := "Route-" + random.String(8)
+	route := navigator.NewRouteWithSource(src)
+	routeName := "Route-" + src.String(8)
 	route.ChangeName(routeName)
 	for i := 0; i < numTrack; i++ {
-		rawPoints := random.Polygon(16, float64(level))
+		rawPoints := src.Polygon(16, float64(level))
 		points := geo.NormalizeCoordinates(lat, lon, rawPoints)
-		track, _ := navigator.NewTrack(points)
-		trackName := "Track-" + random.String(8)
+		track, _ := navigator.NewTrackWithSource(src, points)
+		trackName := "Track-" + src.String(8)
 		track.ChangeName(trackName)
 		route.AddTrack(track)
 	}
@@ -0,0 +1,119 @@
+package gpsgen
+
+import (
+	"container/heap"
+	"time"
+)
+
+// schedule is a priority queue of attached devices ordered by the time of their next report.
+type schedule struct {
+	queue    scheduleQueue
+	byDevice map[*Device]*scheduleItem
+	seq      uint64
+}
+
+type scheduleItem struct {
+	device *Device
+	next   time.Time
+	last   time.Time
+	seq    uint64
+	index  int
+}
+
+type dueDevice struct {
+	device *Device
+	tick   float64
+}
+
+func newSchedule() *schedule {
+	return &schedule{
+		queue:    make(scheduleQueue, 0),
+		byDevice: make(map[*Device]*scheduleItem),
+	}
+}
+
+func (s *schedule) add(d *Device, now time.Time) {
+	if _, ok := s.byDevice[d]; ok {
+		return
+	}
+	s.seq++
+	item := &scheduleItem{
+		device: d,
+		next:   now,
+		last:   now,
+		seq:    s.seq,
+	}
+	s.byDevice[d] = item
+	heap.Push(&s.queue, item)
+}
+
+func (s *schedule) remove(d *Device) {
+	item, ok := s.byDevice[d]
+	if !ok {
+		return
+	}
+	delete(s.byDevice, d)
+	heap.Remove(&s.queue, item.index)
+}
+
+// due pops all devices whose report is due at now, reschedules them
+// and appends them to dst in report order.
+// The base interval is the generator resolution: a device is never reported
+// more often than base, and a report that falls within half of base
+// of the current tick is treated as due to absorb ticker jitter.
+func (s *schedule) due(now time.Time, base time.Duration, dst []dueDevice) []dueDevice {
+	deadline := now.Add(base / 2)
+	for len(s.queue) > 0 {
+		item := s.queue[0]
+		if item.next.After(deadline) {
+			break
+		}
+		dst = append(dst, dueDevice{
+			device: item.device,
+			tick:   now.Sub(item.last).Seconds(),
+		})
+		interval := item.device.Interval()
+		if interval < base {
+			interval = base
+		}
+		item.last = now
+		item.next = now.Add(interval)
+		heap.Fix(&s.queue, 0)
+	}
+	return dst
+}
+
+type scheduleQueue []*scheduleItem
+
+func (q scheduleQueue) Len() int {
+	return len(q)
+}
+
+func (q scheduleQueue) Less(i, j int) bool {
+	if q[i].next.Equal(q[j].next) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].next.Before(q[j].next)
+}
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	item := x.(*scheduleItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
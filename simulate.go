@@ -0,0 +1,54 @@
+package gpsgen
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+)
+
+// SimulateFunc is called by Simulate for every device state at every step.
+// The state is owned by the device and is only valid until the callback returns;
+// use proto.Clone to keep it. Returning a non-nil error stops the simulation.
+type SimulateFunc func(t time.Time, state *pb.Device) error
+
+// Simulate advances the given devices from start over the duration in fixed steps
+// without the Generator loop, tickers or goroutines and passes every device state to fn.
+// Devices are stepped in slice order, so the output is reproducible for devices
+// created with a seeded source, DeviceOptions.Random or DeviceOptions.Seed,
+// on routes drawn from a seeded source such as Generator.Random with Options.Seed.
+// Memory usage does not depend on the duration; nothing is buffered between steps.
+func Simulate(
+	devices []*Device,
+	start time.Time,
+	duration time.Duration,
+	step time.Duration,
+	fn SimulateFunc,
+) error {
+	if step <= 0 {
+		return fmt.Errorf("gpsgen: invalid simulation step %s", step)
+	}
+	if duration < step {
+		return fmt.Errorf("gpsgen: simulation duration %s is less than step %s", duration, step)
+	}
+	if fn == nil {
+		return fmt.Errorf("gpsgen: no simulation callback")
+	}
+
+	tick := step.Seconds()
+	numSteps := int64(duration / step)
+	for i := int64(1); i <= numSteps; i++ {
+		now := start.Add(time.Duration(i) * step)
+		for j := 0; j < len(devices); j++ {
+			dev := devices[j]
+			if dev == nil {
+				continue
+			}
+			dev.Next(tick)
+			if err := fn(now, dev.State()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package gpsgen
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSimulate(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	makeDevices := func() []*Device {
+		rnd := random.NewRandomWithSeed(99)
+		devices := make([]*Device, 0, 3)
+		for i := 0; i < 3; i++ {
+			opts := NewDeviceOptions()
+			opts.Random = rnd
+			dev, err := NewDevice(opts)
+			require.NoError(t, err)
+			require.NoError(t, dev.AddRoute(RandomRouteWithSource(rnd, 104.068, 30.665, 1, RouteLevelXS)))
+			devices = append(devices, dev)
+		}
+		return devices
+	}
+
+	run := func() []*pb.Device {
+		states := make([]*pb.Device, 0)
+		err := Simulate(makeDevices(), start, time.Minute, 5*time.Second, func(now time.Time, state *pb.Device) error {
+			require.True(t, now.After(start))
+			states = append(states, proto.Clone(state).(*pb.Device))
+			return nil
+		})
+		require.NoError(t, err)
+		return states
+	}
+
+	states1 := run()
+	states2 := run()
+	require.Len(t, states1, 12*3)
+	require.Len(t, states2, len(states1))
+	for i := 0; i < len(states1); i++ {
+		require.True(t, proto.Equal(states1[i], states2[i]))
+	}
+}
+
+func TestSimulate_Errors(t *testing.T) {
+	start := time.Now()
+	noop := func(time.Time, *pb.Device) error { return nil }
+	require.Error(t, Simulate(nil, start, time.Minute, 0, noop))
+	require.Error(t, Simulate(nil, start, time.Second, time.Minute, noop))
+	require.Error(t, Simulate(nil, start, time.Minute, time.Second, nil))
+
+	stop := errors.New("stop")
+	calls := 0
+	err := Simulate([]*Device{NewTracker()}, start, time.Hour, time.Second, func(time.Time, *pb.Device) error {
+		calls++
+		if calls == 10 {
+			return stop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 10, calls)
+}
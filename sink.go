@@ -0,0 +1,161 @@
+package gpsgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sink receives the packets produced by the Generator.
+// Write is called concurrently by the generator workers, so implementations
+// must be safe for concurrent use. The packet and its devices are reused
+// after Write returns; a sink that keeps a packet must clone it.
+type Sink interface {
+	// Write delivers a packet to the sink.
+	Write(ctx context.Context, pck *pb.Packet) error
+
+	// Close releases the resources of the sink. It is called once when the generator stops.
+	Close() error
+}
+
+// SinkFunc is an adapter to allow the use of an ordinary function as a Sink.
+type SinkFunc func(ctx context.Context, pck *pb.Packet) error
+
+// Write calls fn(ctx, pck).
+func (fn SinkFunc) Write(ctx context.Context, pck *pb.Packet) error {
+	return fn(ctx, pck)
+}
+
+// Close does nothing.
+func (fn SinkFunc) Close() error {
+	return nil
+}
+
+// WriterSink is a Sink that encodes packets and writes them to an io.Writer.
+// If the encoder is a HeaderEncoder, its header is written before the first packet.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	enc    Encoder
+	buf    []byte
+	header bool
+}
+
+// NewWriterSink creates a new WriterSink with the given writer and encoder.
+// If enc is nil, packets are encoded as binary protobuf.
+func NewWriterSink(w io.Writer, enc Encoder) *WriterSink {
+	if enc == nil {
+		enc = ProtoEncoder{}
+	}
+	return &WriterSink{
+		w:   w,
+		enc: enc,
+	}
+}
+
+// Write encodes the packet and writes it to the underlying writer.
+func (s *WriterSink) Write(_ context.Context, pck *pb.Packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf := s.buf[:0]
+	if h, ok := s.enc.(HeaderEncoder); ok && !s.header {
+		var err error
+		if buf, err = h.EncodeHeader(buf); err != nil {
+			return err
+		}
+	}
+	data, err := s.enc.Encode(buf, pck)
+	if err != nil {
+		return err
+	}
+	s.buf = data
+	if _, err = s.w.Write(data); err != nil {
+		return err
+	}
+	s.header = true
+	return nil
+}
+
+// Close does not close the underlying writer.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// ChanSink is a Sink that sends a copy of every packet to a channel.
+type ChanSink struct {
+	mu     sync.RWMutex
+	ch     chan<- *pb.Packet
+	closed bool
+}
+
+// NewChanSink creates a new ChanSink that sends packets to ch.
+// The channel is closed when the sink is closed.
+func NewChanSink(ch chan<- *pb.Packet) *ChanSink {
+	return &ChanSink{ch: ch}
+}
+
+// Write sends a copy of the packet to the channel.
+// It blocks until the packet is received or ctx is done.
+func (s *ChanSink) Write(ctx context.Context, pck *pb.Packet) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("gpsgen: write to closed sink")
+	}
+	select {
+	case s.ch <- proto.Clone(pck).(*pb.Packet):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the channel.
+func (s *ChanSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.ch)
+	return nil
+}
+
+// FanoutSink is a Sink that writes every packet to several sinks.
+type FanoutSink struct {
+	sinks []Sink
+}
+
+// NewFanoutSink creates a new FanoutSink for the given sinks.
+func NewFanoutSink(sinks ...Sink) *FanoutSink {
+	return &FanoutSink{sinks: sinks}
+}
+
+// Write writes the packet to all sinks and returns their joined errors.
+// A failing sink does not prevent the packet from being written to the others.
+func (s *FanoutSink) Write(ctx context.Context, pck *pb.Packet) error {
+	var errs []error
+	for i := 0; i < len(s.sinks); i++ {
+		if err := s.sinks[i].Write(ctx, pck); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all sinks and returns their joined errors.
+func (s *FanoutSink) Close() error {
+	var errs []error
+	for i := 0; i < len(s.sinks); i++ {
+		if err := s.sinks[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package gpsgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"github.com/stretchr/testify/require"
+)
+
+type testSink struct {
+	packets uint32
+	closed  uint32
+	err     error
+}
+
+func (s *testSink) Write(_ context.Context, pck *pb.Packet) error {
+	atomic.AddUint32(&s.packets, 1)
+	return s.err
+}
+
+func (s *testSink) Close() error {
+	atomic.AddUint32(&s.closed, 1)
+	return nil
+}
+
+func TestWriterSink(t *testing.T) {
+	dev := NewTracker()
+	require.NoError(t, dev.AddRoute(testRoutes()...))
+	pck := &pb.Packet{Devices: []*pb.Device{dev.State()}, Timestamp: 1}
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf, nil)
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.NoError(t, sink.Close())
+
+	got, err := PacketFromBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, dev.ID(), got.Devices[0].Id)
+	require.Equal(t, int64(1), got.Timestamp)
+}
+
+func TestWriterSink_Header(t *testing.T) {
+	pck := &pb.Packet{Devices: []*pb.Device{{Id: "a"}}, Timestamp: 1}
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf, NewCSVEncoder(true))
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.NoError(t, sink.Write(context.Background(), pck))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, strings.Join(CSVColumns(), ","), lines[0])
+}
+
+func TestChanSink(t *testing.T) {
+	ch := make(chan *pb.Packet, 1)
+	sink := NewChanSink(ch)
+	pck := &pb.Packet{Devices: []*pb.Device{{Id: "a"}}}
+	require.NoError(t, sink.Write(context.Background(), pck))
+	pck.Devices[0].Id = "b"
+	require.Equal(t, "a", (<-ch).Devices[0].Id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, sink.Write(context.Background(), pck))
+	require.ErrorIs(t, sink.Write(ctx, pck), context.Canceled)
+
+	require.NoError(t, sink.Close())
+	require.NoError(t, sink.Close())
+	require.Error(t, sink.Write(context.Background(), pck))
+}
+
+func TestFanoutSink(t *testing.T) {
+	errWrite := errors.New("write error")
+	a, b := &testSink{}, &testSink{err: errWrite}
+	sink := NewFanoutSink(a, b)
+	require.ErrorIs(t, sink.Write(context.Background(), &pb.Packet{}), errWrite)
+	require.Equal(t, uint32(1), a.packets)
+	require.Equal(t, uint32(1), b.packets)
+	require.NoError(t, sink.Close())
+	require.Equal(t, uint32(1), a.closed)
+	require.Equal(t, uint32(1), b.closed)
+}
+
+func TestGenerator_Sinks(t *testing.T) {
+	gen := New(&Options{Interval: 10 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		dev := NewTracker()
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		require.NoError(t, gen.Attach(dev))
+	}
+
+	var buf bytes.Buffer
+	ch := make(chan *pb.Packet, 64)
+	debug := &testSink{}
+	require.NoError(t, gen.AddSink(NewWriterSink(&buf, ProtoEncoder{})))
+	require.NoError(t, gen.AddSink(NewChanSink(ch)))
+	require.NoError(t, gen.AddSink(debug))
+
+	gen.OnNext(func() {
+		require.ErrorIs(t, gen.AddSink(&testSink{}), ErrGeneratorRunning)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, gen.Run(ctx))
+	require.ErrorIs(t, gen.AddSink(&testSink{}), ErrGeneratorStopped)
+
+	require.NotZero(t, buf.Len())
+	require.NotZero(t, atomic.LoadUint32(&debug.packets))
+	require.Equal(t, uint32(1), atomic.LoadUint32(&debug.closed))
+
+	n := 0
+	for pck := range ch {
+		require.Len(t, pck.Devices, 3)
+		n++
+	}
+	require.Equal(t, int(atomic.LoadUint32(&debug.packets)), n)
+}
@@ -0,0 +1,329 @@
+package gpsgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/mmadfox/go-gpsgen/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrInvalidSnapshot is returned by Restore when the snapshot stream is malformed.
+	ErrInvalidSnapshot = errors.New("gpsgen: invalid generator snapshot")
+
+	// ErrDeviceAttached is returned by Restore when a stored device is already attached.
+	ErrDeviceAttached = errors.New("gpsgen: device is already attached")
+)
+
+const snapshotVersion = 2
+
+var snapshotMagic = []byte("GPSGEN")
+
+// Header fields of a generator snapshot.
+// Fields 8 and 10 held the per-device intervals and omit masks in version 1.
+const (
+	snapshotFieldVersion      protowire.Number = 1
+	snapshotFieldInterval     protowire.Number = 2
+	snapshotFieldPacketSize   protowire.Number = 3
+	snapshotFieldNumWorkers   protowire.Number = 4
+	snapshotFieldBackpressure protowire.Number = 5
+	snapshotFieldBufferSize   protowire.Number = 6
+	snapshotFieldNumDevices   protowire.Number = 7
+	snapshotFieldOmitFields   protowire.Number = 9
+)
+
+// Fields of a device record of a generator snapshot.
+const (
+	snapshotDeviceFieldInterval   protowire.Number = 1
+	snapshotDeviceFieldOmitFields protowire.Number = 2
+	snapshotDeviceFieldSnapshot   protowire.Number = 3
+)
+
+const maxSnapshotRecordSize = 64 << 20
+
+type snapshotHeader struct {
+	version    uint64
+	opts       Options
+	numDevices uint64
+}
+
+type snapshotDevice struct {
+	interval time.Duration
+	omit     FieldMask
+	snap     *pb.Snapshot
+}
+
+// Snapshot writes a checkpoint of the generator to w.
+// The stream starts with a header holding the generator options followed by
+// a length-delimited record of every attached device with its report interval,
+// omitted fields and pb.Snapshot.
+// It is safe to call Snapshot while the generator is running;
+// each device is captured between two of its steps.
+func (g *Generator) Snapshot(w io.Writer) error {
+	g.mu.RLock()
+	devices := make([]*Device, len(g.devices))
+	copy(devices, g.devices)
+	header := snapshotHeader{
+		version: snapshotVersion,
+		opts: Options{
+			Interval:     g.interval,
+			PacketSize:   g.packetSize,
+			NumWorkers:   g.numWorkers,
+			Backpressure: g.backpressure,
+			BufferSize:   g.bufferSize,
+			OmitFields:   g.omit,
+		},
+		numDevices: uint64(len(devices)),
+	}
+	g.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotMagic); err != nil {
+		return err
+	}
+	if err := writeDelimited(bw, header.marshal()); err != nil {
+		return err
+	}
+	var data []byte
+	for i := 0; i < len(devices); i++ {
+		rec := snapshotDevice{
+			interval: devices[i].Interval(),
+			omit:     devices[i].OmitFields(),
+			snap:     devices[i].Snapshot(),
+		}
+		var err error
+		if data, err = rec.marshal(data[:0]); err != nil {
+			return err
+		}
+		if err := writeDelimited(bw, data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore reads a checkpoint written by Snapshot, applies the stored options
+// and attaches the stored devices one by one as they are read.
+// The devices already attached are kept; a stored device with the ID of
+// an attached one fails the restore with ErrDeviceAttached.
+// The clock of the generator is not part of the snapshot and stays unchanged.
+// Restore must be called before Run. If the snapshot can not be read to the end,
+// the devices restored so far are detached again, while the options stay applied.
+func (g *Generator) Restore(r io.Reader) error {
+	if err := g.begin(); err != nil {
+		return err
+	}
+	defer atomic.StoreUint32(&g.state, stateIdle)
+
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if !bytes.Equal(magic, snapshotMagic) {
+		return fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	data, err := readDelimited(br, nil)
+	if err != nil {
+		return err
+	}
+	var header snapshotHeader
+	if err := header.unmarshal(data); err != nil {
+		return err
+	}
+	if header.version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header.version)
+	}
+
+	opts := header.opts
+	opts.Clock = g.clock
+	opts.Encoder = g.encoder
+	opts.prepare()
+	g.mu.Lock()
+	g.configure(&opts)
+	g.mu.Unlock()
+
+	restored := make([]string, 0, header.numDevices)
+	for i := uint64(0); i < header.numDevices; i++ {
+		id, err := g.restoreDevice(br, &data)
+		if err != nil {
+			for j := 0; j < len(restored); j++ {
+				_ = g.Detach(restored[j])
+			}
+			return err
+		}
+		restored = append(restored, id)
+	}
+	return nil
+}
+
+// restoreDevice reads the next device record, attaches the device and returns its ID.
+func (g *Generator) restoreDevice(br *bufio.Reader, buf *[]byte) (string, error) {
+	data, err := readDelimited(br, *buf)
+	if err != nil {
+		return "", err
+	}
+	*buf = data
+	var rec snapshotDevice
+	if err := rec.unmarshal(data); err != nil {
+		return "", err
+	}
+	if _, ok := g.Lookup(rec.snap.Id); ok {
+		return "", fmt.Errorf("%w: %s", ErrDeviceAttached, rec.snap.Id)
+	}
+	rec.snap.Status = int64(Stopped)
+	d := new(Device)
+	d.FromSnapshot(rec.snap)
+	d.SetInterval(rec.interval)
+	if rec.omit != 0 {
+		d.SetOmitFields(rec.omit)
+	}
+	if err := g.Attach(d); err != nil {
+		return "", err
+	}
+	return d.ID(), nil
+}
+
+func (h *snapshotHeader) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, snapshotFieldVersion, h.version)
+	b = appendVarintField(b, snapshotFieldInterval, uint64(h.opts.Interval))
+	b = appendVarintField(b, snapshotFieldPacketSize, uint64(h.opts.PacketSize))
+	b = appendVarintField(b, snapshotFieldNumWorkers, uint64(h.opts.NumWorkers))
+	b = appendVarintField(b, snapshotFieldBackpressure, uint64(h.opts.Backpressure))
+	b = appendVarintField(b, snapshotFieldBufferSize, uint64(h.opts.BufferSize))
+	b = appendVarintField(b, snapshotFieldNumDevices, h.numDevices)
+	b = appendVarintField(b, snapshotFieldOmitFields, uint64(h.opts.OmitFields))
+	return b
+}
+
+func (h *snapshotHeader) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ == protowire.VarintType {
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			switch num {
+			case snapshotFieldVersion:
+				h.version = v
+			case snapshotFieldInterval:
+				h.opts.Interval = time.Duration(v)
+			case snapshotFieldPacketSize:
+				h.opts.PacketSize = int(v)
+			case snapshotFieldNumWorkers:
+				h.opts.NumWorkers = int(v)
+			case snapshotFieldBackpressure:
+				h.opts.Backpressure = BackpressurePolicy(v)
+			case snapshotFieldBufferSize:
+				h.opts.BufferSize = int(v)
+			case snapshotFieldNumDevices:
+				h.numDevices = v
+			case snapshotFieldOmitFields:
+				h.opts.OmitFields = FieldMask(v)
+			}
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (rec *snapshotDevice) marshal(b []byte) ([]byte, error) {
+	b = appendVarintField(b, snapshotDeviceFieldInterval, uint64(rec.interval))
+	b = appendVarintField(b, snapshotDeviceFieldOmitFields, uint64(rec.omit))
+	snap, err := proto.Marshal(rec.snap)
+	if err != nil {
+		return b, err
+	}
+	b = protowire.AppendTag(b, snapshotDeviceFieldSnapshot, protowire.BytesType)
+	return protowire.AppendBytes(b, snap), nil
+}
+
+func (rec *snapshotDevice) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch {
+		case num == snapshotDeviceFieldSnapshot && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				rec.snap = new(pb.Snapshot)
+				if err := proto.Unmarshal(v, rec.snap); err != nil {
+					return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+				}
+			}
+		case typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			switch num {
+			case snapshotDeviceFieldInterval:
+				rec.interval = time.Duration(v)
+			case snapshotDeviceFieldOmitFields:
+				rec.omit = FieldMask(v)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	if rec.snap == nil {
+		return fmt.Errorf("%w: missing device state", ErrInvalidSnapshot)
+	}
+	return nil
+}
+
+// writeDelimited writes data prefixed with its length.
+func writeDelimited(w io.Writer, data []byte) error {
+	if _, err := w.Write(protowire.AppendVarint(nil, uint64(len(data)))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readDelimited reads data written by writeDelimited into buf.
+func readDelimited(br *bufio.Reader, buf []byte) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if size > maxSnapshotRecordSize {
+		return nil, fmt.Errorf("%w: record too large", ErrInvalidSnapshot)
+	}
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return buf, nil
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
@@ -0,0 +1,123 @@
+package gpsgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator_SnapshotRestore(t *testing.T) {
+	gen := New(&Options{
+		Interval:     2 * time.Second,
+		PacketSize:   2048,
+		NumWorkers:   2,
+		Backpressure: BackpressureDropOldest,
+		BufferSize:   16,
+	})
+
+	for i := 0; i < 3; i++ {
+		dev, err := NewDevice(nil)
+		require.NoError(t, err)
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		dev.AddSensor(makeSensor(t, "s1"))
+		dev.SetInterval(time.Duration(i+1) * 5 * time.Second)
+		dev.SetOmitFields(FieldMask(i) * FieldUTM)
+		for j := 0; j < 10; j++ {
+			dev.Next(1)
+		}
+		require.NoError(t, gen.Attach(dev))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gen.Snapshot(&buf))
+
+	restored := New(nil)
+	require.NoError(t, restored.Restore(&buf))
+	require.Equal(t, 2*time.Second, restored.interval)
+	require.Equal(t, 2048, restored.packetSize)
+	require.Equal(t, 2, restored.numWorkers)
+	require.Equal(t, BackpressureDropOldest, restored.backpressure)
+	require.Equal(t, 16, cap(restored.queue))
+	require.Equal(t, gen.NumDevices(), restored.NumDevices())
+
+	gen.Each(func(i int, want *Device) bool {
+		got, ok := restored.Lookup(want.ID())
+		require.True(t, ok)
+		require.Equal(t, want.Interval(), got.Interval())
+		require.Equal(t, want.OmitFields(), got.OmitFields())
+		require.Equal(t, Running, got.Status())
+		require.Equal(t, want.Duration(), got.Duration())
+		require.Equal(t, want.Location(), got.Location())
+		require.Equal(t, want.RouteIndex(), got.RouteIndex())
+		require.Equal(t, want.NumRoutes(), got.NumRoutes())
+		require.Equal(t, want.NumSensors(), got.NumSensors())
+		return true
+	})
+}
+
+func TestGenerator_RestoreStats(t *testing.T) {
+	gen := New(&Options{NumWorkers: 3})
+	var buf bytes.Buffer
+	require.NoError(t, gen.Snapshot(&buf))
+	data := buf.Bytes()
+
+	restored := New(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			restored.Stats()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, restored.Restore(bytes.NewReader(data)))
+	}
+	<-done
+	require.Len(t, restored.Stats().Workers, 3)
+}
+
+func TestGenerator_RestoreInvalid(t *testing.T) {
+	gen := New(nil)
+	require.ErrorIs(t, gen.Restore(strings.NewReader("")), ErrInvalidSnapshot)
+	require.ErrorIs(t, gen.Restore(strings.NewReader("NOTGPSGEN")), ErrInvalidSnapshot)
+
+	var buf bytes.Buffer
+	src := New(nil)
+	require.NoError(t, src.Attach(NewTracker()))
+	require.NoError(t, src.Snapshot(&buf))
+	data := buf.Bytes()
+	require.ErrorIs(t, gen.Restore(bytes.NewReader(data[:len(data)-4])), ErrInvalidSnapshot)
+	require.Equal(t, 0, gen.NumDevices())
+}
+
+func TestGenerator_RestoreDuplicate(t *testing.T) {
+	src := New(nil)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, src.Attach(NewTracker()))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+	data := buf.Bytes()
+
+	gen := New(nil)
+	var dup *Device
+	src.Each(func(i int, d *Device) bool {
+		dup = d
+		return i < 2
+	})
+	require.NoError(t, src.Detach(dup.ID()))
+	require.NoError(t, gen.Attach(dup))
+	err := gen.Restore(bytes.NewReader(data))
+	require.ErrorIs(t, err, ErrDeviceAttached)
+	require.ErrorContains(t, err, dup.ID())
+	// the devices restored before the duplicate are detached again
+	require.Equal(t, 1, gen.NumDevices())
+
+	gen = New(nil)
+	require.NoError(t, gen.Restore(bytes.NewReader(data)))
+	require.ErrorIs(t, gen.Restore(bytes.NewReader(data)), ErrDeviceAttached)
+	require.Equal(t, 3, gen.NumDevices())
+}
@@ -0,0 +1,192 @@
+package gpsgen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains the runtime statistics of a Generator.
+type Stats struct {
+	// Ticks is the number of executed iterations.
+	Ticks uint64
+
+	// Interval is the configured time between iterations.
+	Interval time.Duration
+
+	// TickDuration is the actual clock time between the last two iterations.
+	TickDuration time.Duration
+
+	// DevicesStepped is the number of device steps performed.
+	DevicesStepped uint64
+
+	// DevicesSkipped is the number of device steps skipped because
+	// the device was locked by another goroutine.
+	DevicesSkipped uint64
+
+	// Packets is the number of emitted packets.
+	Packets uint64
+
+	// Bytes is the number of bytes passed to the OnPacket callback.
+	Bytes uint64
+
+	// MarshalErrors is the number of packets that failed to encode.
+	MarshalErrors uint64
+
+	// DroppedPackets is the number of packets dropped by the backpressure policy.
+	DroppedPackets uint64
+
+	// DelayedTicks is the number of iterations that overran the interval.
+	DelayedTicks uint64
+
+	// Workers contains the statistics of each worker.
+	Workers []WorkerStats
+}
+
+// WorkerStats contains the runtime statistics of a single generator worker.
+type WorkerStats struct {
+	// Packets is the number of packets processed by the worker.
+	Packets uint64
+
+	// LastLatency is the wall time the worker spent on its last packet.
+	LastLatency time.Duration
+
+	// TotalLatency is the total wall time the worker spent on packets.
+	TotalLatency time.Duration
+}
+
+type stats struct {
+	ticks          uint64
+	tickDuration   int64
+	devicesStepped uint64
+	devicesSkipped uint64
+	packets        uint64
+	bytes          uint64
+	marshalErrors  uint64
+	workers        []workerStats
+}
+
+type workerStats struct {
+	packets      uint64
+	lastLatency  int64
+	totalLatency int64
+}
+
+func (s *workerStats) observe(d time.Duration) {
+	atomic.AddUint64(&s.packets, 1)
+	atomic.StoreInt64(&s.lastLatency, int64(d))
+	atomic.AddInt64(&s.totalLatency, int64(d))
+}
+
+// Stats returns a snapshot of the runtime statistics of the generator.
+func (g *Generator) Stats() Stats {
+	// Restore replaces the configuration and the worker statistics
+	g.mu.RLock()
+	interval := g.interval
+	workers := g.stats.workers
+	g.mu.RUnlock()
+
+	st := Stats{
+		Ticks:          atomic.LoadUint64(&g.stats.ticks),
+		Interval:       interval,
+		TickDuration:   time.Duration(atomic.LoadInt64(&g.stats.tickDuration)),
+		DevicesStepped: atomic.LoadUint64(&g.stats.devicesStepped),
+		DevicesSkipped: atomic.LoadUint64(&g.stats.devicesSkipped),
+		Packets:        atomic.LoadUint64(&g.stats.packets),
+		Bytes:          atomic.LoadUint64(&g.stats.bytes),
+		MarshalErrors:  atomic.LoadUint64(&g.stats.marshalErrors),
+		DroppedPackets: g.DroppedPackets(),
+		DelayedTicks:   g.DelayedTicks(),
+		Workers:        make([]WorkerStats, len(workers)),
+	}
+	for i := 0; i < len(workers); i++ {
+		w := &workers[i]
+		st.Workers[i] = WorkerStats{
+			Packets:      atomic.LoadUint64(&w.packets),
+			LastLatency:  time.Duration(atomic.LoadInt64(&w.lastLatency)),
+			TotalLatency: time.Duration(atomic.LoadInt64(&w.totalLatency)),
+		}
+	}
+	return st
+}
+
+// MetricsHandler returns an http.Handler that serves the generator statistics
+// in the Prometheus text exposition format.
+func (g *Generator) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		st := g.Stats()
+		_ = st.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the statistics to w in the Prometheus text exposition format.
+func (s Stats) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeMetric(bw, "gpsgen_ticks_total", "counter",
+		"Number of executed generator iterations.", uint64Value(s.Ticks))
+	writeMetric(bw, "gpsgen_tick_interval_seconds", "gauge",
+		"Configured time between generator iterations.", secondsValue(s.Interval))
+	writeMetric(bw, "gpsgen_tick_duration_seconds", "gauge",
+		"Actual clock time between the last two generator iterations.", secondsValue(s.TickDuration))
+	writeMetric(bw, "gpsgen_devices_stepped_total", "counter",
+		"Number of performed device steps.", uint64Value(s.DevicesStepped))
+	writeMetric(bw, "gpsgen_devices_skipped_total", "counter",
+		"Number of device steps skipped because the device was locked.", uint64Value(s.DevicesSkipped))
+	writeMetric(bw, "gpsgen_packets_total", "counter",
+		"Number of emitted packets.", uint64Value(s.Packets))
+	writeMetric(bw, "gpsgen_bytes_total", "counter",
+		"Number of bytes passed to the packet callback.", uint64Value(s.Bytes))
+	writeMetric(bw, "gpsgen_marshal_errors_total", "counter",
+		"Number of packets that failed to encode.", uint64Value(s.MarshalErrors))
+	writeMetric(bw, "gpsgen_dropped_packets_total", "counter",
+		"Number of packets dropped by the backpressure policy.", uint64Value(s.DroppedPackets))
+	writeMetric(bw, "gpsgen_delayed_ticks_total", "counter",
+		"Number of generator iterations that overran the interval.", uint64Value(s.DelayedTicks))
+
+	if len(s.Workers) > 0 {
+		writeHeader(bw, "gpsgen_worker_packets_total", "counter",
+			"Number of packets processed by the worker.")
+		for i := 0; i < len(s.Workers); i++ {
+			writeWorkerSample(bw, "gpsgen_worker_packets_total", i, uint64Value(s.Workers[i].Packets))
+		}
+		writeHeader(bw, "gpsgen_worker_latency_seconds", "gauge",
+			"Wall time the worker spent on its last packet.")
+		for i := 0; i < len(s.Workers); i++ {
+			writeWorkerSample(bw, "gpsgen_worker_latency_seconds", i, secondsValue(s.Workers[i].LastLatency))
+		}
+		writeHeader(bw, "gpsgen_worker_latency_seconds_total", "counter",
+			"Total wall time the worker spent on packets.")
+		for i := 0; i < len(s.Workers); i++ {
+			writeWorkerSample(bw, "gpsgen_worker_latency_seconds_total", i, secondsValue(s.Workers[i].TotalLatency))
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeMetric(w *bufio.Writer, name, typ, help, value string) {
+	writeHeader(w, name, typ, help)
+	fmt.Fprintf(w, "%s %s\n", name, value)
+}
+
+func writeWorkerSample(w *bufio.Writer, name string, worker int, value string) {
+	fmt.Fprintf(w, "%s{worker=\"%d\"} %s\n", name, worker+1, value)
+}
+
+func uint64Value(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func secondsValue(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,107 @@
+package gpsgen
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator_Stats(t *testing.T) {
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	gen := New(&Options{
+		Interval:   time.Second,
+		NumWorkers: 2,
+		Clock:      clock,
+	})
+	for i := 0; i < 3; i++ {
+		dev := NewTracker()
+		require.NoError(t, dev.AddRoute(testRoutes()...))
+		require.NoError(t, gen.Attach(dev))
+	}
+
+	var bytes int
+	gen.OnPacket(func(b []byte) error {
+		bytes += len(b)
+		return nil
+	})
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+
+	st := gen.Stats()
+	require.Equal(t, uint64(3), st.Ticks)
+	require.Equal(t, time.Second, st.Interval)
+	require.Equal(t, time.Second, st.TickDuration)
+	require.Equal(t, uint64(9), st.DevicesStepped)
+	require.Zero(t, st.DevicesSkipped)
+	require.Equal(t, uint64(3), st.Packets)
+	require.Equal(t, uint64(bytes), st.Bytes)
+	require.Zero(t, st.MarshalErrors)
+	require.Len(t, st.Workers, 2)
+	require.Equal(t, uint64(3), st.Workers[0].Packets+st.Workers[1].Packets)
+
+	rec := httptest.NewRecorder()
+	gen.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	metrics := string(body)
+	require.Contains(t, metrics, "# TYPE gpsgen_ticks_total counter\ngpsgen_ticks_total 3\n")
+	require.Contains(t, metrics, "gpsgen_tick_interval_seconds 1\n")
+	require.Contains(t, metrics, "gpsgen_devices_stepped_total 9\n")
+	require.Contains(t, metrics, "gpsgen_packets_total 3\n")
+	require.Contains(t, metrics, `gpsgen_worker_packets_total{worker="1"}`)
+	require.Contains(t, metrics, `gpsgen_worker_latency_seconds{worker="2"}`)
+	for _, line := range strings.Split(strings.TrimSpace(metrics), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		require.Len(t, strings.Fields(line), 2, line)
+	}
+}
+
+func TestGenerator_StatsNoConsumer(t *testing.T) {
+	clock := NewManualClock(time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC))
+	gen := New(&Options{Interval: time.Second, Clock: clock})
+	require.NoError(t, gen.Attach(NewTracker()))
+	nextCh := make(chan struct{}, 1)
+	gen.OnNext(func() {
+		nextCh <- struct{}{}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, gen.Run(context.Background()))
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		<-nextCh
+	}
+	gen.Close()
+	<-done
+
+	st := gen.Stats()
+	require.Equal(t, uint64(3), st.Ticks)
+	require.Zero(t, st.Packets)
+	require.Zero(t, st.Bytes)
+}
@@ -45,7 +45,13 @@ func NewModel(value string) (Model, error) {
 // It creates a Model object with a value in the format "RT-" followed by a
 // randomly generated string of length 6.
 func RandomModel() Model {
-	return Model{val: "RT-" + random.String(6)}
+	return RandomModelWithSource(nil)
+}
+
+// RandomModelWithSource is like RandomModel but draws the value from src.
+// A nil src uses the shared source.
+func RandomModelWithSource(src *random.Random) Model {
+	return Model{val: "RT-" + random.Or(src).String(6)}
 }
 
 // IsEmtpy checks whether the model value is empty (i.e., has a length of 0).
@@ -1,13 +1,13 @@
 package types
 
 import (
-	"github.com/valyala/fastrand"
+	"github.com/mmadfox/go-gpsgen/random"
 )
 
 // Random represents a random number generator.
 type Random struct {
 	min, max int
-	rnd      fastrand.RNG
+	rnd      *random.Random
 }
 
 // Min returns the minimum value.
@@ -22,11 +22,25 @@ func (r *Random) Max() int {
 
 // Value generates and returns a random integer value within the range specified by min and max.
 func (r *Random) Value() int {
-	return int(r.rnd.Uint32n(uint32(r.max-r.min))) + r.min
+	if r.max <= r.min {
+		return r.min
+	}
+	return random.Or(r.rnd).Intn(r.max-r.min) + r.min
+}
+
+// SetSource sets the source of the subsequent values. A nil src uses the shared source.
+func (r *Random) SetSource(src *random.Random) {
+	r.rnd = src
 }
 
 // NewRandom creates a new Random instance with the specified minimum and maximum values.
 func NewRandom(min, max int) *Random {
+	return NewRandomWithSource(nil, min, max)
+}
+
+// NewRandomWithSource is like NewRandom but draws the values from src.
+// A nil src uses the shared source.
+func NewRandomWithSource(src *random.Random, min, max int) *Random {
 	if min < 0 {
 		min = 0
 	}
@@ -43,6 +57,6 @@ func NewRandom(min, max int) *Random {
 	return &Random{
 		min: min,
 		max: max,
-		rnd: fastrand.RNG{},
+		rnd: src,
 	}
 }
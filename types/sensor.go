@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/mmadfox/go-gpsgen/curve"
 	"github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 )
 
 // ErrEmptySensorName indicates that the sensor name is empty.
@@ -42,6 +43,18 @@ const (
 //
 // Valid amplitude values from 4 to 512.
 func NewSensor(name string, min, max float64, amplitude int, mode SensorMode) (*Sensor, error) {
+	return NewSensorWithSource(nil, name, min, max, amplitude, mode)
+}
+
+// NewSensorWithSource is like NewSensor but draws the ID and the random curve from src.
+// A nil src uses the shared source.
+func NewSensorWithSource(
+	src *random.Random,
+	name string,
+	min, max float64,
+	amplitude int,
+	mode SensorMode,
+) (*Sensor, error) {
 	if err := validateAmplitude(amplitude); err != nil {
 		return nil, err
 	}
@@ -51,14 +64,15 @@ func NewSensor(name string, min, max float64, amplitude int, mode SensorMode) (*
 	if ok := validateSensorMode(mode); !ok {
 		mode = WithSensorRandomMode
 	}
-	gen := curve.New(
+	gen := curve.NewWithSource(
+		src,
 		min,
 		max,
 		amplitude,
 		mode,
 	)
 	return &Sensor{
-		id:   uuid.NewString(),
+		id:   random.Or(src).UUID(),
 		name: name,
 		min:  min,
 		max:  max,
@@ -138,6 +152,16 @@ func (t *Sensor) String() string {
 	return fmt.Sprintf("Sensor{%s: valX=%.8f, valY=%.8f}", t.name, t.valX, t.valY)
 }
 
+// Source returns the random source of the sensor. Nil means the shared source.
+func (t *Sensor) Source() *random.Random {
+	return t.gen.Source()
+}
+
+// SetSource sets the random source of the subsequent draws. A nil src uses the shared source.
+func (t *Sensor) SetSource(src *random.Random) {
+	t.gen.SetSource(src)
+}
+
 // Shuffle shuffles the generator of the Sensor instance.
 func (t *Sensor) Shuffle() {
 	t.gen.Shuffle()
@@ -174,6 +198,8 @@ func (t *Sensor) FromSnapshot(snap *SensorSnapshot) {
 	t.max = snap.Max
 	t.valX = snap.ValX
 	t.valY = snap.ValY
-	t.gen = new(curve.Curve)
+	if t.gen == nil {
+		t.gen = new(curve.Curve)
+	}
 	t.gen.FromSnapshot(snap.Gen)
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/mmadfox/go-gpsgen/curve"
 	"github.com/mmadfox/go-gpsgen/proto"
+	"github.com/mmadfox/go-gpsgen/random"
 )
 
 const (
@@ -34,6 +35,12 @@ type Speed struct {
 // It also takes an amplitude parameter for generating a random curve.
 // The minimum value is 0 to maximum 1000, and the amplitude parameter must be 4 to 512.
 func NewSpeed(min, max float64, amplitude int) (*Speed, error) {
+	return NewSpeedWithSource(nil, min, max, amplitude)
+}
+
+// NewSpeedWithSource is like NewSpeed but draws the random curve from src.
+// A nil src uses the shared source.
+func NewSpeedWithSource(src *random.Random, min, max float64, amplitude int) (*Speed, error) {
 	if min < MinSpeedVal {
 		return nil, ErrMinSpeed
 	}
@@ -53,7 +60,8 @@ func NewSpeed(min, max float64, amplitude int) (*Speed, error) {
 	if err := validateAmplitude(amplitude); err != nil {
 		return nil, err
 	}
-	gen := curve.New(
+	gen := curve.NewWithSource(
+		src,
 		min,
 		max,
 		amplitude,
@@ -89,6 +97,16 @@ func (t *Speed) String() string {
 	return fmt.Sprintf("speed: %.2f m/s", t.val)
 }
 
+// Source returns the random source of the speed curve. Nil means the shared source.
+func (t *Speed) Source() *random.Random {
+	return t.gen.Source()
+}
+
+// SetSource sets the random source of the subsequent draws. A nil src uses the shared source.
+func (t *Speed) SetSource(src *random.Random) {
+	t.gen.SetSource(src)
+}
+
 // Shuffle shuffles the generator of the Speed instance.
 func (t *Speed) Shuffle() {
 	t.gen.Shuffle()
@@ -121,7 +139,9 @@ func (t *Speed) FromSnapshot(snap *proto.Snapshot_CommonType) {
 	t.min = snap.Min
 	t.max = snap.Max
 	t.val = snap.Val
-	t.gen = new(curve.Curve)
+	if t.gen == nil {
+		t.gen = new(curve.Curve)
+	}
 	t.gen.FromSnapshot(snap.Gen)
 }
 